@@ -296,8 +296,10 @@ func mergeConfigs(cc *config.CloudConfig, md datasource.Metadata) (out config.Cl
 	}
 
 	if md.Hostname != "" {
-		if out.Hostname != "" {
-			log.Printf("Warning: user-data hostname (%s) overrides metadata hostname (%s)\n", out.Hostname, md.Hostname)
+		if out.PreserveHostname {
+			log.Printf("Ignoring metadata hostname (%s) to preserve the hostname\n", md.Hostname)
+		} else if _, fqdn := out.HostnameFQDN(); fqdn != "" {
+			log.Printf("Warning: user-data hostname (%s) overrides metadata hostname (%s)\n", fqdn, md.Hostname)
 		} else {
 			out.Hostname = md.Hostname
 		}
@@ -305,6 +307,20 @@ func mergeConfigs(cc *config.CloudConfig, md datasource.Metadata) (out config.Cl
 	for _, key := range md.SSHPublicKeys {
 		out.SSHAuthorizedKeys = append(out.SSHAuthorizedKeys, key)
 	}
+	if len(md.Nameservers) > 0 {
+		var rc config.ResolvConf
+		if out.ResolvConf != nil {
+			rc = *out.ResolvConf
+		}
+		if len(rc.Nameservers) > 0 {
+			log.Printf("Ignoring metadata nameservers (%v) in favor of user-data ones\n", md.Nameservers)
+		} else {
+			for _, ns := range md.Nameservers {
+				rc.Nameservers = append(rc.Nameservers, ns.String())
+			}
+		}
+		out.ResolvConf = &rc
+	}
 	return
 }
 
@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"encoding/base64"
 	"errors"
+	"net"
 	"reflect"
 	"testing"
 
@@ -69,6 +70,30 @@ func TestMergeConfigs(t *testing.T) {
 			md:  datasource.Metadata{Hostname: "md-host", SSHPublicKeys: map[string]string{"key": "ghi"}},
 			out: config.CloudConfig{SSHAuthorizedKeys: []string{"abc", "def", "ghi"}, Hostname: "cc-host"},
 		},
+		{
+			// A user-data FQDN overrides the metadata hostname as well
+			cc:  &config.CloudConfig{FQDN: "cc-host.example.com"},
+			md:  datasource.Metadata{Hostname: "md-host"},
+			out: config.CloudConfig{FQDN: "cc-host.example.com"},
+		},
+		{
+			// The metadata hostname is ignored to preserve the hostname
+			cc:  &config.CloudConfig{PreserveHostname: true},
+			md:  datasource.Metadata{Hostname: "md-host"},
+			out: config.CloudConfig{PreserveHostname: true},
+		},
+		{
+			// Metadata nameservers are used when user-data gives none
+			cc:  &config.CloudConfig{ResolvConf: &config.ResolvConf{SearchDomains: []string{"example.com"}}},
+			md:  datasource.Metadata{Nameservers: []net.IP{net.ParseIP("10.0.0.2")}},
+			out: config.CloudConfig{ResolvConf: &config.ResolvConf{Nameservers: []string{"10.0.0.2"}, SearchDomains: []string{"example.com"}}},
+		},
+		{
+			// user-data nameservers override metadata ones
+			cc:  &config.CloudConfig{ResolvConf: &config.ResolvConf{Nameservers: []string{"8.8.8.8"}}},
+			md:  datasource.Metadata{Nameservers: []net.IP{net.ParseIP("10.0.0.2")}},
+			out: config.CloudConfig{ResolvConf: &config.ResolvConf{Nameservers: []string{"8.8.8.8"}}},
+		},
 		{
 			// Completely non-conflicting merge should be fine
 			cc:  &config.CloudConfig{Hostname: "cc-host"},
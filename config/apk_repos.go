@@ -0,0 +1,208 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/coreos/yaml"
+)
+
+// APKRepos configures the repositories of apk, the package manager of
+// Alpine Linux, and the keys their indexes are signed with. The
+// repositories replace those of the system unless they are preserved.
+type APKRepos struct {
+	PreserveRepositories bool            `yaml:"preserve_repositories,omitempty"`
+	Repositories         []APKRepository `yaml:"repositories,omitempty"`
+	Keys                 []APKKey        `yaml:"keys,omitempty"`
+}
+
+// APKRepository is a repository of apk. In YAML it is either its URL or a
+// mapping. Packages of a tagged repository are only installed when asked
+// for as name@tag.
+type APKRepository struct {
+	URL string `yaml:"url,omitempty"`
+	Tag string `yaml:"tag,omitempty" valid:"^[A-Za-z0-9_-]+$"`
+}
+
+// apkRepository has the same fields as APKRepository without its custom
+// (un)marshalling.
+type apkRepository APKRepository
+
+// SetYAML implements yaml.Setter.
+func (r *APKRepository) SetYAML(tag string, value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		*r = APKRepository{URL: v}
+		return true
+	case map[interface{}]interface{}:
+		raw, err := yaml.Marshal(v)
+		if err != nil {
+			return false
+		}
+		var repo apkRepository
+		if err := yaml.Unmarshal(raw, &repo); err != nil {
+			return false
+		}
+		*r = APKRepository(repo)
+		return true
+	default:
+		return false
+	}
+}
+
+// GetYAML implements yaml.Getter. Untagged repositories are marshalled back
+// into their URL.
+func (r APKRepository) GetYAML() (tag string, value interface{}) {
+	if r.Tag == "" {
+		return "", r.URL
+	}
+	return "", apkRepository(r)
+}
+
+// String returns the repository as a line of /etc/apk/repositories.
+func (r APKRepository) String() string {
+	if r.Tag == "" {
+		return r.URL
+	}
+	return "@" + r.Tag + " " + r.URL
+}
+
+// AssertValid checks that the repository is an HTTP(S) or FTP URL, or the
+// absolute path of a local repository.
+func (r APKRepository) AssertValid() error {
+	if strings.HasPrefix(r.URL, "/") {
+		return nil
+	}
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return fmt.Errorf("invalid repository URL %q: %v", r.URL, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "ftp":
+	default:
+		return fmt.Errorf("invalid repository URL %q: want http, https or ftp", r.URL)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid repository URL %q: missing host", r.URL)
+	}
+	return nil
+}
+
+// APKKey is a public key the indexes of repositories are signed with. In
+// YAML it is either the URL to fetch it from or a mapping giving its PEM
+// content instead. The name, which has to match the name the signatures
+// refer to, defaults to the last element of the URL.
+type APKKey struct {
+	Name    string `yaml:"name,omitempty" valid:"^[A-Za-z0-9@._+-]+\\.pub$"`
+	Content string `yaml:"content,omitempty"`
+	URL     string `yaml:"url,omitempty"`
+}
+
+// apkKey has the same fields as APKKey without its custom (un)marshalling.
+type apkKey APKKey
+
+// SetYAML implements yaml.Setter.
+func (k *APKKey) SetYAML(tag string, value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		*k = APKKey{URL: v}
+		return true
+	case map[interface{}]interface{}:
+		raw, err := yaml.Marshal(v)
+		if err != nil {
+			return false
+		}
+		var key apkKey
+		if err := yaml.Unmarshal(raw, &key); err != nil {
+			return false
+		}
+		*k = APKKey(key)
+		return true
+	default:
+		return false
+	}
+}
+
+// GetYAML implements yaml.Getter. Keys only given by URL are marshalled
+// back into their URL.
+func (k APKKey) GetYAML() (tag string, value interface{}) {
+	if k.Name == "" && k.Content == "" {
+		return "", k.URL
+	}
+	return "", apkKey(k)
+}
+
+// FileName returns the name of the file of the key in /etc/apk/keys.
+func (k APKKey) FileName() string {
+	if k.Name != "" || k.URL == "" {
+		return k.Name
+	}
+	if u, err := url.Parse(k.URL); err == nil {
+		return u.Path[strings.LastIndex(u.Path, "/")+1:]
+	}
+	return ""
+}
+
+// AssertValid checks that the key is given either by PEM content or by an
+// HTTP(S) URL, and that it has a name.
+func (k APKKey) AssertValid() error {
+	switch {
+	case k.Content != "" && k.URL != "":
+		return errors.New("key given by both content and URL")
+	case k.Content != "":
+		if err := AssertAPKKeyValid(k.Content); err != nil {
+			return err
+		}
+	case k.URL != "":
+		u, err := url.Parse(k.URL)
+		if err != nil {
+			return fmt.Errorf("invalid key URL %q: %v", k.URL, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid key URL %q: want http or https", k.URL)
+		}
+	default:
+		return errors.New("key given by neither content nor URL")
+	}
+	if k.FileName() == "" {
+		return errors.New("missing key name")
+	}
+	return nil
+}
+
+// AssertAPKKeyValid checks that content is a PEM encoded public key, which
+// is how apk expects keys.
+func AssertAPKKeyValid(content string) error {
+	block, rest := pem.Decode([]byte(content))
+	if block == nil {
+		return errors.New("key is not PEM encoded")
+	}
+	if block.Type != "PUBLIC KEY" {
+		return fmt.Errorf("PEM block of type %q given instead of a public key", block.Type)
+	}
+	if strings.TrimSpace(string(rest)) != "" {
+		return errors.New("trailing data after the public key")
+	}
+	if _, err := x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+		return fmt.Errorf("invalid public key: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CACerts configures the certificate authorities the host trusts.
+// RemoveDefaults drops those of the distribution, leaving only the trusted
+// ones.
+type CACerts struct {
+	Trusted        []string `yaml:"trusted,omitempty"`
+	RemoveDefaults bool     `yaml:"remove_defaults,omitempty"`
+}
+
+// ParseCertificates parses the PEM encoded X.509 certificates of data,
+// which has to contain at least one certificate and nothing else.
+func ParseCertificates(data string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("PEM block of type %q given instead of a certificate", block.Type)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no PEM encoded certificate given")
+	}
+	if strings.TrimSpace(string(rest)) != "" {
+		return nil, errors.New("trailing data after the certificates")
+	}
+	return certs, nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+const testCACert = `-----BEGIN CERTIFICATE-----
+MIIBpTCCAUugAwIBAgIUeZqzcaONHQu/UyRFZjEa5BbpQqgwCgYIKoZIzj0EAwIw
+JzETMBEGA1UEAwwKQ2x1c3RlciBDQTEQMA4GA1UECgwHRXhhbXBsZTAgFw0yNjEw
+MTkxNzQ2MTZaGA8yMTI2MDkyNTE3NDYxNlowJzETMBEGA1UEAwwKQ2x1c3RlciBD
+QTEQMA4GA1UECgwHRXhhbXBsZTBZMBMGByqGSM49AgEGCCqGSM49AwEHA0IABAhC
+HKUBv8+gHoH3z6FF1ILPKVmjCgdxmA/fx44lEoL4ocb+gAzW60ZtnQ11iw0vX5ZC
+kz1JY78pZuA6ND99hPSjUzBRMB0GA1UdDgQWBBR9h21udVgMEXHy9k36hf9D5bIr
+5TAfBgNVHSMEGDAWgBR9h21udVgMEXHy9k36hf9D5bIr5TAPBgNVHRMBAf8EBTAD
+AQH/MAoGCCqGSM49BAMCA0gAMEUCIFoNQSjzubww+hEyaAk+yiMMG1bE9VvuW+cx
+27MuzZNFAiEApK3cOa7t0EUyS4erJK4Laq2rSv4NIDF4cTvbNiD+EMw=
+-----END CERTIFICATE-----
+`
+
+func TestParseCertificates(t *testing.T) {
+	for _, tt := range []struct {
+		data  string
+		count int
+		err   string
+	}{
+		{testCACert, 1, ""},
+		{testCACert + testCACert, 2, ""},
+		{"", 0, "no PEM encoded certificate given"},
+		{testCACert + "junk", 0, "trailing data after the certificates"},
+		{"-----BEGIN PUBLIC KEY-----\nMAA=\n-----END PUBLIC KEY-----\n", 0, `PEM block of type "PUBLIC KEY" given instead of a certificate`},
+		{"-----BEGIN CERTIFICATE-----\nMAA=\n-----END CERTIFICATE-----\n", 0, "invalid certificate: "},
+	} {
+		certs, err := ParseCertificates(tt.data)
+		if tt.err == "" && err != nil {
+			t.Errorf("Unexpected error (%q): %v", tt.data, err)
+		} else if tt.err != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.err)) {
+			t.Errorf("bad error (%q): want %q, got %v", tt.data, tt.err, err)
+		}
+		if len(certs) != tt.count {
+			t.Errorf("bad certificates (%q): want %d, got %d", tt.data, tt.count, len(certs))
+		}
+	}
+	if certs, _ := ParseCertificates(testCACert); certs[0].Subject.CommonName != "Cluster CA" {
+		t.Errorf("bad subject: %v", certs[0].Subject)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ChPasswd sets the passwords of existing users in bulk.
+type ChPasswd struct {
+	List   ChPasswdList `yaml:"list,omitempty"`
+	Expire bool         `yaml:"expire,omitempty"`
+}
+
+// ChPasswdList holds entries of the form "user:password", where the
+// password is either a crypt(3) hash, plain text, or RANDOM. In YAML it is
+// given as a list or as a string with one entry per line.
+type ChPasswdList []string
+
+// SetYAML implements yaml.Setter.
+func (l *ChPasswdList) SetYAML(tag string, value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		var entries ChPasswdList
+		for _, line := range strings.Split(v, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				entries = append(entries, line)
+			}
+		}
+		*l = entries
+	case []interface{}:
+		entries := make(ChPasswdList, 0, len(v))
+		for _, entry := range v {
+			entries = append(entries, fmt.Sprintf("%v", entry))
+		}
+		*l = entries
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coreos/yaml"
+)
+
+// Command is a single command to be run on the system. In YAML it is either
+// a string, which is run by the shell, a list, which is run directly as an
+// argument vector, or a mapping with additional options.
+type Command struct {
+	Shell          string            `yaml:"shell,omitempty"`
+	Args           []string          `yaml:"args,omitempty"`
+	Timeout        int               `yaml:"timeout,omitempty"`
+	Environment    map[string]string `yaml:"environment,omitempty"`
+	AbortOnFailure bool              `yaml:"abort_on_failure,omitempty"`
+}
+
+// command has the same fields as Command without its custom (un)marshalling.
+type command Command
+
+// SetYAML implements yaml.Setter.
+func (c *Command) SetYAML(tag string, value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		*c = Command{Shell: v}
+		return true
+	case []interface{}:
+		args := make([]string, 0, len(v))
+		for _, arg := range v {
+			args = append(args, fmt.Sprintf("%v", arg))
+		}
+		*c = Command{Args: args}
+		return true
+	case map[interface{}]interface{}:
+		raw, err := yaml.Marshal(v)
+		if err != nil {
+			return false
+		}
+		var cmd command
+		if err := yaml.Unmarshal(raw, &cmd); err != nil {
+			return false
+		}
+		*c = Command(cmd)
+		return true
+	default:
+		return false
+	}
+}
+
+// GetYAML implements yaml.Getter. Commands without options are marshalled
+// back into their short string or list form.
+func (c Command) GetYAML() (tag string, value interface{}) {
+	if c.Timeout == 0 && len(c.Environment) == 0 && !c.AbortOnFailure {
+		if len(c.Args) == 0 {
+			return "", c.Shell
+		}
+		if c.Shell == "" {
+			return "", c.Args
+		}
+	}
+	return "", command(c)
+}
+
+// String returns a human-readable representation of the command.
+func (c Command) String() string {
+	if len(c.Args) > 0 {
+		return strings.Join(c.Args, " ")
+	}
+	return c.Shell
+}
@@ -28,11 +28,39 @@ import (
 // directly to YAML. Fields that cannot be set in the cloud-config (fields
 // used for internal use) have the YAML tag '-' so that they aren't marshalled.
 type CloudConfig struct {
-	SSHAuthorizedKeys []string `yaml:"ssh_authorized_keys,omitempty"`
-	WriteFiles        []File   `yaml:"write_files,omitempty"`
-	Hostname          string   `yaml:"hostname,omitempty"`
-	Users             []User   `yaml:"users,omitempty"`
-	RunCmd            []string `yaml:"runcmd,omitempty"`
+	SSHAuthorizedKeys       []string          `yaml:"ssh_authorized_keys,omitempty"`
+	SSHPwAuth               *bool             `yaml:"ssh_pwauth,omitempty"`
+	DisableRoot             bool              `yaml:"disable_root,omitempty"`
+	DisableRootOpts         string            `yaml:"disable_root_opts,omitempty"`
+	SSHDConfig              map[string]string `yaml:"sshd_config,omitempty"`
+	SSHKeys                 *SSHHostKeys      `yaml:"ssh_keys,omitempty"`
+	SSHDeleteKeys           bool              `yaml:"ssh_deletekeys,omitempty"`
+	SSHGenKeyTypes          *[]string         `yaml:"ssh_genkeytypes,omitempty"`
+	BootCmd                 []Command         `yaml:"bootcmd,omitempty"`
+	KernelModules           []KernelModule    `yaml:"kernel_modules,omitempty"`
+	Sysctl                  map[string]string `yaml:"sysctl,omitempty"`
+	WriteFiles              []File            `yaml:"write_files,omitempty"`
+	Mounts                  []Mount           `yaml:"mounts,omitempty"`
+	Swap                    *Swap             `yaml:"swap,omitempty"`
+	CACerts                 *CACerts          `yaml:"ca_certs,omitempty"`
+	Hostname                string            `yaml:"hostname,omitempty"`
+	FQDN                    string            `yaml:"fqdn,omitempty"`
+	PreserveHostname        bool              `yaml:"preserve_hostname,omitempty"`
+	PreferFQDNOverHostname  bool              `yaml:"prefer_fqdn_over_hostname,omitempty"`
+	ManageEtcHosts          EtcHosts          `yaml:"manage_etc_hosts,omitempty" valid:"^(true|false|localhost|template)$"`
+	ResolvConf              *ResolvConf       `yaml:"resolv_conf,omitempty"`
+	Timezone                string            `yaml:"timezone,omitempty" valid:"^[A-Za-z0-9_+-]+(/[A-Za-z0-9_+-]+)*$"`
+	NTP                     *NTP              `yaml:"ntp,omitempty"`
+	Groups                  []Group           `yaml:"groups,omitempty"`
+	Users                   []User            `yaml:"users,omitempty"`
+	ChPasswd                *ChPasswd         `yaml:"chpasswd,omitempty"`
+	APKRepos                *APKRepos         `yaml:"apk_repos,omitempty"`
+	Packages                []Package         `yaml:"packages,omitempty"`
+	PackageUpdate           bool              `yaml:"package_update,omitempty"`
+	PackageUpgrade          bool              `yaml:"package_upgrade,omitempty"`
+	PackageRebootIfRequired bool              `yaml:"package_reboot_if_required,omitempty"`
+	RunCmd                  []Command         `yaml:"runcmd,omitempty"`
+	PowerState              *PowerState       `yaml:"power_state,omitempty"`
 	// this one is legacy, can be removed when no more kip controllers use it
 	MilpaFiles []File `yaml:"milpa_files,omitempty"`
 	// Todo: add additional parameters supported by traditional cloud-init
@@ -51,15 +79,23 @@ func IsCloudConfig(userdata string) bool {
 // string of YAML), returning any error encountered. It will ignore unknown
 // fields but log encountering them.
 func NewCloudConfig(contents string) (*CloudConfig, error) {
-	yaml.UnmarshalMappingKeyTransform = func(nameIn string) (nameOut string) {
-		return strings.Replace(nameIn, "-", "_", -1)
-	}
+	yaml.UnmarshalMappingKeyTransform = NormalizeKey
 	var cfg CloudConfig
 	err := yaml.Unmarshal([]byte(contents), &cfg)
 	//fmt.Printf("%+v\n", cfg)
 	return &cfg, err
 }
 
+// NormalizeKey allows keys to use '-' in place of '_'. Keys with dots or
+// slashes name kernel parameters (e.g. net.bridge.bridge-nf-call-iptables)
+// rather than fields, and are left as they are.
+func NormalizeKey(name string) string {
+	if strings.ContainsAny(name, "./") {
+		return name
+	}
+	return strings.Replace(name, "-", "_", -1)
+}
+
 // Decode decodes the content of cloud config. Currently only WriteFiles section
 // supports several types of encoding and all of them are supported. After
 // decode operation, Encoding type is unset.
@@ -152,6 +188,10 @@ func isZero(v reflect.Value) bool {
 			}
 		}
 		return true
+	case reflect.Map, reflect.Slice:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
 	default:
 		return v.Interface() == reflect.Zero(v.Type()).Interface()
 	}
@@ -14,4 +14,7 @@
 
 package config
 
+// EtcHosts is how /etc/hosts is managed: not at all if empty or false, with
+// the names of the host resolving to a loopback address if localhost, or
+// from a template if true or template.
 type EtcHosts string
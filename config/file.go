@@ -15,9 +15,18 @@
 package config
 
 type File struct {
-	Encoding           string `yaml:"encoding,omitempty" valid:"^(base64|b64|gz|gzip|gz\\+base64|gzip\\+base64|gz\\+b64|gzip\\+b64)$"`
-	Content            string `yaml:"content,omitempty"`
-	Owner              string `yaml:"owner,omitempty"`
-	Path               string `yaml:"path,omitempty"`
-	RawFilePermissions string `yaml:"permissions,omitempty" valid:"^0?[0-7]{3,4}$"`
+	Encoding           string      `yaml:"encoding,omitempty" valid:"^(base64|b64|gz|gzip|gz\\+base64|gzip\\+base64|gz\\+b64|gzip\\+b64)$"`
+	Content            string      `yaml:"content,omitempty"`
+	Owner              string      `yaml:"owner,omitempty"`
+	Path               string      `yaml:"path,omitempty"`
+	RawFilePermissions string      `yaml:"permissions,omitempty" valid:"^0?[0-7]{3,4}$"`
+	Source             *FileSource `yaml:"source,omitempty"`
+}
+
+// FileSource describes remote content for a File. When URI is set, the
+// content is fetched from it instead of being taken from Content.
+type FileSource struct {
+	URI     string            `yaml:"uri,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+	SHA256  string            `yaml:"sha256,omitempty" valid:"^[0-9a-fA-F]{64}$"`
 }
@@ -0,0 +1,91 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+
+	"github.com/coreos/yaml"
+)
+
+// Group is a group to be created on the system. In YAML it is either the name
+// of the group, a mapping from the name to a list of members, or a mapping
+// with all of the fields below.
+type Group struct {
+	Name    string   `yaml:"name,omitempty"`
+	Gid     int      `yaml:"gid,omitempty"`
+	System  bool     `yaml:"system,omitempty"`
+	Members []string `yaml:"members,omitempty"`
+}
+
+// group has the same fields as Group without its custom (un)marshalling.
+type group Group
+
+// SetYAML implements yaml.Setter.
+func (g *Group) SetYAML(tag string, value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		*g = Group{Name: v}
+		return true
+	case map[interface{}]interface{}:
+		if _, ok := v["name"]; !ok && len(v) == 1 {
+			for name, members := range v {
+				return g.setMembers(fmt.Sprintf("%v", name), members)
+			}
+		}
+		raw, err := yaml.Marshal(v)
+		if err != nil {
+			return false
+		}
+		var grp group
+		if err := yaml.Unmarshal(raw, &grp); err != nil {
+			return false
+		}
+		*g = Group(grp)
+		return true
+	default:
+		return false
+	}
+}
+
+// setMembers sets the group from its short "name: [members]" form. A single
+// member may be given as a string rather than a list.
+func (g *Group) setMembers(name string, value interface{}) bool {
+	*g = Group{Name: name}
+	switch v := value.(type) {
+	case nil:
+	case string:
+		g.Members = []string{v}
+	case []interface{}:
+		for _, m := range v {
+			g.Members = append(g.Members, fmt.Sprintf("%v", m))
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// GetYAML implements yaml.Getter. Groups without a gid or the system flag are
+// marshalled back into their short form.
+func (g Group) GetYAML() (tag string, value interface{}) {
+	if g.Gid == 0 && !g.System {
+		if len(g.Members) == 0 {
+			return "", g.Name
+		}
+		return "", map[string][]string{g.Name: g.Members}
+	}
+	return "", group(g)
+}
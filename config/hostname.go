@@ -0,0 +1,72 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var hostnameLabel = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+
+// SplitHostname splits a host name into its short name, the first label,
+// and its domain.
+func SplitHostname(name string) (short, domain string) {
+	parts := strings.SplitN(strings.TrimSuffix(name, "."), ".", 2)
+	if len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return parts[0], ""
+}
+
+// AssertHostnameValid checks that the short name and the domain of a host
+// name are made of valid labels (see RFC 1123) and that it is not too long.
+func AssertHostnameValid(name string) error {
+	if len(strings.TrimSuffix(name, ".")) > 253 {
+		return fmt.Errorf("host name %q is longer than 253 characters", name)
+	}
+	short, domain := SplitHostname(name)
+	if !hostnameLabel.MatchString(short) {
+		return fmt.Errorf("invalid short name %q in host name %q", short, name)
+	}
+	if domain == "" {
+		return nil
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if !hostnameLabel.MatchString(label) {
+			return fmt.Errorf("invalid domain %q in host name %q", domain, name)
+		}
+	}
+	return nil
+}
+
+// HostnameFQDN returns the host name to set and the fully qualified domain
+// name of the host. The FQDN is fqdn if given and otherwise hostname, whose
+// short name is used as the host name unless prefer_fqdn_over_hostname is
+// set.
+func (cc CloudConfig) HostnameFQDN() (hostname, fqdn string) {
+	hostname, fqdn = cc.Hostname, cc.FQDN
+	if fqdn == "" {
+		fqdn = hostname
+	}
+	if hostname == "" || strings.Contains(hostname, ".") {
+		hostname, _ = SplitHostname(fqdn)
+	}
+	if cc.PreferFQDNOverHostname {
+		hostname = fqdn
+	}
+	return hostname, strings.TrimSuffix(fqdn, ".")
+}
@@ -0,0 +1,83 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAssertHostnameValid(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		valid bool
+	}{
+		{"core", true},
+		{"core-1.example.com", true},
+		{"core.example.com.", true},
+		{"", false},
+		{"-core", false},
+		{"core_1", false},
+		{"core..example.com", false},
+		{"core.exa mple.com", false},
+		{strings.Repeat("a", 64), false},
+		{"core." + strings.Repeat("a.", 125) + "com", false},
+	} {
+		if err := AssertHostnameValid(tt.name); (err == nil) != tt.valid {
+			t.Errorf("bad validity (%q): want %t, got %v", tt.name, tt.valid, err)
+		}
+	}
+}
+
+func TestHostnameFQDN(t *testing.T) {
+	for _, tt := range []struct {
+		cc CloudConfig
+
+		hostname string
+		fqdn     string
+	}{
+		{},
+		{
+			cc:       CloudConfig{Hostname: "core"},
+			hostname: "core",
+			fqdn:     "core",
+		},
+		{
+			cc:       CloudConfig{Hostname: "core.example.com"},
+			hostname: "core",
+			fqdn:     "core.example.com",
+		},
+		{
+			cc:       CloudConfig{FQDN: "core.example.com."},
+			hostname: "core",
+			fqdn:     "core.example.com",
+		},
+		{
+			cc:       CloudConfig{Hostname: "node", FQDN: "core.example.com"},
+			hostname: "node",
+			fqdn:     "core.example.com",
+		},
+		{
+			cc:       CloudConfig{Hostname: "core", FQDN: "core.example.com", PreferFQDNOverHostname: true},
+			hostname: "core.example.com",
+			fqdn:     "core.example.com",
+		},
+	} {
+		hostname, fqdn := tt.cc.HostnameFQDN()
+		if hostname != tt.hostname || fqdn != tt.fqdn {
+			t.Errorf("bad hostname (%+v): want %q, %q, got %q, %q", tt.cc, tt.hostname, tt.fqdn, hostname, fqdn)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/coreos/yaml"
+)
+
+// KernelModule is a kernel module to load. In YAML it is either the name of
+// the module or a mapping with the parameters to load it with.
+type KernelModule struct {
+	Name       string            `yaml:"name,omitempty" valid:"^[A-Za-z0-9_-]+$"`
+	Parameters map[string]string `yaml:"parameters,omitempty"`
+}
+
+// kernelModule has the same fields as KernelModule without its custom
+// (un)marshalling.
+type kernelModule KernelModule
+
+// SetYAML implements yaml.Setter.
+func (m *KernelModule) SetYAML(tag string, value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		*m = KernelModule{Name: v}
+		return true
+	case map[interface{}]interface{}:
+		raw, err := yaml.Marshal(v)
+		if err != nil {
+			return false
+		}
+		var out kernelModule
+		if err := yaml.Unmarshal(raw, &out); err != nil {
+			return false
+		}
+		*m = KernelModule(out)
+		return true
+	default:
+		return false
+	}
+}
+
+// GetYAML implements yaml.Getter. Modules without parameters are marshalled
+// back into their name.
+func (m KernelModule) GetYAML() (tag string, value interface{}) {
+	if len(m.Parameters) == 0 {
+		return "", m.Name
+	}
+	return "", kernelModule(m)
+}
+
+// Params returns the parameters of the module in the form "key=value",
+// sorted by key.
+func (m KernelModule) Params() []string {
+	keys := make([]string, 0, len(m.Parameters))
+	for k := range m.Parameters {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	params := make([]string, 0, len(keys))
+	for _, k := range keys {
+		params = append(params, fmt.Sprintf("%s=%s", k, m.Parameters[k]))
+	}
+	return params
+}
@@ -0,0 +1,64 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCloudConfigKernelModules(t *testing.T) {
+	contents := `
+kernel_modules:
+  - br_netfilter
+  - name: bonding
+    parameters:
+      mode: 4
+      miimon: 100
+sysctl:
+  net.ipv4.ip_forward: 1
+  net.bridge.bridge-nf-call-iptables: 1
+  kernel.panic: 10
+`
+	cfg, err := NewCloudConfig(contents)
+	if err != nil {
+		t.Fatalf("Encountered unexpected error: %v", err)
+	}
+
+	expected := []KernelModule{
+		{Name: "br_netfilter"},
+		{Name: "bonding", Parameters: map[string]string{"mode": "4", "miimon": "100"}},
+	}
+	sysctl := map[string]string{
+		"net.ipv4.ip_forward":                "1",
+		"net.bridge.bridge-nf-call-iptables": "1",
+		"kernel.panic":                       "10",
+	}
+	for i := 0; i < 2; i++ {
+		if !reflect.DeepEqual(expected, cfg.KernelModules) {
+			t.Fatalf("bad kernel modules (%d): want %#v, got %#v", i, expected, cfg.KernelModules)
+		}
+		if !reflect.DeepEqual(sysctl, cfg.Sysctl) {
+			t.Fatalf("bad sysctl (%d): want %#v, got %#v", i, sysctl, cfg.Sysctl)
+		}
+		if cfg, err = NewCloudConfig(cfg.String()); err != nil {
+			t.Fatalf("Encountered unexpected error: %v", err)
+		}
+	}
+
+	if params := []string{"miimon=100", "mode=4"}; !reflect.DeepEqual(params, cfg.KernelModules[1].Params()) {
+		t.Errorf("bad parameters: want %v, got %v", params, cfg.KernelModules[1].Params())
+	}
+}
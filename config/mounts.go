@@ -0,0 +1,116 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultMountFields are the fields of /etc/fstab taken for those a mount
+// leaves out, after its device and mount point.
+var DefaultMountFields = []string{"auto", "defaults,nofail", "0", "2"}
+
+// Mount is an entry of /etc/fstab. In YAML it is a list of the fields of
+// the entry: the device, the mount point, the filesystem type, the mount
+// options, the dump frequency and the fsck pass number. Fields left out
+// default to DefaultMountFields. A mount without a mount point removes the
+// entries of the device instead.
+type Mount struct {
+	Device     string
+	MountPoint string
+	Type       string
+	Options    string
+	Freq       string
+	Passno     string
+}
+
+// SetYAML implements yaml.Setter.
+func (m *Mount) SetYAML(tag string, value interface{}) bool {
+	v, ok := value.([]interface{})
+	if !ok || len(v) == 0 || len(v) > 6 {
+		return false
+	}
+	fields := make([]string, 6)
+	for i, f := range v {
+		if f != nil {
+			fields[i] = fmt.Sprintf("%v", f)
+		}
+	}
+	*m = Mount{fields[0], fields[1], fields[2], fields[3], fields[4], fields[5]}
+	return true
+}
+
+// GetYAML implements yaml.Getter.
+func (m Mount) GetYAML() (tag string, value interface{}) {
+	fields := []string{m.Device, m.MountPoint, m.Type, m.Options, m.Freq, m.Passno}
+	for len(fields) > 1 && fields[len(fields)-1] == "" {
+		fields = fields[:len(fields)-1]
+	}
+	return "", fields
+}
+
+// Removes determines if the mount removes the entries of its device.
+func (m Mount) Removes() bool {
+	return m.MountPoint == ""
+}
+
+// DevicePath returns the device of the mount, with short names of block
+// devices such as sdb expanded to their path under /dev.
+func (m Mount) DevicePath() string {
+	if m.Device == "" || strings.ContainsAny(m.Device, "/=:") {
+		return m.Device
+	}
+	return "/dev/" + m.Device
+}
+
+// Fields returns the fields of the entry of the mount in /etc/fstab, with
+// the defaults for those left out.
+func (m Mount) Fields() []string {
+	fields := []string{m.DevicePath(), m.MountPoint, m.Type, m.Options, m.Freq, m.Passno}
+	for i, f := range fields[2:] {
+		if f == "" {
+			fields[i+2] = DefaultMountFields[i]
+		}
+	}
+	return fields
+}
+
+// Swap is a swap file to create and activate. Its size is either a number
+// of bytes, optionally with a K, M, G or T suffix, or auto to size it after
+// the memory of the host, up to maxsize.
+type Swap struct {
+	Filename string `yaml:"filename,omitempty"`
+	Size     string `yaml:"size,omitempty" valid:"^(auto|[0-9]+[KMGT]?)$"`
+	MaxSize  string `yaml:"maxsize,omitempty" valid:"^[0-9]+[KMGT]?$"`
+}
+
+// ParseSize parses a size of Swap into a number of bytes. A missing size
+// is 0, which means no swap file.
+func ParseSize(size string) (int64, error) {
+	if size == "" {
+		return 0, nil
+	}
+	var n int64
+	var unit string
+	if c, err := fmt.Sscanf(size, "%d%s", &n, &unit); c == 0 {
+		return 0, fmt.Errorf("invalid size %q: %v", size, err)
+	}
+	shift, ok := map[string]uint{"": 0, "K": 10, "M": 20, "G": 30, "T": 40}[unit]
+	if !ok || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	return n << shift, nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCloudConfigMounts(t *testing.T) {
+	contents := `
+mounts:
+  - [sdb, /var/lib/itzo]
+  - [LABEL=data, /data, ext4, "defaults,noatime", 0, 2]
+  - [sdc, null]
+swap:
+  filename: /swap.img
+  size: auto
+  maxsize: 2G
+`
+	cfg, err := NewCloudConfig(contents)
+	if err != nil {
+		t.Fatalf("Encountered unexpected error: %v", err)
+	}
+
+	expected := []Mount{
+		{Device: "sdb", MountPoint: "/var/lib/itzo"},
+		{"LABEL=data", "/data", "ext4", "defaults,noatime", "0", "2"},
+		{Device: "sdc"},
+	}
+	if !reflect.DeepEqual(expected, cfg.Mounts) {
+		t.Fatalf("bad mounts: want %#v, got %#v", expected, cfg.Mounts)
+	}
+	if swap := (&Swap{"/swap.img", "auto", "2G"}); !reflect.DeepEqual(swap, cfg.Swap) {
+		t.Fatalf("bad swap: want %#v, got %#v", swap, cfg.Swap)
+	}
+
+	cfg, err = NewCloudConfig(cfg.String())
+	if err != nil {
+		t.Fatalf("Encountered unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(expected, cfg.Mounts) {
+		t.Fatalf("bad mounts after serialization: want %#v, got %#v", expected, cfg.Mounts)
+	}
+}
+
+func TestMountFields(t *testing.T) {
+	for _, tt := range []struct {
+		mount   Mount
+		fields  []string
+		removes bool
+	}{
+		{Mount{Device: "sdb", MountPoint: "/mnt"}, []string{"/dev/sdb", "/mnt", "auto", "defaults,nofail", "0", "2"}, false},
+		{Mount{Device: "UUID=1234", MountPoint: "/mnt", Type: "xfs"}, []string{"UUID=1234", "/mnt", "xfs", "defaults,nofail", "0", "2"}, false},
+		{Mount{Device: "nfs:/export", MountPoint: "/mnt", Type: "nfs", Options: "ro", Freq: "0", Passno: "0"}, []string{"nfs:/export", "/mnt", "nfs", "ro", "0", "0"}, false},
+		{Mount{Device: "sdc"}, []string{"/dev/sdc", "", "auto", "defaults,nofail", "0", "2"}, true},
+	} {
+		if fields := tt.mount.Fields(); !reflect.DeepEqual(tt.fields, fields) {
+			t.Errorf("bad fields (%+v): want %v, got %v", tt.mount, tt.fields, fields)
+		}
+		if removes := tt.mount.Removes(); removes != tt.removes {
+			t.Errorf("bad removal (%+v): want %t, got %t", tt.mount, tt.removes, removes)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for _, tt := range []struct {
+		size  string
+		bytes int64
+		err   bool
+	}{
+		{"", 0, false},
+		{"1024", 1024, false},
+		{"512K", 512 << 10, false},
+		{"2G", 2 << 30, false},
+		{"1T", 1 << 40, false},
+		{"auto", 0, true},
+		{"2X", 0, true},
+		{"-1", 0, true},
+	} {
+		bytes, err := ParseSize(tt.size)
+		if (err != nil) != tt.err || bytes != tt.bytes {
+			t.Errorf("bad size (%q): want %d, error %t, got %d, %v", tt.size, tt.bytes, tt.err, bytes, err)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// NTP configures the NTP client of the host to synchronize the clock with
+// the given servers and pools. The client is detected unless one is chosen.
+type NTP struct {
+	Servers   []string `yaml:"servers,omitempty"`
+	Pools     []string `yaml:"pools,omitempty"`
+	NTPClient string   `yaml:"ntp_client,omitempty" valid:"^(auto|chrony|ntpd|busybox|systemd-timesyncd)$"`
+}
@@ -0,0 +1,90 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+
+	"github.com/coreos/yaml"
+)
+
+// Package is a package to install. In YAML it is either the name of the
+// package, a list of its name and version, or a mapping.
+type Package struct {
+	Name    string `yaml:"name,omitempty"`
+	Version string `yaml:"version,omitempty"`
+	// Invalid tells why the package as given can not be installed. It is
+	// kept rather than dropped for its failure to be reported.
+	Invalid string `yaml:"-"`
+}
+
+// pkg has the same fields as Package without its custom (un)marshalling.
+type pkg Package
+
+// SetYAML implements yaml.Setter.
+func (p *Package) SetYAML(tag string, value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		*p = Package{Name: v}
+		return true
+	case []interface{}:
+		// Unquoted versions such as 20.10 are decoded as numbers, which
+		// lose their text (20.1), so the name and version must be strings.
+		if len(v) == 0 || len(v) > 2 {
+			return false
+		}
+		*p = Package{Name: fmt.Sprint(v[0])}
+		if len(v) == 2 {
+			p.Version = fmt.Sprint(v[1])
+		}
+		for _, f := range v {
+			if _, ok := f.(string); !ok {
+				p.Invalid = fmt.Sprintf("package name or version %v is not a string (quote it)", f)
+				break
+			}
+		}
+		return true
+	case map[interface{}]interface{}:
+		raw, err := yaml.Marshal(v)
+		if err != nil {
+			return false
+		}
+		var out pkg
+		if err := yaml.Unmarshal(raw, &out); err != nil {
+			return false
+		}
+		*p = Package(out)
+		return true
+	default:
+		return false
+	}
+}
+
+// GetYAML implements yaml.Getter. Packages are marshalled back into their
+// short string or list form.
+func (p Package) GetYAML() (tag string, value interface{}) {
+	if p.Version == "" {
+		return "", p.Name
+	}
+	return "", []string{p.Name, p.Version}
+}
+
+// String returns the name of the package, followed by its version if any.
+func (p Package) String() string {
+	if p.Version == "" {
+		return p.Name
+	}
+	return p.Name + "=" + p.Version
+}
@@ -0,0 +1,79 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPowerStateTimeout is the number of seconds the condition of
+// power_state is given to run when it does not set a timeout itself.
+const DefaultPowerStateTimeout = 30
+
+// PowerState reboots, powers off or halts the system once everything else
+// has been applied. Delay is "now" or a number of minutes, optionally
+// prefixed with "+". The power state is only changed if Condition holds,
+// which it does when it is not given.
+type PowerState struct {
+	Mode      string          `yaml:"mode,omitempty" valid:"^(reboot|poweroff|halt)$"`
+	Delay     string          `yaml:"delay,omitempty" valid:"^(now|\\+?[0-9]+)$"`
+	Message   string          `yaml:"message,omitempty"`
+	Timeout   int             `yaml:"timeout,omitempty"`
+	Condition *PowerCondition `yaml:"condition,omitempty"`
+}
+
+// DelayDuration returns the delay of the power state.
+func (p PowerState) DelayDuration() (time.Duration, error) {
+	if p.Delay == "" || p.Delay == "now" {
+		return 0, nil
+	}
+	minutes, err := strconv.Atoi(strings.TrimPrefix(p.Delay, "+"))
+	if err != nil || minutes < 0 {
+		return 0, fmt.Errorf("invalid delay %q", p.Delay)
+	}
+	return time.Duration(minutes) * time.Minute, nil
+}
+
+// PowerCondition decides whether the power state is changed. In YAML it is
+// either a boolean or a Command, which holds if it exits successfully.
+type PowerCondition struct {
+	Value   bool
+	Command *Command
+}
+
+// SetYAML implements yaml.Setter.
+func (c *PowerCondition) SetYAML(tag string, value interface{}) bool {
+	if v, ok := value.(bool); ok {
+		*c = PowerCondition{Value: v}
+		return true
+	}
+	var cmd Command
+	if !cmd.SetYAML(tag, value) {
+		return false
+	}
+	*c = PowerCondition{Command: &cmd}
+	return true
+}
+
+// GetYAML implements yaml.Getter.
+func (c PowerCondition) GetYAML() (tag string, value interface{}) {
+	if c.Command != nil {
+		return c.Command.GetYAML()
+	}
+	return "", c.Value
+}
@@ -0,0 +1,74 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCloudConfigPowerState(t *testing.T) {
+	for _, tt := range []struct {
+		contents  string
+		condition *PowerCondition
+	}{
+		{"power_state:\n  mode: reboot\n", nil},
+		{"power_state:\n  mode: reboot\n  condition: false\n", &PowerCondition{Value: false}},
+		{"power_state:\n  mode: reboot\n  condition: true\n", &PowerCondition{Value: true}},
+		{"power_state:\n  mode: reboot\n  condition: test -f /run/reboot\n", &PowerCondition{Command: &Command{Shell: "test -f /run/reboot"}}},
+		{"power_state:\n  mode: reboot\n  condition: [test, -f, /run/reboot]\n", &PowerCondition{Command: &Command{Args: []string{"test", "-f", "/run/reboot"}}}},
+		{"power_state:\n  mode: reboot\n  condition:\n    shell: test -f /run/reboot\n    timeout: 5\n", &PowerCondition{Command: &Command{Shell: "test -f /run/reboot", Timeout: 5}}},
+	} {
+		cfg, err := NewCloudConfig(tt.contents)
+		if err != nil {
+			t.Fatalf("Encountered unexpected error: %v", err)
+		}
+		if cfg.PowerState == nil || cfg.PowerState.Mode != "reboot" {
+			t.Fatalf("bad power state (%q): got %#v", tt.contents, cfg.PowerState)
+		}
+		if !reflect.DeepEqual(tt.condition, cfg.PowerState.Condition) {
+			t.Errorf("bad condition (%q): want %#v, got %#v", tt.contents, tt.condition, cfg.PowerState.Condition)
+		}
+
+		cfg, err = NewCloudConfig(cfg.String())
+		if err != nil {
+			t.Fatalf("Encountered unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(tt.condition, cfg.PowerState.Condition) {
+			t.Errorf("bad condition after serialization (%q): want %#v, got %#v", tt.contents, tt.condition, cfg.PowerState.Condition)
+		}
+	}
+}
+
+func TestPowerStateDelay(t *testing.T) {
+	for _, tt := range []struct {
+		delay    string
+		duration time.Duration
+		err      bool
+	}{
+		{"", 0, false},
+		{"now", 0, false},
+		{"+5", 5 * time.Minute, false},
+		{"30", 30 * time.Minute, false},
+		{"soon", 0, true},
+		{"+-1", 0, true},
+	} {
+		duration, err := PowerState{Delay: tt.delay}.DelayDuration()
+		if (err != nil) != tt.err || duration != tt.duration {
+			t.Errorf("bad delay (%q): want %v, error %t, got %v, %v", tt.delay, tt.duration, tt.err, duration, err)
+		}
+	}
+}
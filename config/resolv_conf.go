@@ -0,0 +1,30 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// ResolvConf is the DNS resolver configuration of the host. Options given
+// as true are written as flags, options given as false are left out and
+// the others are written as option:value.
+type ResolvConf struct {
+	Nameservers   []string          `yaml:"nameservers,omitempty"`
+	SearchDomains []string          `yaml:"searchdomains,omitempty"`
+	Domain        string            `yaml:"domain,omitempty"`
+	Options       map[string]string `yaml:"options,omitempty"`
+	Sortlist      []string          `yaml:"sortlist,omitempty"`
+}
+
+// MaxNameservers is the number of nameservers the resolver uses; any more
+// are ignored.
+const MaxNameservers = 3
@@ -0,0 +1,41 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// SSHHostKeys are SSH host keys to install instead of generating them. Each
+// private key needs its public key to be given as well.
+type SSHHostKeys struct {
+	RSAPrivate     string `yaml:"rsa_private,omitempty"`
+	RSAPublic      string `yaml:"rsa_public,omitempty"`
+	ECDSAPrivate   string `yaml:"ecdsa_private,omitempty"`
+	ECDSAPublic    string `yaml:"ecdsa_public,omitempty"`
+	ED25519Private string `yaml:"ed25519_private,omitempty"`
+	ED25519Public  string `yaml:"ed25519_public,omitempty"`
+}
+
+// Pairs returns the private and public keys given for each key type.
+func (k SSHHostKeys) Pairs() map[string][2]string {
+	pairs := map[string][2]string{}
+	for typ, pair := range map[string][2]string{
+		"rsa":     {k.RSAPrivate, k.RSAPublic},
+		"ecdsa":   {k.ECDSAPrivate, k.ECDSAPublic},
+		"ed25519": {k.ED25519Private, k.ED25519Public},
+	} {
+		if pair[0] != "" || pair[1] != "" {
+			pairs[typ] = pair
+		}
+	}
+	return pairs
+}
@@ -0,0 +1,198 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// sshKeyFields are the number of fields following the key type in the SSH
+// wire format of each plain public key type.
+var sshKeyFields = map[string]int{
+	"ssh-rsa":                            2,
+	"ssh-dss":                            4,
+	"ssh-ed25519":                        1,
+	"ecdsa-sha2-nistp256":                2,
+	"ecdsa-sha2-nistp384":                2,
+	"ecdsa-sha2-nistp521":                2,
+	"sk-ssh-ed25519@openssh.com":         2,
+	"sk-ecdsa-sha2-nistp256@openssh.com": 3,
+}
+
+// SSHKey is a public key as given on a line of authorized_keys (see the
+// AUTHORIZED_KEYS FILE FORMAT section of sshd(8)).
+type SSHKey struct {
+	Options string
+	Type    string
+	Blob    []byte
+	Comment string
+	// Bits is the size of RSA and DSA keys.
+	Bits int
+}
+
+// ParseSSHKey parses an authorized_keys line made of optional options, the
+// key type, the base64 encoded key and an optional comment. The key itself
+// is decoded and checked to be complete and of the given type.
+func ParseSSHKey(line string) (*SSHKey, error) {
+	line = strings.TrimSpace(line)
+	if strings.Contains(line, "PRIVATE KEY") {
+		return nil, fmt.Errorf("private key given instead of a public key")
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, fmt.Errorf("no key given")
+	}
+
+	key := &SSHKey{}
+	if !isSSHKeyType(strings.Fields(line)[0]) {
+		key.Options, line = splitSSHKeyOptions(line)
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 || !isSSHKeyType(fields[0]) {
+		return nil, fmt.Errorf("unknown key type")
+	}
+	key.Type = fields[0]
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("missing %s key data", key.Type)
+	}
+	if len(fields) > 2 {
+		key.Comment = strings.TrimSpace(line[strings.Index(line, fields[1])+len(fields[1]):])
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s key data: %v", key.Type, err)
+	}
+	key.Blob = blob
+	if err := key.checkBlob(); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// checkBlob checks that the key data holds a complete key of the key type,
+// and sets the size of the key.
+func (k *SSHKey) checkBlob() error {
+	typ, rest, ok := readSSHString(k.Blob)
+	if !ok {
+		return fmt.Errorf("truncated %s key data", k.Type)
+	}
+	if string(typ) != k.Type {
+		return fmt.Errorf("key data of type %q given as %s", typ, k.Type)
+	}
+	// Certificates are only checked to be of the right type.
+	if strings.HasSuffix(k.Type, "-cert-v01@openssh.com") {
+		return nil
+	}
+
+	fields := make([][]byte, sshKeyFields[k.Type])
+	for i := range fields {
+		if fields[i], rest, ok = readSSHString(rest); !ok {
+			return fmt.Errorf("truncated %s key data", k.Type)
+		}
+	}
+	if len(rest) != 0 {
+		return fmt.Errorf("trailing data after %s key", k.Type)
+	}
+
+	switch {
+	case k.Type == "ssh-rsa":
+		k.Bits = new(big.Int).SetBytes(fields[1]).BitLen()
+	case k.Type == "ssh-dss":
+		k.Bits = new(big.Int).SetBytes(fields[0]).BitLen()
+	case strings.HasSuffix(k.Type, "ed25519") || strings.HasSuffix(k.Type, "ed25519@openssh.com"):
+		if len(fields[0]) != 32 {
+			return fmt.Errorf("invalid %s key length %d", k.Type, len(fields[0]))
+		}
+	default:
+		curve := strings.TrimSuffix(k.Type[strings.LastIndex(k.Type, "-")+1:], "@openssh.com")
+		if string(fields[0]) != curve {
+			return fmt.Errorf("key data of curve %q given as %s", fields[0], k.Type)
+		}
+	}
+	return nil
+}
+
+// Weakness describes why the key is considered weak, if it is.
+func (k SSHKey) Weakness() string {
+	switch {
+	case k.Type == "ssh-dss":
+		return "ssh-dss keys are deprecated and disabled by recent OpenSSH"
+	case k.Type == "ssh-rsa" && k.Bits < 2048:
+		return fmt.Sprintf("%d-bit RSA keys are too weak (want at least 2048 bits)", k.Bits)
+	}
+	return ""
+}
+
+// Material returns the key type and base64 encoded key, which identify the
+// key regardless of its options and comment.
+func (k SSHKey) Material() string {
+	return fmt.Sprintf("%s %s", k.Type, base64.StdEncoding.EncodeToString(k.Blob))
+}
+
+func (k SSHKey) String() string {
+	s := k.Material()
+	if k.Options != "" {
+		s = k.Options + " " + s
+	}
+	if k.Comment != "" {
+		s += " " + k.Comment
+	}
+	return s
+}
+
+// isSSHKeyType determines if s names a known SSH public key or certificate
+// type.
+func isSSHKeyType(s string) bool {
+	_, ok := sshKeyFields[strings.TrimSuffix(s, "-cert-v01@openssh.com")]
+	if !ok {
+		_, ok = sshKeyFields[strings.Replace(s, "-cert-v01@openssh.com", "@openssh.com", 1)]
+	}
+	return ok
+}
+
+// splitSSHKeyOptions splits the options at the start of an authorized_keys
+// line from the rest of it. Options end at the first whitespace which is not
+// quoted.
+func splitSSHKeyOptions(line string) (options, rest string) {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '\\' && quoted:
+			i++
+		case c == '"':
+			quoted = !quoted
+		case (c == ' ' || c == '\t') && !quoted:
+			return line[:i], strings.TrimSpace(line[i:])
+		}
+	}
+	return line, ""
+}
+
+// readSSHString reads a string of the SSH wire format, its length followed
+// by its bytes, from the start of b.
+func readSSHString(b []byte) (s, rest []byte, ok bool) {
+	if len(b) < 4 {
+		return nil, nil, false
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint32(len(b)-4) < n {
+		return nil, nil, false
+	}
+	return b[4 : 4+n], b[4+n:], true
+}
@@ -0,0 +1,45 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SysctlPath returns the path of the kernel parameter key relative to
+// /proc/sys. Its components are separated by dots, or by slashes if it has
+// any, in which case dots are part of the components (e.g. the name of a
+// VLAN interface).
+func SysctlPath(key string) string {
+	if strings.Contains(key, "/") {
+		return key
+	}
+	return strings.Replace(key, ".", "/", -1)
+}
+
+// AssertSysctlKeyValid checks that key names a kernel parameter under
+// /proc/sys.
+func AssertSysctlKeyValid(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.ContainsAny(key, " \t\n=") {
+		return fmt.Errorf("invalid sysctl key %q", key)
+	}
+	for _, c := range strings.Split(SysctlPath(key), "/") {
+		if c == "" || c == "." || c == ".." {
+			return fmt.Errorf("invalid sysctl key %q", key)
+		}
+	}
+	return nil
+}
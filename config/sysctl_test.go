@@ -0,0 +1,42 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"testing"
+)
+
+func TestSysctlPath(t *testing.T) {
+	for _, tt := range []struct {
+		key   string
+		path  string
+		valid bool
+	}{
+		{"net.ipv4.ip_forward", "net/ipv4/ip_forward", true},
+		{"net/ipv4/conf/eth0.100/forwarding", "net/ipv4/conf/eth0.100/forwarding", true},
+		{"", "", false},
+		{"net.ipv4.", "net/ipv4/", false},
+		{"net/../../etc/passwd", "net/../../etc/passwd", false},
+		{"/proc/sys/kernel/panic", "/proc/sys/kernel/panic", false},
+		{"kernel.panic = 10", "kernel/panic = 10", false},
+	} {
+		if path := SysctlPath(tt.key); path != tt.path {
+			t.Errorf("bad path (%q): want %q, got %q", tt.key, tt.path, path)
+		}
+		if valid := AssertSysctlKeyValid(tt.key) == nil; valid != tt.valid {
+			t.Errorf("bad validity (%q): want %t, got %t", tt.key, tt.valid, valid)
+		}
+	}
+}
@@ -14,20 +14,81 @@
 
 package config
 
+import (
+	"fmt"
+)
+
 type User struct {
-	Name                 string   `yaml:"name,omitempty"`
-	PasswordHash         string   `yaml:"passwd,omitempty"`
-	SSHAuthorizedKeys    []string `yaml:"ssh_authorized_keys,omitempty"`
-	SSHImportGithubUser  string   `yaml:"coreos_ssh_import_github,omitempty"       deprecated:"trying to fetch from a remote endpoint introduces too many intermittent errors"`
-	SSHImportGithubUsers []string `yaml:"coreos_ssh_import_github_users,omitempty" deprecated:"trying to fetch from a remote endpoint introduces too many intermittent errors"`
-	SSHImportURL         string   `yaml:"coreos_ssh_import_url,omitempty"          deprecated:"trying to fetch from a remote endpoint introduces too many intermittent errors"`
-	GECOS                string   `yaml:"gecos,omitempty"`
-	Homedir              string   `yaml:"homedir,omitempty"`
-	NoCreateHome         bool     `yaml:"no_create_home,omitempty"`
-	PrimaryGroup         string   `yaml:"primary_group,omitempty"`
-	Groups               []string `yaml:"groups,omitempty"`
-	NoUserGroup          bool     `yaml:"no_user_group,omitempty"`
-	System               bool     `yaml:"system,omitempty"`
-	NoLogInit            bool     `yaml:"no_log_init,omitempty"`
-	Shell                string   `yaml:"shell,omitempty"`
+	Name                 string    `yaml:"name,omitempty"`
+	Uid                  int       `yaml:"uid,omitempty"`
+	PasswordHash         string    `yaml:"passwd,omitempty"`
+	PlainTextPasswd      string    `yaml:"plain_text_passwd,omitempty"`
+	LockPasswd           *bool     `yaml:"lock_passwd,omitempty"`
+	ExpireDate           string    `yaml:"expiredate,omitempty"                     valid:"^[0-9]{4}-[0-9]{2}-[0-9]{2}$"`
+	Inactive             string    `yaml:"inactive,omitempty"                       valid:"^(-1|[0-9]+)$"`
+	SSHAuthorizedKeys    []string  `yaml:"ssh_authorized_keys,omitempty"`
+	SSHImportID          []string  `yaml:"ssh_import_id,omitempty"`
+	SSHImportGithubUser  string    `yaml:"coreos_ssh_import_github,omitempty"       deprecated:"use ssh_import_id with gh:<user> instead"`
+	SSHImportGithubUsers []string  `yaml:"coreos_ssh_import_github_users,omitempty" deprecated:"use ssh_import_id with gh:<user> instead"`
+	SSHImportURL         string    `yaml:"coreos_ssh_import_url,omitempty"          deprecated:"use ssh_import_id with url:<url> instead"`
+	GECOS                string    `yaml:"gecos,omitempty"`
+	Homedir              string    `yaml:"homedir,omitempty"`
+	NoCreateHome         bool      `yaml:"no_create_home,omitempty"`
+	PrimaryGroup         string    `yaml:"primary_group,omitempty"`
+	Groups               []string  `yaml:"groups,omitempty"`
+	NoUserGroup          bool      `yaml:"no_user_group,omitempty"`
+	System               bool      `yaml:"system,omitempty"`
+	NoLogInit            bool      `yaml:"no_log_init,omitempty"`
+	Shell                string    `yaml:"shell,omitempty"`
+	Sudo                 SudoRules `yaml:"sudo,omitempty"`
+}
+
+// SSHImportIDs returns the sources of SSH keys to import for the user: the
+// entries of ssh_import_id followed by those of the deprecated
+// coreos_ssh_import_* fields.
+func (u User) SSHImportIDs() []string {
+	ids := append([]string{}, u.SSHImportID...)
+	if u.SSHImportGithubUser != "" {
+		ids = append(ids, "gh:"+u.SSHImportGithubUser)
+	}
+	for _, gh := range u.SSHImportGithubUsers {
+		ids = append(ids, "gh:"+gh)
+	}
+	if u.SSHImportURL != "" {
+		ids = append(ids, "url:"+u.SSHImportURL)
+	}
+	return ids
+}
+
+// PasswordLocked determines if password login should be disabled for the
+// user, which is the default.
+func (u User) PasswordLocked() bool {
+	return u.LockPasswd == nil || *u.LockPasswd
+}
+
+// SudoRules are the sudoers rules of a user, without the user name (e.g.
+// "ALL=(ALL) NOPASSWD:ALL"). In YAML they are given as a single rule, a list
+// of rules, or false for none.
+type SudoRules []string
+
+// SetYAML implements yaml.Setter.
+func (r *SudoRules) SetYAML(tag string, value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		*r = SudoRules{v}
+	case bool:
+		if v {
+			return false
+		}
+		*r = nil
+	case []interface{}:
+		rules := make(SudoRules, 0, len(v))
+		for _, rule := range v {
+			rules = append(rules, fmt.Sprintf("%v", rule))
+		}
+		*r = rules
+	default:
+		return false
+	}
+	return true
 }
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"reflect"
 	"regexp"
+	"sort"
 	"strings"
 )
 
@@ -102,16 +103,32 @@ func toNode(v interface{}, c context, n *node) {
 		}
 	case reflect.Map:
 		// Walk over each key in the map and create a node for it.
-		v := v.(map[interface{}]interface{})
-		for k, cv := range v {
-			cn := node{name: fmt.Sprintf("%s", k)}
+		for _, k := range vv.MapKeys() {
+			cn := node{name: fmt.Sprintf("%v", k.Interface())}
 			c, ok := findKey(cn.name, c)
 			if ok {
 				cn.line = c.lineNumber
 			}
-			toNode(cv, c, &cn)
+			toNode(vv.MapIndex(k).Interface(), c, &cn)
 			n.children = append(n.children, cn)
 		}
+		// Map iteration order is random, so the keys are put back in the
+		// order of the document for the report to be stable.
+		sort.SliceStable(n.children, func(i, j int) bool {
+			a, b := n.children[i], n.children[j]
+			if a.line != b.line {
+				return a.line < b.line
+			}
+			return a.name < b.name
+		})
+	case reflect.Ptr:
+		// Optional values are described by the type they point to. A nil
+		// pointer is represented by the zero value of that type.
+		if vv.IsNil() {
+			toNode(reflect.Zero(vv.Type().Elem()).Interface(), c, n)
+		} else {
+			toNode(vv.Elem().Interface(), c, n)
+		}
 	case reflect.Slice:
 		// Walk over each element in the slice and create a node for it.
 		// While iterating over the slice, preserve the context after it
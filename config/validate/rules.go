@@ -16,24 +16,91 @@ package validate
 
 import (
 	"fmt"
+	"net"
 	"net/url"
+	"path"
 	"reflect"
+	"strings"
 
 	"github.com/elotl/cloud-init/config"
+
+	"github.com/coreos/yaml"
 )
 
 type rule func(config node, report *Report)
 
+var setterType = reflect.TypeOf((*yaml.Setter)(nil)).Elem()
+
 // Rules contains all of the validation rules.
 var Rules []rule = []rule{
+	checkAPKRepos,
+	checkCACerts,
 	checkDiscoveryUrl,
 	checkEncoding,
+	checkHostname,
+	checkMounts,
+	checkPackages,
+	checkPowerState,
+	checkResolvConf,
+	checkSSHAuthorizedKeys,
+	checkSSHGenKeyTypes,
+	checkSSHImportIDs,
 	checkStructure,
+	checkSysctl,
 	checkValidity,
 	checkWriteFiles,
 	checkWriteFilesUnderCoreos,
 }
 
+// checkAPKRepos checks the URLs of the repositories of apk_repos, and that
+// its keys are PEM encoded public keys or URLs to fetch them from.
+func checkAPKRepos(cfg node, report *Report) {
+	c := cfg.Child("apk_repos")
+	for _, r := range c.Child("repositories").children {
+		repo := config.APKRepository{URL: stringOf(r.Child("url"))}
+		if r.Kind() == reflect.String {
+			repo.URL = r.String()
+		}
+		if err := repo.AssertValid(); err != nil {
+			report.Error(r.line, err.Error())
+		}
+	}
+	for _, k := range c.Child("keys").children {
+		key := config.APKKey{
+			Name:    stringOf(k.Child("name")),
+			Content: stringOf(k.Child("content")),
+			URL:     stringOf(k.Child("url")),
+		}
+		if k.Kind() == reflect.String {
+			key.URL = k.String()
+		}
+		if err := key.AssertValid(); err != nil {
+			report.Error(k.line, fmt.Sprintf("invalid APK key: %v", err))
+		}
+	}
+}
+
+// stringOf returns the value of node n if it is a string.
+func stringOf(n node) string {
+	if n.IsValid() && n.Kind() == reflect.String {
+		return n.String()
+	}
+	return ""
+}
+
+// checkCACerts checks that the trusted certificates of ca_certs are PEM
+// encoded X.509 certificates.
+func checkCACerts(cfg node, report *Report) {
+	for _, c := range cfg.Child("ca_certs").Child("trusted").children {
+		if c.Kind() != reflect.String {
+			continue
+		}
+		if _, err := config.ParseCertificates(c.String()); err != nil {
+			report.Error(c.line, fmt.Sprintf("invalid CA certificate: %v", err))
+		}
+	}
+}
+
 // checkDiscoveryUrl verifies that the string is a valid url.
 func checkDiscoveryUrl(cfg node, report *Report) {
 	c := cfg.Child("coreos").Child("etcd").Child("discovery")
@@ -62,6 +129,151 @@ func checkEncoding(cfg node, report *Report) {
 	}
 }
 
+// checkHostname checks that hostname and fqdn are valid host names.
+func checkHostname(cfg node, report *Report) {
+	for _, name := range []string{"hostname", "fqdn"} {
+		c := cfg.Child(name)
+		if !c.IsValid() || c.Kind() != reflect.String {
+			continue
+		}
+		if err := config.AssertHostnameValid(c.String()); err != nil {
+			report.Error(c.line, err.Error())
+		}
+	}
+}
+
+// checkMounts checks that each of the mounts is a list of the fields of an
+// entry of /etc/fstab.
+func checkMounts(cfg node, report *Report) {
+	for _, m := range cfg.Child("mounts").children {
+		if m.Kind() != reflect.Slice || len(m.children) == 0 || len(m.children) > 6 {
+			report.Error(m.line, "invalid mount: want a list of 1 to 6 fstab fields")
+		}
+	}
+}
+
+// checkPackages checks that the name and version of the packages given as
+// lists are strings, as YAML would otherwise mangle versions like 20.10,
+// and that no name starts with a dash, which package managers would take
+// for an option.
+func checkPackages(cfg node, report *Report) {
+	for _, p := range cfg.Child("packages").children {
+		var name node
+		switch p.Kind() {
+		case reflect.String:
+			name = p
+		case reflect.Slice:
+			for _, c := range p.children {
+				if c.Kind() != reflect.String {
+					report.Error(p.line, fmt.Sprintf("package name or version %v is not a string (quote it)", c.Interface()))
+				}
+			}
+			if len(p.children) > 0 {
+				name = p.children[0]
+			}
+		case reflect.Map:
+			name = p.Child("name")
+		}
+		if name.IsValid() && name.Kind() == reflect.String && strings.HasPrefix(name.String(), "-") {
+			report.Error(p.line, fmt.Sprintf("invalid package name %q", name.String()))
+		}
+	}
+}
+
+// checkPowerState checks that power_state has a mode and that its condition
+// is a boolean or a command.
+func checkPowerState(cfg node, report *Report) {
+	ps := cfg.Child("power_state")
+	if ps.Kind() != reflect.Map {
+		return
+	}
+	if !ps.Child("mode").IsValid() {
+		report.Error(ps.line, "power_state requires a mode")
+	}
+	if c := ps.Child("condition"); c.IsValid() {
+		switch c.Kind() {
+		case reflect.Bool, reflect.String, reflect.Slice, reflect.Map:
+		default:
+			report.Error(c.line, "invalid condition: want a boolean or a command")
+		}
+	}
+}
+
+// checkResolvConf checks that the nameservers and sortlist of resolv_conf
+// are IP addresses, and warns about nameservers the resolver will ignore.
+func checkResolvConf(cfg node, report *Report) {
+	c := cfg.Child("resolv_conf")
+	for i, ns := range c.Child("nameservers").children {
+		if ns.Kind() != reflect.String {
+			continue
+		}
+		if net.ParseIP(ns.String()) == nil {
+			report.Error(ns.line, fmt.Sprintf("invalid nameserver %q", ns.String()))
+		} else if i == config.MaxNameservers {
+			report.Warning(ns.line, fmt.Sprintf("only the first %d nameservers are used", config.MaxNameservers))
+		}
+	}
+	for _, s := range c.Child("sortlist").children {
+		if s.Kind() != reflect.String {
+			continue
+		}
+		if net.ParseIP(strings.SplitN(s.String(), "/", 2)[0]) == nil {
+			report.Error(s.line, fmt.Sprintf("invalid sortlist entry %q", s.String()))
+		}
+	}
+}
+
+// checkSSHAuthorizedKeys checks that the SSH keys authorized for root and
+// for each user parse, and warns about weak keys.
+func checkSSHAuthorizedKeys(cfg node, report *Report) {
+	keys := cfg.Child("ssh_authorized_keys").children
+	for _, u := range cfg.Child("users").children {
+		keys = append(keys, u.Child("ssh_authorized_keys").children...)
+	}
+	for _, k := range keys {
+		if k.Kind() != reflect.String {
+			continue
+		}
+		key, err := config.ParseSSHKey(k.String())
+		if err != nil {
+			report.Error(k.line, fmt.Sprintf("invalid SSH key: %v", err))
+		} else if weakness := key.Weakness(); weakness != "" {
+			report.Warning(k.line, fmt.Sprintf("weak SSH key: %s", weakness))
+		}
+	}
+}
+
+// checkSSHGenKeyTypes checks that each of the types of SSH host keys to
+// generate is known.
+func checkSSHGenKeyTypes(cfg node, report *Report) {
+	for _, t := range cfg.Child("ssh_genkeytypes").children {
+		if t.Kind() != reflect.String {
+			continue
+		}
+		switch t.String() {
+		case "rsa", "ecdsa", "ed25519":
+		default:
+			report.Error(t.line, fmt.Sprintf("invalid SSH host key type %q", t.String()))
+		}
+	}
+}
+
+// checkSSHImportIDs checks that each ssh_import_id of the users is either
+// gh:<user> or url:<url>.
+func checkSSHImportIDs(cfg node, report *Report) {
+	for _, u := range cfg.Child("users").children {
+		for _, id := range u.Child("ssh_import_id").children {
+			if id.Kind() != reflect.String {
+				continue
+			}
+			s := id.String()
+			if !(strings.HasPrefix(s, "gh:") && len(s) > 3) && !(strings.HasPrefix(s, "url:") && len(s) > 4) {
+				report.Error(id.line, fmt.Sprintf("invalid ssh_import_id %q (want gh:<user> or url:<url>)", s))
+			}
+		}
+	}
+}
+
 // checkStructure compares the provided config to the empty config.CloudConfig
 // structure. Each node is checked to make sure that it exists in the known
 // structure and that its type is compatible.
@@ -71,6 +283,12 @@ func checkStructure(cfg node, report *Report) {
 }
 
 func checkNodeStructure(n, g node, r *Report) {
+	// Types which decode themselves may be given in a shorter form than
+	// their structure (e.g. a command given as a plain string).
+	if isSetter(g) && isShortForm(n, g) {
+		return
+	}
+
 	if !isCompatible(n.Kind(), g.Kind()) {
 		r.Warning(n.line, fmt.Sprintf("incorrect type for %q (want %s)", n.name, g.HumanType()))
 		return
@@ -88,7 +306,7 @@ func checkNodeStructure(n, g node, r *Report) {
 				r.Warning(cn.line, fmt.Sprintf("unrecognized key %q", cn.name))
 			}
 		}
-	case reflect.Slice:
+	case reflect.Slice, reflect.Map:
 		for _, cn := range n.children {
 			var cg node
 			c := g.Type().Elem()
@@ -101,6 +319,25 @@ func checkNodeStructure(n, g node, r *Report) {
 	}
 }
 
+// isSetter determines if the type of node g implements yaml.Setter.
+func isSetter(g node) bool {
+	return g.IsValid() && reflect.PtrTo(g.Type()).Implements(setterType)
+}
+
+// isShortForm determines if node n is not given in the structure of node g:
+// either it is not a mapping or none of its keys are fields of g.
+func isShortForm(n, g node) bool {
+	if n.Kind() != reflect.Map {
+		return true
+	}
+	for _, cn := range n.children {
+		if g.Child(cn.name).IsValid() {
+			return false
+		}
+	}
+	return true
+}
+
 // isCompatible determines if the type of kind n can be converted to the type
 // of kind g in the context of YAML. This is not an exhaustive list, but its
 // enough for the purposes of cloud-config validation.
@@ -110,6 +347,8 @@ func isCompatible(n, g reflect.Kind) bool {
 		return n == reflect.String || n == reflect.Int || n == reflect.Float64 || n == reflect.Bool
 	case reflect.Struct:
 		return n == reflect.Struct || n == reflect.Map
+	case reflect.Map:
+		return n == reflect.Map
 	case reflect.Float64:
 		return n == reflect.Float64 || n == reflect.Int
 	case reflect.Bool, reflect.Slice, reflect.Int:
@@ -119,6 +358,15 @@ func isCompatible(n, g reflect.Kind) bool {
 	}
 }
 
+// checkSysctl checks that the keys of sysctl name kernel parameters.
+func checkSysctl(cfg node, report *Report) {
+	for _, c := range cfg.Child("sysctl").children {
+		if err := config.AssertSysctlKeyValid(c.name); err != nil {
+			report.Error(c.line, err.Error())
+		}
+	}
+}
+
 // checkValidity checks the value of every node in the provided config by
 // running config.AssertValid() on it.
 func checkValidity(cfg node, report *Report) {
@@ -137,7 +385,7 @@ func checkNodeValidity(n, g node, r *Report) {
 				checkNodeValidity(cn, cg, r)
 			}
 		}
-	case reflect.Slice:
+	case reflect.Slice, reflect.Map:
 		for _, cn := range n.children {
 			var cg node
 			c := g.Type().Elem()
@@ -151,14 +399,25 @@ func checkNodeValidity(n, g node, r *Report) {
 }
 
 // checkWriteFiles checks to make sure that the target file can actually be
-// written. Note that this check is approximate (it only checks to see if the file
-// is under /usr).
+// written. Paths must be absolute and must not use '..' to climb out of the
+// root the files are written under.
 func checkWriteFiles(cfg node, report *Report) {
 	for _, f := range cfg.Child("write_files").children {
 		c := f.Child("path")
 		if !c.IsValid() {
 			continue
 		}
+
+		p := c.String()
+		if !path.IsAbs(p) {
+			report.Error(c.line, fmt.Sprintf("file path %q is not absolute", p))
+		}
+		for _, part := range strings.Split(p, "/") {
+			if part == ".." {
+				report.Error(c.line, fmt.Sprintf("file path %q contains '..'", p))
+				break
+			}
+		}
 	}
 }
 
@@ -19,7 +19,6 @@ import (
 	"fmt"
 	"regexp"
 	"strconv"
-	"strings"
 
 	"github.com/elotl/cloud-init/config"
 
@@ -93,9 +92,7 @@ func parseCloudConfig(cfg []byte, report *Report) (node, error) {
 	w = normalizeNodeNames(w, report)
 
 	// unmarshal the config into the explicitly-typed form.
-	yaml.UnmarshalMappingKeyTransform = func(nameIn string) (nameOut string) {
-		return strings.Replace(nameIn, "-", "_", -1)
-	}
+	yaml.UnmarshalMappingKeyTransform = config.NormalizeKey
 	var strong config.CloudConfig
 	if err := yaml.Unmarshal([]byte(cfg), &strong); err != nil {
 		return node{}, err
@@ -139,10 +136,10 @@ func coerceNodes(w, s node) node {
 // normalizeNodeNames replaces all occurences of '-' with '_' within key names
 // and makes a note of each replacement in the report.
 func normalizeNodeNames(node node, report *Report) node {
-	if strings.Contains(node.name, "-") {
+	if name := config.NormalizeKey(node.name); name != node.name {
 		// TODO(crawford): Enable this message once the new validator hits stable.
 		//report.Info(node.line, fmt.Sprintf("%q uses '-' instead of '_'", node.name))
-		node.name = strings.Replace(node.name, "-", "_", -1)
+		node.name = name
 	}
 	for i := range node.children {
 		node.children[i] = normalizeNodeNames(node.children[i], report)
@@ -28,11 +28,14 @@ type Datasource interface {
 }
 
 type Metadata struct {
+	InstanceID    string
 	PublicIPv4    net.IP
 	PublicIPv6    net.IP
 	PrivateIPv4   net.IP
 	PrivateIPv6   net.IP
 	Hostname      string
 	SSHPublicKeys map[string]string
+	// Nameservers are the DNS servers provided by the datasource.
+	Nameservers   []net.IP
 	NetworkConfig interface{}
 }
@@ -101,6 +101,11 @@ func (ms *metadataService) FetchMetadata() (metadata datasource.Metadata, err er
 	for i, key := range m.PublicKeys {
 		metadata.SSHPublicKeys[strconv.Itoa(i)] = key
 	}
+	for _, ns := range m.DNS.Nameservers {
+		if ip := net.ParseIP(ns); ip != nil {
+			metadata.Nameservers = append(metadata.Nameservers, ip)
+		}
+	}
 	metadata.NetworkConfig = m
 
 	return
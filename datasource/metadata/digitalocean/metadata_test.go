@@ -80,6 +80,12 @@ func TestFetchMetadata(t *testing.T) {
         "type": "public"
       }
     ]
+  },
+  "dns": {
+    "nameservers": [
+      "2001:4860:4860::8844",
+      "8.8.8.8"
+    ]
   }
 }`,
 			},
@@ -90,6 +96,7 @@ func TestFetchMetadata(t *testing.T) {
 					"0": "publickey1",
 					"1": "publickey2",
 				},
+				Nameservers: []net.IP{net.ParseIP("2001:4860:4860::8844"), net.ParseIP("8.8.8.8")},
 				NetworkConfig: Metadata{
 					Interfaces: Interfaces{
 						Public: []Interface{
@@ -110,6 +117,7 @@ func TestFetchMetadata(t *testing.T) {
 						},
 					},
 					PublicKeys: []string{"publickey1", "publickey2"},
+					DNS:        DNS{Nameservers: []string{"2001:4860:4860::8844", "8.8.8.8"}},
 				},
 			},
 		},
@@ -16,6 +16,7 @@ package gce
 
 import (
 	"fmt"
+	"log"
 	"net"
 	"net/http"
 
@@ -50,8 +51,14 @@ func (ms metadataService) FetchMetadata() (datasource.Metadata, error) {
 	if err != nil {
 		return datasource.Metadata{}, err
 	}
+	// The rest of the metadata is still of use without the instance ID.
+	instanceID, err := ms.fetchString("id")
+	if err != nil {
+		log.Printf("Failed fetching the instance ID: %v", err)
+	}
 
 	return datasource.Metadata{
+		InstanceID:  instanceID,
 		PublicIPv4:  public,
 		PrivateIPv4: local,
 		Hostname:    hostname,
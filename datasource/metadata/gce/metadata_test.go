@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"net"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/elotl/cloud-init/datasource"
@@ -61,11 +62,13 @@ func TestFetchMetadata(t *testing.T) {
 			root:         "/",
 			metadataPath: "computeMetadata/v1/instance/",
 			resources: map[string]string{
+				"/computeMetadata/v1/instance/id":                                                "1234567890",
 				"/computeMetadata/v1/instance/hostname":                                          "host",
 				"/computeMetadata/v1/instance/network-interfaces/0/ip":                           "1.2.3.4",
 				"/computeMetadata/v1/instance/network-interfaces/0/access-configs/0/external-ip": "5.6.7.8",
 			},
 			expect: datasource.Metadata{
+				InstanceID:  "1234567890",
 				Hostname:    "host",
 				PrivateIPv4: net.ParseIP("1.2.3.4"),
 				PublicIPv4:  net.ParseIP("5.6.7.8"),
@@ -97,3 +100,33 @@ func Error(err error) string {
 	}
 	return ""
 }
+
+// idFailingClient fails fetching the instance ID, and nothing else.
+type idFailingClient struct {
+	*test.HttpClient
+}
+
+func (c idFailingClient) GetRetry(url string) ([]byte, error) {
+	if strings.HasSuffix(url, "/id") {
+		return nil, pkg.ErrTimeout{Err: fmt.Errorf("test error")}
+	}
+	return c.HttpClient.GetRetry(url)
+}
+
+func TestFetchMetadataWithoutInstanceID(t *testing.T) {
+	service := &metadataService{metadata.MetadataService{
+		Root: "/",
+		Client: idFailingClient{&test.HttpClient{Resources: map[string]string{
+			"/computeMetadata/v1/instance/id":       "1234567890",
+			"/computeMetadata/v1/instance/hostname": "host",
+		}}},
+		MetadataPath: "computeMetadata/v1/instance/",
+	}}
+	metadata, err := service.FetchMetadata()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expect := (datasource.Metadata{Hostname: "host"}); !reflect.DeepEqual(expect, metadata) {
+		t.Fatalf("bad fetch: want %#v, got %#v", expect, metadata)
+	}
+}
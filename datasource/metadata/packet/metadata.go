@@ -95,6 +95,7 @@ func (ms *metadataService) FetchMetadata() (metadata datasource.Metadata, err er
 	for i, key := range m.SSHKeys {
 		metadata.SSHPublicKeys[strconv.Itoa(i)] = key
 	}
+	metadata.Nameservers = m.NetworkData.DNS
 
 	metadata.NetworkConfig = m.NetworkData
 
@@ -0,0 +1,84 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/pkg"
+	"github.com/elotl/cloud-init/system"
+)
+
+// apkKeyRetries bounds the attempts to fetch each key of apk_repos.
+var apkKeyRetries = 5
+
+// applyAPKRepos writes the keys and repositories of apk_repos, ahead of the
+// packages which may come from those repositories. The repositories are
+// left as they are if any key fails, as apk would reject their indexes.
+func applyAPKRepos(cfg config.CloudConfig, env *Environment) []error {
+	if cfg.APKRepos == nil {
+		return nil
+	}
+
+	var errs []error
+	for _, key := range cfg.APKRepos.Keys {
+		if err := key.AssertValid(); err != nil {
+			errs = append(errs, fmt.Errorf("invalid APK key %s: %v", key.FileName(), err))
+			continue
+		}
+		content := key.Content
+		if key.URL != "" {
+			client := pkg.NewHttpClient()
+			client.MaxRetries = apkKeyRetries
+			client.MaxBackoff = 2 * time.Second
+			data, err := client.GetRetry(key.URL)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed fetching APK key %s: %v", key.URL, err))
+				continue
+			}
+			content = string(data)
+		}
+		changed, err := system.WriteAPKKey(key.FileName(), content, env.Root())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed writing APK key %s: %v", key.FileName(), err))
+		} else if changed {
+			log.Printf("Wrote APK key %s", key.FileName())
+		}
+	}
+	if len(errs) > 0 {
+		for _, err := range errs {
+			log.Printf("%v", err)
+		}
+		return errs
+	}
+
+	for _, repo := range cfg.APKRepos.Repositories {
+		if err := repo.AssertValid(); err != nil {
+			return []error{err}
+		}
+	}
+	changed, err := system.WriteAPKRepositories(*cfg.APKRepos, env.Root())
+	if err != nil {
+		log.Printf("Failed writing %s: %v", system.APKRepositoriesPath, err)
+		return []error{err}
+	}
+	if changed {
+		log.Printf("Updated %s", system.APKRepositoriesPath)
+	}
+	return nil
+}
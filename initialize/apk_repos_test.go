@@ -0,0 +1,110 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/datasource"
+	"github.com/elotl/cloud-init/system"
+)
+
+const testAPKKey = `-----BEGIN PUBLIC KEY-----
+MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAEC5q1wx+kwl3nrFpsa0Gw/2qS2tBV
+VaohFK2Z3uHX4sxwyyun8f8vmKznRXVIjo29PvC87nhlAkk2xrjL8Ngdpw==
+-----END PUBLIC KEY-----
+`
+
+func TestApplyAPKRepos(t *testing.T) {
+	defer func(retries int) { apkKeyRetries = retries }(apkKeyRetries)
+	apkKeyRetries = 1
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/keys/mirror.rsa.pub" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(testAPKKey))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	env := NewEnvironment(dir, "", "", "", datasource.Metadata{})
+
+	// The repositories are left alone when a key can not be fetched.
+	cfg := config.CloudConfig{APKRepos: &config.APKRepos{
+		Repositories: []config.APKRepository{{URL: ts.URL + "/alpine/main"}},
+		Keys: []config.APKKey{
+			{URL: ts.URL + "/keys/missing.rsa.pub"},
+			{Name: "inline.rsa.pub", Content: testAPKKey},
+		},
+	}}
+	if errs := applyAPKRepos(cfg, env); len(errs) != 1 {
+		t.Fatalf("bad errors: want 1, got %v", errs)
+	}
+	if _, err := os.Stat(path.Join(dir, system.APKRepositoriesPath)); !os.IsNotExist(err) {
+		t.Errorf("Unexpected repositories written despite a missing key: %v", err)
+	}
+
+	cfg.APKRepos.Keys[0].URL = ts.URL + "/keys/mirror.rsa.pub"
+	if errs := applyAPKRepos(cfg, env); len(errs) != 0 {
+		t.Fatalf("Unexpected errors while applying apk_repos: %v", errs)
+	}
+	for _, name := range []string{"mirror.rsa.pub", "inline.rsa.pub"} {
+		contents, err := ioutil.ReadFile(path.Join(dir, system.APKKeysDir, name))
+		if err != nil || string(contents) != testAPKKey {
+			t.Errorf("bad key %s: want %q, <nil>, got %q, %v", name, testAPKKey, contents, err)
+		}
+	}
+	contents, err := ioutil.ReadFile(path.Join(dir, system.APKRepositoriesPath))
+	if err != nil {
+		t.Fatalf("Unable to read the repositories: %v", err)
+	}
+	expected := "# Generated by cloud-init from the apk_repos of the cloud-config.\n" + ts.URL + "/alpine/main\n"
+	if string(contents) != expected {
+		t.Errorf("bad repositories: want %q, got %q", expected, contents)
+	}
+
+	// Keys alone leave the repositories of the system as they are.
+	dir, err = ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	env = NewEnvironment(dir, "", "", "", datasource.Metadata{})
+
+	cfg = config.CloudConfig{APKRepos: &config.APKRepos{
+		Keys: []config.APKKey{{Name: "inline.rsa.pub", Content: testAPKKey}},
+	}}
+	if errs := applyAPKRepos(cfg, env); len(errs) != 0 {
+		t.Fatalf("Unexpected errors while applying keys only: %v", errs)
+	}
+	if _, err := os.Stat(path.Join(dir, system.APKKeysDir, "inline.rsa.pub")); err != nil {
+		t.Errorf("Missing key: %v", err)
+	}
+	if _, err := os.Stat(path.Join(dir, system.APKRepositoriesPath)); !os.IsNotExist(err) {
+		t.Errorf("Unexpected repositories written for keys only: %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"encoding/pem"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/system"
+)
+
+// applyCACerts trusts the certificates of ca_certs, each written to the
+// anchor directory of the distribution, and regenerates the bundle of
+// trusted certificates. Nothing changes if any certificate is invalid.
+// Expired certificates are trusted all the same, with a warning in the
+// status.
+func applyCACerts(cfg config.CloudConfig, env *Environment, status *Status) error {
+	if cfg.CACerts == nil {
+		return nil
+	}
+
+	var pems []string
+	for i, data := range cfg.CACerts.Trusted {
+		certs, err := config.ParseCertificates(data)
+		if err != nil {
+			return fmt.Errorf("invalid CA certificate %d: %v", i+1, err)
+		}
+		for _, cert := range certs {
+			log.Printf("Trusting CA certificate %q, expiring on %s", cert.Subject, cert.NotAfter.Format(time.RFC3339))
+			if time.Now().After(cert.NotAfter) {
+				warning := fmt.Sprintf("CA certificate %q expired on %s", cert.Subject, cert.NotAfter.Format(time.RFC3339))
+				log.Printf("Warning: %s", warning)
+				status.Warnings = append(status.Warnings, warning)
+			}
+			pems = append(pems, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})))
+		}
+	}
+
+	// The bundle is regenerated even when the anchors are unchanged, as
+	// it may not have been after they were written on an earlier boot.
+	trust := system.DetectCATrust(env.Root())
+	if _, err := trust.WriteTrustedCerts(pems, env.Root()); err != nil {
+		return err
+	}
+	if cfg.CACerts.RemoveDefaults {
+		if _, err := trust.RemoveDefaults(env.Root()); err != nil {
+			return err
+		}
+	}
+
+	if trust.Tool != "" {
+		log.Printf("Updating the trusted CA certificates with %s", trust.Tool)
+	} else {
+		log.Printf("Updating %s", system.CACertsBundlePath)
+	}
+	return trust.Update(pems, cfg.CACerts.RemoveDefaults, env.Root())
+}
@@ -0,0 +1,107 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/datasource"
+	"github.com/elotl/cloud-init/system"
+)
+
+// testCACert returns a self-signed CA certificate valid until notAfter.
+func testCACert(t *testing.T, name string, notAfter time.Time) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             notAfter.Add(-24 * time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Unable to create certificate: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestApplyCACerts(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	env := NewEnvironment(dir, "", "", "", datasource.Metadata{})
+	valid := testCACert(t, "Cluster CA", time.Now().Add(24*time.Hour))
+	expired := testCACert(t, "Old CA", time.Now().Add(-time.Hour))
+
+	// Nothing is trusted if any certificate is invalid.
+	status := &Status{}
+	cfg := config.CloudConfig{CACerts: &config.CACerts{Trusted: []string{valid, "junk"}}}
+	if err := applyCACerts(cfg, env, status); err == nil {
+		t.Fatalf("Expected an error for an invalid certificate")
+	}
+	if _, err := os.Stat(path.Join(dir, system.CACertsBundlePath)); !os.IsNotExist(err) {
+		t.Errorf("Unexpected bundle despite an invalid certificate: %v", err)
+	}
+
+	cfg.CACerts.Trusted = []string{valid + expired}
+	if err := applyCACerts(cfg, env, status); err != nil {
+		t.Fatalf("Unexpected error while applying ca_certs: %v", err)
+	}
+	contents, err := ioutil.ReadFile(path.Join(dir, system.CACertsBundlePath))
+	if err != nil {
+		t.Fatalf("Unable to read the bundle: %v", err)
+	}
+	if !strings.Contains(string(contents), valid) || !strings.Contains(string(contents), expired) {
+		t.Errorf("Missing certificates in the bundle %q", contents)
+	}
+	for _, name := range []string{"cloud-init-ca-cert-1.crt", "cloud-init-ca-cert-2.crt"} {
+		if _, err := os.Stat(path.Join(dir, "/usr/local/share/ca-certificates", name)); err != nil {
+			t.Errorf("Missing anchor %s: %v", name, err)
+		}
+	}
+	if len(status.Warnings) != 1 || !strings.HasPrefix(status.Warnings[0], `CA certificate "CN=Old CA" expired on `) {
+		t.Errorf("bad warnings: %v", status.Warnings)
+	}
+
+	// The bundle is regenerated even though the anchors are unchanged.
+	os.Remove(path.Join(dir, system.CACertsBundlePath))
+	if err := applyCACerts(cfg, env, &Status{}); err != nil {
+		t.Fatalf("Unexpected error while applying ca_certs again: %v", err)
+	}
+	if _, err := os.Stat(path.Join(dir, system.CACertsBundlePath)); err != nil {
+		t.Errorf("Missing bundle after applying ca_certs again: %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/system"
+)
+
+// passwordHashPattern matches the crypt(3) hashes accepted in chpasswd
+// entries. Anything else is taken to be a plain text password.
+var passwordHashPattern = regexp.MustCompile(`^\$(1|2a|2b|2y|5|6|y)(\$[^$]+){2,}$`)
+
+// applyChPasswd sets the passwords of the users listed in cfg with um,
+// expiring them if requested. Users given RANDOM as their password get a
+// freshly generated one, which is printed to the console and returned.
+func applyChPasswd(cfg config.ChPasswd, um system.UserManager) (random map[string]string, errs []error) {
+	random = map[string]string{}
+	for _, entry := range cfg.List {
+		i := strings.Index(entry, ":")
+		if i <= 0 || i == len(entry)-1 {
+			errs = append(errs, fmt.Errorf("invalid chpasswd entry %q, want user:password", redactPassword(entry)))
+			continue
+		}
+		user, password := entry[:i], entry[i+1:]
+
+		isRandom := password == "RANDOM" || password == "R"
+		if isRandom {
+			p, err := system.RandomPassword()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("unable to generate password for %q: %v", user, err))
+				continue
+			}
+			password = p
+		}
+
+		hash := password
+		if isRandom || !passwordHashPattern.MatchString(password) {
+			var err error
+			if hash, err = system.HashPassword(password); err != nil {
+				errs = append(errs, fmt.Errorf("unable to hash password of %q: %v", user, err))
+				continue
+			}
+		}
+
+		log.Printf("Setting '%s' user's password", user)
+		if err := um.SetUserPassword(user, hash); err != nil {
+			log.Printf("Failed setting '%s' user's password: %v", user, err)
+			errs = append(errs, err)
+			continue
+		}
+		// A later entry for the same user overrides its random password.
+		if isRandom {
+			random[user] = password
+		} else {
+			delete(random, user)
+		}
+		if cfg.Expire {
+			if err := um.ExpirePassword(user); err != nil {
+				log.Printf("Failed expiring '%s' user's password: %v", user, err)
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if len(random) > 0 {
+		var users []string
+		for user := range random {
+			users = append(users, user)
+		}
+		sort.Strings(users)
+
+		var msg bytes.Buffer
+		msg.WriteString("Set the following 'random' passwords")
+		for _, user := range users {
+			fmt.Fprintf(&msg, "\n%s:%s", user, random[user])
+		}
+		printToConsole(msg.String())
+	}
+	return random, errs
+}
+
+// redactPassword hides the password of a chpasswd entry so it can be logged.
+func redactPassword(entry string) string {
+	if i := strings.Index(entry, ":"); i != -1 {
+		return entry[:i+1] + "<redacted>"
+	}
+	return entry
+}
@@ -0,0 +1,104 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/system"
+)
+
+// testPasswordManager records the passwords set through it. Its other
+// methods are not expected to be called.
+type testPasswordManager struct {
+	system.UserManager
+	hashes  map[string]string
+	expired []string
+}
+
+func (m *testPasswordManager) SetUserPassword(user, hash string) error {
+	if user == "missing" {
+		return fmt.Errorf("unknown user %q", user)
+	}
+	m.hashes[user] = hash
+	return nil
+}
+
+func (m *testPasswordManager) ExpirePassword(user string) error {
+	m.expired = append(m.expired, user)
+	return nil
+}
+
+func TestApplyChPasswd(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	consolePath = path.Join(dir, "console")
+	defer func() { consolePath = "/dev/console" }()
+	ioutil.WriteFile(consolePath, nil, 0600)
+
+	um := &testPasswordManager{hashes: map[string]string{}}
+	cfg := config.ChPasswd{
+		List: config.ChPasswdList{
+			"hashed:$6$salt$hash",
+			"plain:secret",
+			"random:RANDOM",
+			"missing:RANDOM",
+			"invalid",
+			"rehashed:RANDOM",
+			"rehashed:$6$salt$rehashed",
+		},
+		Expire: true,
+	}
+
+	random, errs := applyChPasswd(cfg, um)
+	if len(errs) != 2 {
+		t.Errorf("bad errors: want 2, got %v", errs)
+	}
+	if um.hashes["hashed"] != "$6$salt$hash" {
+		t.Errorf("bad hash for hashed: got %q", um.hashes["hashed"])
+	}
+	for _, user := range []string{"plain", "random"} {
+		if !strings.HasPrefix(um.hashes[user], "$6$") {
+			t.Errorf("bad hash for %s: want SHA-512 crypt, got %q", user, um.hashes[user])
+		}
+	}
+	// A hash given after RANDOM is set as it is.
+	if um.hashes["rehashed"] != "$6$salt$rehashed" {
+		t.Errorf("bad hash for rehashed: got %q", um.hashes["rehashed"])
+	}
+	if len(random) != 1 || len(random["random"]) != 20 {
+		t.Fatalf("bad random passwords: %v", random)
+	}
+	if len(um.expired) != 5 {
+		t.Errorf("bad expired users: want hashed, plain, random and rehashed twice, got %v", um.expired)
+	}
+
+	console, err := ioutil.ReadFile(consolePath)
+	if err != nil {
+		t.Fatalf("Unable to read console: %v", err)
+	}
+	if !strings.Contains(string(console), "random:"+random["random"]) || strings.Contains(string(console), "missing") || strings.Contains(string(console), "rehashed") {
+		t.Errorf("bad console output: %q", console)
+	}
+}
@@ -19,7 +19,6 @@ import (
 	"fmt"
 	"log"
 	"path"
-	"strings"
 
 	"github.com/elotl/cloud-init/config"
 	"github.com/elotl/cloud-init/network"
@@ -43,8 +42,36 @@ type CloudConfigUnit interface {
 
 // Apply renders a CloudConfig to an Environment. This can involve things like
 // configuring the hostname, adding new users, writing various configuration
-// files to disk, and manipulating systemd services.
+// files to disk, and manipulating systemd services. A summary of the outcome
+// is written to the workspace once everything has been applied.
 func Apply(cfg config.CloudConfig, ifaces []network.InterfaceGenerator, env *Environment) error {
+	status := &Status{}
+	err := apply(cfg, ifaces, env, status)
+	status.setErrors(err)
+	if perr := PersistStatusInWorkspace(status, env.Workspace()); perr != nil {
+		log.Printf("Failed writing status to workspace: %v", perr)
+	}
+	// The power state changes after the status is written so that it
+	// reports this boot.
+	if perr := applyPowerState(cfg, status, env); perr != nil {
+		log.Printf("Failed changing power state: %v", perr)
+	}
+	return err
+}
+
+func apply(cfg config.CloudConfig, ifaces []network.InterfaceGenerator, env *Environment, status *Status) error {
+	allErrors := []error{}
+
+	// bootcmd runs before anything else so it can prepare the system
+	// (e.g. mount points) for the files and users that follow.
+	results, errs, abort := runCommands("bootcmd", cfg.BootCmd, env)
+	status.BootCmd = results
+	allErrors = append(allErrors, errs...)
+	if abort {
+		log.Printf("Aborting remaining stages after bootcmd failure")
+		return aggerr.NewAggregate(allErrors)
+	}
+
 	// We write files first since those are our most important
 	// pieces for itzo (they carry the certs).
 	var writeFiles []system.File
@@ -56,8 +83,14 @@ func Apply(cfg config.CloudConfig, ifaces []network.InterfaceGenerator, env *Env
 	}
 
 	wroteEnvironment := false
-	allErrors := []error{}
 	for _, file := range writeFiles {
+		if file.Source != nil && file.Source.URI != "" {
+			if err := fetchFileSource(&file, env.Root()); err != nil {
+				log.Printf("Failed fetching content of %s: %v", file.Path, err)
+				allErrors = append(allErrors, err)
+				continue
+			}
+		}
 		fullPath, err := system.WriteFile(&file, env.Root())
 		if err != nil {
 			allErrors = append(allErrors, err)
@@ -80,11 +113,72 @@ func Apply(cfg config.CloudConfig, ifaces []network.InterfaceGenerator, env *Env
 		}
 	}
 
-	if cfg.Hostname != "" {
-		if err := system.SetHostname(cfg.Hostname); err != nil {
+	// Modules come after the files, which may carry their options in
+	// /etc/modprobe.d, and before the kernel parameters, some of which only
+	// exist once their module is loaded (e.g. net.bridge of br_netfilter).
+	allErrors = append(allErrors, applyKernelModules(cfg, env)...)
+	allErrors = append(allErrors, applySysctl(cfg, env)...)
+
+	// Mounts follow the files, so that itzo's certs are not held back by
+	// a swap file being allocated or a mount which hangs. Files meant for
+	// the mounted filesystems are left to runcmd.
+	allErrors = append(allErrors, applyMounts(cfg, env)...)
+
+	// The CAs come early for the fetches which follow to trust them.
+	if err := applyCACerts(cfg, env, status); err != nil {
+		log.Printf("Failed updating the trusted CA certificates: %v", err)
+		allErrors = append(allErrors, err)
+	}
+
+	if hostname, fqdn := cfg.HostnameFQDN(); cfg.PreserveHostname {
+		log.Printf("Preserving the hostname")
+	} else if hostname != "" {
+		if err := system.SetHostname(hostname, env.Root()); err != nil {
+			allErrors = append(allErrors, err)
+		} else {
+			log.Printf("Set hostname to %s (FQDN %s)", hostname, fqdn)
+		}
+	}
+
+	if err := applyEtcHosts(cfg, env); err != nil {
+		log.Printf("Failed updating %s: %v", system.EtcHostsPath, err)
+		allErrors = append(allErrors, err)
+	}
+
+	if err := applyResolvConf(cfg, env); err != nil {
+		log.Printf("Failed updating the resolver configuration: %v", err)
+		allErrors = append(allErrors, err)
+	}
+
+	if err := applyTimezone(cfg, env); err != nil {
+		log.Printf("Failed setting the timezone: %v", err)
+		allErrors = append(allErrors, err)
+	}
+
+	if err := applyNTP(cfg, env); err != nil {
+		log.Printf("Failed configuring NTP: %v", err)
+		allErrors = append(allErrors, err)
+	}
+
+	um := system.NewUserManager(env.Root())
+	if len(cfg.Groups) > 0 || len(cfg.Users) > 0 {
+		log.Printf("Managing users and groups with the %s backend", um.Name())
+	}
+
+	// Groups are created before users so that they can be used as the
+	// primary or supplementary groups of new users.
+	for _, group := range cfg.Groups {
+		if group.Name == "" {
+			log.Printf("Group object has no 'name' field, skipping")
+			continue
+		}
+		if created, err := system.CreateGroup(&group, um, env.Root()); err != nil {
+			log.Printf("Failed creating group '%s': %v", group.Name, err)
 			allErrors = append(allErrors, err)
+		} else if created {
+			log.Printf("Created group '%s'", group.Name)
 		} else {
-			log.Printf("Set hostname to %s", cfg.Hostname)
+			log.Printf("Group '%s' exists, skipping creation", group.Name)
 		}
 	}
 
@@ -94,66 +188,79 @@ func Apply(cfg config.CloudConfig, ifaces []network.InterfaceGenerator, env *Env
 			continue
 		}
 
-		if system.UserExists(&user) {
-			log.Printf("User '%s' exists, ignoring creation-time fields", user.Name)
-			if user.PasswordHash != "" {
-				log.Printf("Setting '%s' user's password", user.Name)
-				if err := system.SetUserPassword(user.Name, user.PasswordHash); err != nil {
-					log.Printf("Failed setting '%s' user's password: %v", user.Name, err)
-					allErrors = append(allErrors, err)
-				}
-			}
-		} else {
-			log.Printf("Creating user '%s'", user.Name)
-			if err := system.CreateUser(&user); err != nil {
-				log.Printf("Failed creating user '%s': %v", user.Name, err)
-				allErrors = append(allErrors, err)
-			}
-		}
+		allErrors = append(allErrors, applyUser(user, um, env.Root())...)
 
-		if len(user.SSHAuthorizedKeys) > 0 {
+		// Keys which were authorized before are revoked if the user has
+		// none now.
+		if len(user.SSHAuthorizedKeys) > 0 || system.UserExists(&user, env.Root()) {
 			log.Printf("Authorizing %d SSH keys for user '%s'", len(user.SSHAuthorizedKeys), user.Name)
-			if err := system.AuthorizeSSHKeys(user.Name, user.SSHAuthorizedKeys); err != nil {
+			if err := system.AuthorizeSSHKeys(user.Name, env.SSHKeyName(), user.SSHAuthorizedKeys, sshKeyOptions(cfg, user.Name), env.Root()); err != nil {
 				log.Printf("Error Authorizing SSH keys for user '%s: %v'", user.Name, err)
 				allErrors = append(allErrors, err)
 			}
 		}
-		// if user.SSHImportGithubUser != "" {
-		// 	log.Printf("Authorizing github user %s SSH keys for CoreOS user '%s'", user.SSHImportGithubUser, user.Name)
-		// 	if err := SSHImportGithubUser(user.Name, user.SSHImportGithubUser); err != nil {
-		// 		return err
-		// 	}
-		// }
-		// for _, u := range user.SSHImportGithubUsers {
-		// 	log.Printf("Authorizing github user %s SSH keys for CoreOS user '%s'", u, user.Name)
-		// 	if err := SSHImportGithubUser(user.Name, u); err != nil {
-		// 		return err
-		// 	}
-		// }
-		// if user.SSHImportURL != "" {
-		// 	log.Printf("Authorizing SSH keys for CoreOS user '%s' from '%s'", user.Name, user.SSHImportURL)
-		// 	if err := SSHImportKeysFromURL(user.Name, user.SSHImportURL); err != nil {
-		// 		return err
-		// 	}
-		// }
+		if len(user.SSHImportIDs()) > 0 || system.UserExists(&user, env.Root()) {
+			allErrors = append(allErrors, importSSHKeys(user, sshKeyOptions(cfg, user.Name), env, status)...)
+		}
 	}
 
-	if len(cfg.SSHAuthorizedKeys) > 0 {
-		err := system.AuthorizeSSHKeys("root", cfg.SSHAuthorizedKeys)
-		if err != nil {
+	if sudoers := system.RenderSudoers(cfg.Users); sudoers != "" {
+		if err := system.WriteSudoers(sudoers, env.Root()); err != nil {
+			log.Printf("Failed writing sudo rules: %v", err)
 			allErrors = append(allErrors, err)
 		} else {
-			log.Printf("Authorized SSH keys for root user")
+			log.Printf("Wrote sudo rules to %s", system.SudoersPath)
 		}
+	} else if removed, err := system.RemoveSudoers(env.Root()); err != nil {
+		log.Printf("Failed removing sudo rules: %v", err)
+		allErrors = append(allErrors, err)
+	} else if removed {
+		log.Printf("Removed sudo rules from %s", system.SudoersPath)
 	}
 
-	if len(cfg.RunCmd) > 0 {
-		fullScript := strings.Join(cfg.RunCmd, "\n")
-		err := system.RunScript(fullScript)
+	// Members are added once users exist, so that users created above can
+	// be listed as members.
+	for _, group := range cfg.Groups {
+		if group.Name == "" || len(group.Members) == 0 {
+			continue
+		}
+		if err := system.AddGroupMembers(&group, um, env.Root()); err != nil {
+			log.Printf("Failed adding members to group '%s': %v", group.Name, err)
+			allErrors = append(allErrors, err)
+		} else {
+			log.Printf("Updated members of group '%s'", group.Name)
+		}
+	}
+
+	if cfg.ChPasswd != nil && len(cfg.ChPasswd.List) > 0 {
+		random, errs := applyChPasswd(*cfg.ChPasswd, um)
+		if len(random) > 0 {
+			status.RandomPasswords = random
+		}
+		allErrors = append(allErrors, errs...)
+	}
+
+	if len(cfg.SSHAuthorizedKeys) > 0 || system.UserExists(&config.User{Name: "root"}, env.Root()) {
+		err := system.AuthorizeSSHKeys("root", env.SSHKeyName(), cfg.SSHAuthorizedKeys, sshKeyOptions(cfg, "root"), env.Root())
 		if err != nil {
-			log.Println("Error running runcmd script, trying to continue")
 			allErrors = append(allErrors, err)
 		} else {
+			log.Printf("Authorized SSH keys for root user")
+		}
+	}
+
+	allErrors = append(allErrors, applySSHD(cfg, env, status)...)
+
+	// Packages come last so that runcmd can use them, right after the
+	// repositories they come from.
+	allErrors = append(allErrors, applyAPKRepos(cfg, env)...)
+	allErrors = append(allErrors, applyPackages(cfg, env, status)...)
+
+	if len(cfg.RunCmd) > 0 {
+		results, errs, _ := runCommands("runcmd", cfg.RunCmd, env)
+		status.RunCmd = results
+		allErrors = append(allErrors, errs...)
+		if len(errs) == 0 {
 			log.Printf("Successfully ran runcmd commands")
 		}
 	}
@@ -15,10 +15,17 @@
 package initialize
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/datasource"
 	"github.com/elotl/cloud-init/network"
 	"github.com/elotl/cloud-init/system"
 )
@@ -297,3 +304,122 @@ func TestProcessUnits(t *testing.T) {
 		}
 	}
 }
+
+func TestApplyBootCmd(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	env := NewEnvironment(dir, "", "/workspace", "", datasource.Metadata{InstanceID: "i-1234"})
+	instanceFile := path.Join(dir, "instance-id")
+	cfg := config.CloudConfig{
+		BootCmd: []config.Command{
+			{Shell: fmt.Sprintf("echo -n $INSTANCE_ID > %s", instanceFile)},
+			{Shell: "exit 1"},
+			{Shell: "exit 2", AbortOnFailure: true},
+			{Shell: fmt.Sprintf("touch %s", path.Join(dir, "skipped"))},
+		},
+		WriteFiles: []config.File{{Path: "/foo", Content: "bar"}},
+	}
+
+	err = Apply(cfg, nil, env)
+	if err == nil {
+		t.Fatalf("bad error: want bootcmd failures, got nil")
+	}
+	if errs := err.(interface{ Errors() []error }).Errors(); len(errs) != 2 {
+		t.Errorf("bad errors: want 2 bootcmd failures, got %v", errs)
+	}
+
+	if id, err := ioutil.ReadFile(instanceFile); err != nil || string(id) != "i-1234" {
+		t.Errorf("bad INSTANCE_ID: want %q, got %q (%v)", "i-1234", id, err)
+	}
+	for _, p := range []string{"skipped", "foo"} {
+		if _, err := os.Stat(path.Join(dir, p)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to not exist after aborting, got err: %v", p, err)
+		}
+	}
+}
+
+func TestApplyStaleSudoers(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Rules left by an earlier boot go once no user has any.
+	sudoers := path.Join(dir, system.SudoersPath)
+	os.MkdirAll(path.Dir(sudoers), 0755)
+	ioutil.WriteFile(sudoers, []byte("core ALL=(ALL) NOPASSWD:ALL\n"), 0440)
+
+	env := NewEnvironment(dir, "", "/workspace", "", datasource.Metadata{InstanceID: "i-1234"})
+	cfg := config.CloudConfig{Users: []config.User{{Name: "core"}}}
+	if err := Apply(cfg, nil, env); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := os.Stat(sudoers); !os.IsNotExist(err) {
+		t.Errorf("Unexpected stale sudoers: %v", err)
+	}
+}
+
+func TestApplyRunCmd(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	env := NewEnvironment(dir, "", "/workspace", "", datasource.Metadata{InstanceID: "i-1234"})
+	cfg := config.CloudConfig{
+		RunCmd: []config.Command{
+			{Shell: "echo first"},
+			{Args: []string{"/bin/sh", "-c", "echo $INSTANCE_ID $FOO; exit 4"}, Environment: map[string]string{"FOO": "bar"}},
+			{Shell: "exit 5", AbortOnFailure: true},
+			{Shell: "echo skipped"},
+		},
+	}
+
+	err = Apply(cfg, nil, env)
+	if err == nil {
+		t.Fatalf("bad error: want runcmd failures, got nil")
+	}
+
+	contents, err := ioutil.ReadFile(path.Join(env.Workspace(), "runcmd.log"))
+	if err != nil {
+		t.Fatalf("Unable to read runcmd log: %v", err)
+	}
+	log := string(contents)
+	for _, s := range []string{"first\n", "i-1234 bar\n", "exit status 4", "exit status 5"} {
+		if !strings.Contains(log, s) {
+			t.Errorf("bad runcmd log: want %q in %q", s, log)
+		}
+	}
+	if strings.Contains(log, "skipped") {
+		t.Errorf("bad runcmd log: entry after abort was run: %q", log)
+	}
+	if _, err := os.Stat(path.Join(env.Workspace(), "bootcmd.log")); !os.IsNotExist(err) {
+		t.Errorf("Unexpected bootcmd log without bootcmd: %v", err)
+	}
+
+	contents, err = ioutil.ReadFile(path.Join(env.Workspace(), "status.json"))
+	if err != nil {
+		t.Fatalf("Unable to read status: %v", err)
+	}
+	var status Status
+	if err := json.Unmarshal(contents, &status); err != nil {
+		t.Fatalf("Unable to parse status: %v", err)
+	}
+	if len(status.RunCmd) != 3 {
+		t.Fatalf("bad runcmd results: want 3, got %+v", status.RunCmd)
+	}
+	for i, exit := range []int{0, 4, 5} {
+		if status.RunCmd[i].ExitStatus != exit {
+			t.Errorf("bad exit status for entry %d: want %d, got %d", i, exit, status.RunCmd[i].ExitStatus)
+		}
+	}
+	if len(status.Errors) != 2 {
+		t.Errorf("bad status errors: want 2, got %v", status.Errors)
+	}
+}
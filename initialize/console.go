@@ -0,0 +1,38 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"log"
+	"os"
+)
+
+// consolePath is where messages meant for the operator of the machine are
+// printed, so they show up in the serial console output of the instance.
+var consolePath = "/dev/console"
+
+// printToConsole logs msg and also writes it to the console, if possible.
+func printToConsole(msg string) {
+	log.Print(msg)
+	f, err := os.OpenFile(consolePath, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		log.Printf("Unable to open %s: %v", consolePath, err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.WriteString(msg + "\n"); err != nil {
+		log.Printf("Unable to write to %s: %v", consolePath, err)
+	}
+}
@@ -33,6 +33,7 @@ type Environment struct {
 	configRoot    string
 	workspace     string
 	sshKeyName    string
+	instanceID    string
 	substitutions map[string]string
 }
 
@@ -50,7 +51,13 @@ func NewEnvironment(root, configRoot, workspace, sshKeyName string, metadata dat
 		"$public_ipv6":  firstNonNull(metadata.PublicIPv6, os.Getenv("MILPA_PUBLIC_IPV6")),
 		"$private_ipv6": firstNonNull(metadata.PrivateIPv6, os.Getenv("MILPA_PRIVATE_IPV6")),
 	}
-	return &Environment{root, configRoot, workspace, sshKeyName, substitutions}
+	// Fall back to the machine ID for datasources which don't provide an
+	// instance ID so commands always have something to key off of.
+	instanceID := metadata.InstanceID
+	if instanceID == "" {
+		instanceID = system.MachineID(root)
+	}
+	return &Environment{root, configRoot, workspace, sshKeyName, instanceID, substitutions}
 }
 
 func (e *Environment) Workspace() string {
@@ -65,7 +72,12 @@ func (e *Environment) ConfigRoot() string {
 	return e.configRoot
 }
 
+// SSHKeyName returns the name SSH keys are authorized under, which defaults
+// to DefaultSSHKeyName.
 func (e *Environment) SSHKeyName() string {
+	if e.sshKeyName == "" {
+		return DefaultSSHKeyName
+	}
 	return e.sshKeyName
 }
 
@@ -73,6 +85,10 @@ func (e *Environment) SetSSHKeyName(name string) {
 	e.sshKeyName = name
 }
 
+func (e *Environment) InstanceID() string {
+	return e.instanceID
+}
+
 // Apply goes through the map of substitutions and replaces all instances of
 // the keys with their respective values. It supports escaping substitutions
 // with a leading '\'.
@@ -0,0 +1,51 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"log"
+	"strings"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/system"
+)
+
+// applyEtcHosts renders the entries of /etc/hosts for the names of the host
+// when manage_etc_hosts is set. The names are those of the cloud-config,
+// or the current hostname if it is preserved or not configured.
+func applyEtcHosts(cfg config.CloudConfig, env *Environment) error {
+	tmpl, err := system.EtcHosts{EtcHosts: cfg.ManageEtcHosts}.Template(env.Root())
+	if err != nil || tmpl == "" {
+		return err
+	}
+
+	hostname, fqdn := cfg.HostnameFQDN()
+	if cfg.PreserveHostname || hostname == "" {
+		if fqdn, err = system.Hostname(); err != nil {
+			return err
+		}
+		hostname, _ = config.SplitHostname(fqdn)
+	}
+
+	entries := strings.NewReplacer("$fqdn", fqdn, "$hostname", hostname).Replace(tmpl)
+	changed, err := system.UpdateEtcHosts(env.Apply(entries), env.Root())
+	if err != nil {
+		return err
+	}
+	if changed {
+		log.Printf("Updated %s", system.EtcHostsPath)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/datasource"
+	"github.com/elotl/cloud-init/system"
+)
+
+func TestApplyEtcHosts(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := config.CloudConfig{Hostname: "core", FQDN: "core.example.com", ManageEtcHosts: "true"}
+	env := NewEnvironment(dir, "", "", "", datasource.Metadata{PrivateIPv4: net.ParseIP("10.0.0.2")})
+	if err := applyEtcHosts(cfg, env); err != nil {
+		t.Fatalf("Unexpected error while applying manage_etc_hosts: %v", err)
+	}
+
+	contents, err := ioutil.ReadFile(path.Join(dir, system.EtcHostsPath))
+	if err != nil {
+		t.Fatalf("Unable to read /etc/hosts: %v", err)
+	}
+	expected := `# BEGIN cloud-init managed entries
+127.0.0.1 localhost
+127.0.1.1 core.example.com core
+10.0.0.2 core.example.com core
+::1 localhost ip6-localhost ip6-loopback
+ff02::1 ip6-allnodes
+ff02::2 ip6-allrouters
+# END cloud-init managed entries
+`
+	if string(contents) != expected {
+		t.Errorf("bad /etc/hosts: want %q, got %q", expected, contents)
+	}
+}
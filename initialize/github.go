@@ -16,17 +16,9 @@ package initialize
 
 import (
 	"fmt"
-
-	"github.com/elotl/cloud-init/system"
 )
 
-func SSHImportGithubUser(system_user string, github_user string) error {
-	url := fmt.Sprintf("https://api.github.com/users/%s/keys", github_user)
-	keys, err := fetchUserKeys(url)
-	if err != nil {
-		return err
-	}
-
-	//key_name := fmt.Sprintf("github-%s", github_user)
-	return system.AuthorizeSSHKeys(system_user, keys)
+// githubKeysURL returns the URL of the public SSH keys of a GitHub user.
+func githubKeysURL(github_user string) string {
+	return fmt.Sprintf("https://api.github.com/users/%s/keys", github_user)
 }
@@ -0,0 +1,61 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/system"
+)
+
+var loadKernelModule = system.LoadKernelModule
+
+// applyKernelModules configures the kernel modules of the cloud-config to
+// be loaded on boot, with their parameters, and loads them.
+func applyKernelModules(cfg config.CloudConfig, env *Environment) []error {
+	if len(cfg.KernelModules) == 0 {
+		return nil
+	}
+	written, err := system.WriteKernelModuleConfig(cfg.KernelModules, env.Root())
+	for _, p := range written {
+		log.Printf("Updated %s", p)
+	}
+	if err != nil {
+		return []error{err}
+	}
+
+	// The running kernel is not the one of another root, which loads its
+	// modules once it boots.
+	if filepath.Clean(env.Root()) != "/" {
+		return nil
+	}
+	return loadKernelModules(cfg.KernelModules)
+}
+
+// loadKernelModules loads each of the kernel modules, carrying on past
+// those which fail.
+func loadKernelModules(modules []config.KernelModule) []error {
+	var errs []error
+	for _, m := range modules {
+		if err := loadKernelModule(m.Name, m.Params()...); err != nil {
+			log.Printf("Failed loading kernel module %s: %v", m.Name, err)
+			errs = append(errs, fmt.Errorf("loading kernel module %s: %v", m.Name, err))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,74 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/datasource"
+	"github.com/elotl/cloud-init/system"
+)
+
+func TestApplyKernelModules(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var loaded []string
+	loadKernelModule = func(name string, params ...string) error {
+		loaded = append(loaded, fmt.Sprint(name, params))
+		if name == "missing" {
+			return errors.New("module not found")
+		}
+		return nil
+	}
+	defer func() { loadKernelModule = system.LoadKernelModule }()
+
+	env := NewEnvironment(dir, "", "", "", datasource.Metadata{})
+	cfg := config.CloudConfig{KernelModules: []config.KernelModule{
+		{Name: "br_netfilter"},
+		{Name: "missing"},
+		{Name: "bonding", Parameters: map[string]string{"mode": "4"}},
+	}}
+	// Modules are only configured for another root.
+	if errs := applyKernelModules(cfg, env); len(errs) != 0 {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+	if len(loaded) != 0 {
+		t.Errorf("Unexpected loaded modules for %s: %v", dir, loaded)
+	}
+	for _, p := range []string{system.ModulesLoadPath, system.ModprobeOptionsPath} {
+		if _, err := os.Stat(path.Join(dir, p)); err != nil {
+			t.Errorf("Missing %s: %v", p, err)
+		}
+	}
+
+	// A module which fails to load does not stop the others.
+	if errs := loadKernelModules(cfg.KernelModules); len(errs) != 1 {
+		t.Fatalf("bad errors: want 1, got %v", errs)
+	}
+	if expected := []string{"br_netfilter[]", "missing[]", "bonding[mode=4]"}; !reflect.DeepEqual(expected, loaded) {
+		t.Errorf("bad loaded modules: want %v, got %v", expected, loaded)
+	}
+}
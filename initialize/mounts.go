@@ -0,0 +1,122 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/system"
+)
+
+var newMounter = system.NewMounter
+
+// applyMounts creates and activates the swap file of the cloud-config and
+// writes the entries of its mounts and swap file to /etc/fstab, then mounts
+// them.
+func applyMounts(cfg config.CloudConfig, env *Environment) []error {
+	if len(cfg.Mounts) == 0 && cfg.Swap == nil {
+		return nil
+	}
+	mounter := newMounter(env.Root())
+	mounts := cfg.Mounts
+
+	var errs []error
+	swapFile := ""
+	if cfg.Swap != nil {
+		filename := cfg.Swap.Filename
+		if filename == "" {
+			filename = system.DefaultSwapFile
+		}
+		if ok, err := applySwapFile(*cfg.Swap, filename, mounter, env); err != nil {
+			log.Printf("Failed creating swap file %s: %v", filename, err)
+			errs = append(errs, err)
+		} else if ok {
+			swapFile = filename
+			mounts = append(mounts, config.Mount{
+				Device:     filename,
+				MountPoint: "none",
+				Type:       "swap",
+				Options:    "sw",
+				Freq:       "0",
+				Passno:     "0",
+			})
+		}
+	}
+
+	changed, err := system.UpdateFstab(mounts, env.Root())
+	if err != nil {
+		log.Printf("Failed updating %s: %v", system.FstabPath, err)
+		return append(errs, err)
+	}
+	if changed {
+		log.Printf("Updated %s", system.FstabPath)
+	}
+
+	if swapFile != "" {
+		if err := mounter.Swapon(swapFile); err != nil {
+			log.Printf("Failed activating swap file %s: %v", swapFile, err)
+			errs = append(errs, err)
+		}
+	}
+
+	mount := false
+	for _, m := range cfg.Mounts {
+		if m.Removes() || !strings.HasPrefix(m.MountPoint, "/") {
+			continue
+		}
+		mountPoint, err := system.SecureJoin(env.Root(), m.MountPoint)
+		if err == nil {
+			err = system.EnsureDirectoryExists(mountPoint)
+		}
+		if err != nil {
+			log.Printf("Failed creating mount point %s: %v", m.MountPoint, err)
+			errs = append(errs, err)
+			continue
+		}
+		mount = true
+	}
+	if mount {
+		if err := mounter.MountAll(); err != nil {
+			log.Printf("Failed mounting %s: %v", system.FstabPath, err)
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// applySwapFile creates the swap file unless it exists, and formats it. A
+// file which can not be formatted is removed so that it is created again.
+// It reports whether there is a swap file, which a size of 0 disables.
+func applySwapFile(swap config.Swap, filename string, mounter system.Mounter, env *Environment) (bool, error) {
+	size, err := system.SwapSize(swap, env.Root())
+	if err != nil || size == 0 {
+		return false, err
+	}
+	created, err := system.CreateSwapFile(swap, size, env.Root())
+	if err != nil || !created {
+		return err == nil, err
+	}
+	log.Printf("Created swap file %s of %d bytes", filename, size)
+	if err := mounter.Mkswap(filename); err != nil {
+		if fullpath, jerr := system.SecureJoin(env.Root(), filename); jerr == nil {
+			os.Remove(fullpath)
+		}
+		return false, err
+	}
+	return true, nil
+}
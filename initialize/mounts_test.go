@@ -0,0 +1,111 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/datasource"
+	"github.com/elotl/cloud-init/system"
+)
+
+type testMounter struct {
+	calls      []string
+	mkswapFail bool
+}
+
+func (m *testMounter) Mkswap(path string) error {
+	m.calls = append(m.calls, "mkswap "+path)
+	if m.mkswapFail {
+		return errors.New("mkswap failed")
+	}
+	return nil
+}
+
+func (m *testMounter) Swapon(path string) error {
+	m.calls = append(m.calls, "swapon "+path)
+	return nil
+}
+
+func (m *testMounter) MountAll() error {
+	m.calls = append(m.calls, "mount -a")
+	return nil
+}
+
+func TestApplyMounts(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	mounter := &testMounter{mkswapFail: true}
+	newMounter = func(string) system.Mounter { return mounter }
+	defer func() { newMounter = system.NewMounter }()
+
+	env := NewEnvironment(dir, "", "", "", datasource.Metadata{})
+	cfg := config.CloudConfig{
+		Mounts: []config.Mount{{Device: "sdb", MountPoint: "/var/lib/itzo"}},
+		Swap:   &config.Swap{Size: "1M"},
+	}
+
+	// A swap file which can not be formatted is left out.
+	if errs := applyMounts(cfg, env); len(errs) != 1 {
+		t.Fatalf("bad errors: want 1, got %v", errs)
+	}
+	if _, err := os.Stat(path.Join(dir, system.DefaultSwapFile)); !os.IsNotExist(err) {
+		t.Errorf("Unexpected swap file left after mkswap failed: %v", err)
+	}
+	if calls := []string{"mkswap /swap.img", "mount -a"}; !reflect.DeepEqual(calls, mounter.calls) {
+		t.Errorf("bad calls: want %v, got %v", calls, mounter.calls)
+	}
+
+	mounter.mkswapFail = false
+	mounter.calls = nil
+	if errs := applyMounts(cfg, env); len(errs) != 0 {
+		t.Fatalf("Unexpected errors while applying mounts: %v", errs)
+	}
+	if calls := []string{"mkswap /swap.img", "swapon /swap.img", "mount -a"}; !reflect.DeepEqual(calls, mounter.calls) {
+		t.Errorf("bad calls: want %v, got %v", calls, mounter.calls)
+	}
+	if info, err := os.Stat(path.Join(dir, "var/lib/itzo")); err != nil || !info.IsDir() {
+		t.Errorf("Missing mount point: %v", err)
+	}
+	contents, err := ioutil.ReadFile(path.Join(dir, system.FstabPath))
+	if err != nil {
+		t.Fatalf("Unable to read fstab: %v", err)
+	}
+	for _, entry := range []string{"/dev/sdb\t/var/lib/itzo\t", "/swap.img\tnone\tswap\t"} {
+		if !strings.Contains(string(contents), entry) {
+			t.Errorf("Missing entry %q in fstab %q", entry, contents)
+		}
+	}
+
+	// The existing swap file is only activated.
+	mounter.calls = nil
+	if errs := applyMounts(cfg, env); len(errs) != 0 {
+		t.Fatalf("Unexpected errors while reapplying mounts: %v", errs)
+	}
+	if calls := []string{"swapon /swap.img", "mount -a"}; !reflect.DeepEqual(calls, mounter.calls) {
+		t.Errorf("bad calls: want %v, got %v", calls, mounter.calls)
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"log"
+	"path/filepath"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/system"
+)
+
+// applyNTP configures the NTP client of the host with the servers and pools
+// of the cloud-config, and restarts it to use them.
+func applyNTP(cfg config.CloudConfig, env *Environment) error {
+	if cfg.NTP == nil {
+		return nil
+	}
+	ntp := system.NTP{NTP: *cfg.NTP}
+	client, err := ntp.Client(env.Root())
+	if err != nil {
+		return err
+	}
+	written, err := system.WriteNTPConfig(ntp, client, env.Root())
+	if err != nil || written == "" {
+		return err
+	}
+	log.Printf("Updated %s", written)
+
+	// There is no NTP client to restart when preparing another root.
+	if filepath.Clean(env.Root()) != "/" {
+		return nil
+	}
+	service, err := ntp.Service(client, env.Root())
+	if err != nil {
+		return err
+	}
+	return restartService(service)
+}
@@ -0,0 +1,61 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/datasource"
+	"github.com/elotl/cloud-init/system"
+)
+
+func TestApplyNTP(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	env := NewEnvironment(dir, "", "", "", datasource.Metadata{})
+	if err := applyNTP(config.CloudConfig{}, env); err != nil {
+		t.Fatalf("Unexpected error without ntp: %v", err)
+	}
+
+	// Without a client installed, nothing can be configured.
+	cfg := config.CloudConfig{NTP: &config.NTP{Servers: []string{"10.0.0.1"}}}
+	if err := applyNTP(cfg, env); err == nil {
+		t.Fatalf("Expected an error without an NTP client")
+	}
+
+	cfg.NTP.NTPClient = system.NTPClientTimesyncd
+	if err := applyNTP(cfg, env); err != nil {
+		t.Fatalf("Unexpected error while applying ntp: %v", err)
+	}
+	contents, err := ioutil.ReadFile(path.Join(dir, system.TimesyncdDropInPath))
+	if err != nil {
+		t.Fatalf("Unable to read the timesyncd drop-in: %v", err)
+	}
+	expected := `# Generated by cloud-init from the ntp of the cloud-config.
+[Time]
+NTP=10.0.0.1
+`
+	if string(contents) != expected {
+		t.Errorf("bad timesyncd drop-in: want %q, got %q", expected, contents)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/system"
+)
+
+var newPackageManager = system.NewPackageManager
+
+// applyPackages updates the package index, upgrades the installed packages
+// and installs those of the cloud-config, recording the outcome of each
+// package in the status. Installing packages implies updating the index.
+// This happens once per instance, unless it fails.
+func applyPackages(cfg config.CloudConfig, env *Environment, status *Status) []error {
+	if !cfg.PackageUpdate && !cfg.PackageUpgrade && len(cfg.Packages) == 0 {
+		return nil
+	}
+	if RanForInstance("packages", env.InstanceID(), env.Workspace()) {
+		return nil
+	}
+	pm, err := newPackageManager(env.Root())
+	if err != nil {
+		return []error{err}
+	}
+
+	var errs []error
+	log.Printf("Updating the package index with %s", pm.Name())
+	if err := system.RetryPackageCommand(pm.Update); err != nil {
+		log.Printf("Failed updating the package index: %v", err)
+		errs = append(errs, err)
+	}
+	if cfg.PackageUpgrade {
+		log.Printf("Upgrading packages with %s", pm.Name())
+		if err := system.RetryPackageCommand(pm.Upgrade); err != nil {
+			log.Printf("Failed upgrading packages: %v", err)
+			errs = append(errs, err)
+		}
+	}
+	if len(cfg.Packages) > 0 {
+		// Packages which are invalid as given fail without being
+		// installed, in their place among the others.
+		var valid []config.Package
+		for _, p := range cfg.Packages {
+			if p.Invalid == "" {
+				valid = append(valid, p)
+			}
+		}
+		log.Printf("Installing %d packages with %s", len(valid), pm.Name())
+		results := system.InstallPackages(pm, valid)
+		status.Packages = nil
+		for _, p := range cfg.Packages {
+			if p.Invalid != "" {
+				status.Packages = append(status.Packages, system.PackageResult{Name: p.Name, Version: p.Version, Error: p.Invalid})
+			} else {
+				status.Packages = append(status.Packages, results[0])
+				results = results[1:]
+			}
+		}
+		for _, result := range status.Packages {
+			if result.Error != "" {
+				log.Printf("Failed installing package %s: %s", result.Name, result.Error)
+				errs = append(errs, fmt.Errorf("failed installing package %s: %s", result.Name, result.Error))
+			}
+		}
+	}
+
+	// Only an upgrade or installation which went through can require a
+	// reboot, and whether the running system needs one says nothing about
+	// another root.
+	changed := cfg.PackageUpgrade || len(cfg.Packages) > 0
+	if changed && len(errs) == 0 && filepath.Clean(env.Root()) == "/" {
+		required, err := pm.RebootRequired()
+		if err != nil {
+			log.Printf("Failed checking whether a reboot is required: %v", err)
+		}
+		status.RebootRequired = required
+	}
+
+	if len(errs) == 0 {
+		if err := PersistInstanceInWorkspace("packages", env.InstanceID(), env.Workspace()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,140 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/datasource"
+	"github.com/elotl/cloud-init/system"
+)
+
+type testPackageManager struct {
+	calls []string
+}
+
+func (*testPackageManager) Name() string { return "test" }
+
+func (m *testPackageManager) Update() error {
+	m.calls = append(m.calls, "update")
+	return nil
+}
+
+func (m *testPackageManager) Upgrade() error {
+	m.calls = append(m.calls, "upgrade")
+	return nil
+}
+
+func (m *testPackageManager) Install(pkgs []config.Package) error {
+	for _, p := range pkgs {
+		m.calls = append(m.calls, "install "+p.String())
+		if p.Name == "missing" {
+			return errors.New("no such package")
+		}
+	}
+	return nil
+}
+
+func (m *testPackageManager) RebootRequired() (bool, error) {
+	return true, nil
+}
+
+func TestApplyPackages(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	system.PackageRetryDelay = 0
+	defer func() { system.PackageRetryDelay = 5 * time.Second }()
+
+	pm := &testPackageManager{}
+	newPackageManager = func(string) (system.PackageManager, error) { return pm, nil }
+	defer func() { newPackageManager = system.NewPackageManager }()
+
+	env := NewEnvironment(dir, "", "workspace", "", datasource.Metadata{InstanceID: "i-1"})
+	status := &Status{}
+	if errs := applyPackages(config.CloudConfig{}, env, status); len(errs) != 0 || len(pm.calls) != 0 {
+		t.Fatalf("Unexpected package management without packages: %v, %v", errs, pm.calls)
+	}
+
+	cfg := config.CloudConfig{
+		PackageUpgrade: true,
+		Packages: []config.Package{
+			{Name: "docker", Version: "20.1", Invalid: "not a string"},
+			{Name: "curl", Version: "7.0"},
+			{Name: "missing"},
+		},
+	}
+	errs := applyPackages(cfg, env, status)
+	if len(errs) != 2 || errs[0].Error() != "failed installing package docker: not a string" || errs[1].Error() != "failed installing package missing: no such package" {
+		t.Errorf("bad errors: %v", errs)
+	}
+	expected := []system.PackageResult{
+		{Name: "docker", Version: "20.1", Error: "not a string"},
+		{Name: "curl", Version: "7.0"},
+		{Name: "missing", Error: "no such package"},
+	}
+	if !reflect.DeepEqual(expected, status.Packages) {
+		t.Errorf("bad package results: want %v, got %v", expected, status.Packages)
+	}
+	// A reboot is only looked into for the running system.
+	if status.RebootRequired {
+		t.Errorf("Unexpected reboot required for %s", dir)
+	}
+
+	// Packages are managed again until they all install.
+	cfg.Packages = cfg.Packages[1:2]
+	pm.calls = nil
+	if errs := applyPackages(cfg, env, status); len(errs) != 0 {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+	if calls := []string{"update", "upgrade", "install curl=7.0"}; !reflect.DeepEqual(calls, pm.calls) {
+		t.Errorf("bad calls: want %v, got %v", calls, pm.calls)
+	}
+
+	pm.calls = nil
+	if errs := applyPackages(cfg, env, status); len(errs) != 0 || len(pm.calls) != 0 {
+		t.Errorf("Unexpected package management for the same instance: %v, %v", errs, pm.calls)
+	}
+
+	// On the running system, a reboot is looked into once packages were
+	// upgraded or installed without failing.
+	for _, tt := range []struct {
+		cfg    config.CloudConfig
+		reboot bool
+	}{
+		{config.CloudConfig{PackageUpdate: true}, false},
+		{config.CloudConfig{Packages: []config.Package{{Name: "missing"}}}, false},
+		{config.CloudConfig{PackageUpgrade: true}, true},
+		{config.CloudConfig{Packages: []config.Package{{Name: "curl"}}}, true},
+	} {
+		env := NewEnvironment("/", "", dir, "", datasource.Metadata{InstanceID: "i-2"})
+		status := &Status{}
+		applyPackages(tt.cfg, env, status)
+		if status.RebootRequired != tt.reboot {
+			t.Errorf("bad reboot required (%+v): want %t, got %t", tt.cfg, tt.reboot, status.RebootRequired)
+		}
+		os.Remove(filepath.Join(dir, "instance", "packages"))
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"errors"
+	"log"
+	"path/filepath"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/system"
+)
+
+var newPowerManager = system.NewPowerManager
+
+// applyPowerState changes the power state as given by power_state if its
+// condition holds, once per instance. Otherwise the system is rebooted if
+// upgraded packages require it and the cloud-config allows it.
+func applyPowerState(cfg config.CloudConfig, status *Status, env *Environment) error {
+	// There is no power state to change when preparing another root.
+	if filepath.Clean(env.Root()) != "/" {
+		return nil
+	}
+	if ps := cfg.PowerState; ps != nil && !RanForInstance("power_state", env.InstanceID(), env.Workspace()) {
+		delay, err := ps.DelayDuration()
+		if err != nil {
+			return err
+		}
+		if ps.Mode == "" {
+			return errors.New("power_state has no mode")
+		}
+		if powerConditionHolds(*ps, env) {
+			// Recorded ahead of the shutdown, which may not return,
+			// so that the next boot does not shut down again.
+			if err := PersistInstanceInWorkspace("power_state", env.InstanceID(), env.Workspace()); err != nil {
+				return err
+			}
+			log.Printf("Changing power state to %s in %v", ps.Mode, delay)
+			return newPowerManager().Shutdown(ps.Mode, delay, ps.Message)
+		}
+		log.Printf("Condition of power_state does not hold, leaving power state unchanged")
+	}
+	if status.RebootRequired && cfg.PackageRebootIfRequired {
+		log.Printf("Rebooting as required by the upgraded packages")
+		return newPowerManager().Shutdown(system.PowerReboot, 0, "Rebooting for upgraded packages")
+	}
+	return nil
+}
+
+// powerConditionHolds runs the condition command of the power state, if it
+// has one, with the timeout of the power state unless it sets its own.
+func powerConditionHolds(ps config.PowerState, env *Environment) bool {
+	if ps.Condition == nil {
+		return true
+	}
+	if ps.Condition.Command == nil {
+		return ps.Condition.Value
+	}
+	cmd := *ps.Condition.Command
+	if cmd.Timeout == 0 {
+		cmd.Timeout = ps.Timeout
+		if cmd.Timeout == 0 {
+			cmd.Timeout = config.DefaultPowerStateTimeout
+		}
+	}
+	results, _, _ := runCommands("power_state", []config.Command{cmd}, env)
+	return len(results) == 1 && results[0].ExitStatus == 0 && !results[0].TimedOut
+}
@@ -0,0 +1,129 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/datasource"
+	"github.com/elotl/cloud-init/system"
+)
+
+type testPowerManager struct {
+	calls []string
+}
+
+func (m *testPowerManager) Shutdown(mode string, delay time.Duration, message string) error {
+	m.calls = append(m.calls, fmt.Sprintf("%s %v %q", mode, delay, message))
+	return nil
+}
+
+func TestApplyPowerState(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	pm := &testPowerManager{}
+	newPowerManager = func() system.PowerManager { return pm }
+	defer func() { newPowerManager = system.NewPowerManager }()
+
+	for i, tt := range []struct {
+		cfg    config.CloudConfig
+		reboot bool
+		calls  []string
+		err    bool
+	}{
+		{
+			cfg: config.CloudConfig{},
+		},
+		{
+			cfg:   config.CloudConfig{PowerState: &config.PowerState{Mode: "poweroff", Delay: "+5", Message: "bye"}},
+			calls: []string{`poweroff 5m0s "bye"`},
+		},
+		{
+			cfg: config.CloudConfig{PowerState: &config.PowerState{Mode: "halt", Condition: &config.PowerCondition{Value: false}}},
+		},
+		{
+			cfg:   config.CloudConfig{PowerState: &config.PowerState{Mode: "halt", Condition: &config.PowerCondition{Command: &config.Command{Shell: "exit 0"}}}},
+			calls: []string{`halt 0s ""`},
+		},
+		{
+			cfg: config.CloudConfig{PowerState: &config.PowerState{Mode: "halt", Condition: &config.PowerCondition{Command: &config.Command{Args: []string{"false"}}}}},
+		},
+		{
+			// The condition is killed once the timeout expires.
+			cfg: config.CloudConfig{PowerState: &config.PowerState{Mode: "halt", Timeout: 1, Condition: &config.PowerCondition{Command: &config.Command{Shell: "sleep 10"}}}},
+		},
+		{
+			cfg: config.CloudConfig{PowerState: &config.PowerState{Delay: "now"}},
+			err: true,
+		},
+		{
+			cfg:    config.CloudConfig{PackageRebootIfRequired: true},
+			reboot: true,
+			calls:  []string{`reboot 0s "Rebooting for upgraded packages"`},
+		},
+		{
+			cfg:    config.CloudConfig{},
+			reboot: true,
+		},
+		{
+			// power_state takes precedence over the reboot for packages.
+			cfg:    config.CloudConfig{PackageRebootIfRequired: true, PowerState: &config.PowerState{Mode: "poweroff"}},
+			reboot: true,
+			calls:  []string{`poweroff 0s ""`},
+		},
+		{
+			cfg:    config.CloudConfig{PackageRebootIfRequired: true, PowerState: &config.PowerState{Mode: "poweroff", Condition: &config.PowerCondition{Value: false}}},
+			reboot: true,
+			calls:  []string{`reboot 0s "Rebooting for upgraded packages"`},
+		},
+	} {
+		pm.calls = nil
+		env := NewEnvironment("/", "", dir, "", datasource.Metadata{InstanceID: fmt.Sprintf("i-%d", i)})
+		err := applyPowerState(tt.cfg, &Status{RebootRequired: tt.reboot}, env)
+		if (err != nil) != tt.err {
+			t.Errorf("bad error (%+v): want %t, got %v", tt.cfg.PowerState, tt.err, err)
+		}
+		if !reflect.DeepEqual(tt.calls, pm.calls) {
+			t.Errorf("bad calls (%+v): want %v, got %v", tt.cfg.PowerState, tt.calls, pm.calls)
+		}
+	}
+
+	// The power state changes once per instance, and only for the running
+	// system.
+	cfg := config.CloudConfig{PowerState: &config.PowerState{Mode: "poweroff"}}
+	pm.calls = nil
+	for _, env := range []*Environment{
+		NewEnvironment("/", "", dir, "", datasource.Metadata{InstanceID: "i-once"}),
+		NewEnvironment("/", "", dir, "", datasource.Metadata{InstanceID: "i-once"}),
+		NewEnvironment(dir, "", "workspace", "", datasource.Metadata{InstanceID: "i-other"}),
+	} {
+		if err := applyPowerState(cfg, &Status{}, env); err != nil {
+			t.Errorf("Unexpected error for %s: %v", env.Root(), err)
+		}
+	}
+	if calls := []string{`poweroff 0s ""`}; !reflect.DeepEqual(calls, pm.calls) {
+		t.Errorf("bad calls for the same instance and another root: want %v, got %v", calls, pm.calls)
+	}
+}
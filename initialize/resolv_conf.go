@@ -0,0 +1,52 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"log"
+	"path/filepath"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/system"
+)
+
+// applyResolvConf writes the resolver configuration of resolv_conf where
+// the manager of /etc/resolv.conf picks it up, and has the manager apply it.
+func applyResolvConf(cfg config.CloudConfig, env *Environment) error {
+	if cfg.ResolvConf == nil {
+		return nil
+	}
+	manager, err := system.ResolvConfManager(env.Root())
+	if err != nil {
+		return err
+	}
+	written, err := system.WriteResolvConf(system.ResolvConf{ResolvConf: *cfg.ResolvConf}, manager, env.Root())
+	if err != nil || written == "" {
+		return err
+	}
+	log.Printf("Updated %s", written)
+
+	// There is no manager to notify when preparing another root.
+	if filepath.Clean(env.Root()) != "/" {
+		return nil
+	}
+	switch manager {
+	case system.ResolvConfResolved:
+		return restartService("systemd-resolved")
+	case system.ResolvConfResolvconf:
+		return system.UpdateResolvconf()
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/datasource"
+	"github.com/elotl/cloud-init/system"
+)
+
+func TestApplyResolvConf(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// resolv.conf links to where resolvconf generates it.
+	os.MkdirAll(path.Join(dir, "etc"), 0755)
+	if err := os.Symlink("../run/resolvconf/resolv.conf", path.Join(dir, system.ResolvConfPath)); err != nil {
+		t.Fatalf("Unable to create symlink: %v", err)
+	}
+
+	env := NewEnvironment(dir, "", "", "", datasource.Metadata{})
+	if err := applyResolvConf(config.CloudConfig{}, env); err != nil {
+		t.Fatalf("Unexpected error without resolv_conf: %v", err)
+	}
+	if _, err := os.Stat(path.Join(dir, system.ResolvconfHeadPath)); !os.IsNotExist(err) {
+		t.Fatalf("Unexpected resolvconf head without resolv_conf: %v", err)
+	}
+
+	cfg := config.CloudConfig{ResolvConf: &config.ResolvConf{
+		Nameservers:   []string{"10.0.0.1"},
+		SearchDomains: []string{"example.com"},
+	}}
+	if err := applyResolvConf(cfg, env); err != nil {
+		t.Fatalf("Unexpected error while applying resolv_conf: %v", err)
+	}
+	contents, err := ioutil.ReadFile(path.Join(dir, system.ResolvconfHeadPath))
+	if err != nil {
+		t.Fatalf("Unable to read the resolvconf head: %v", err)
+	}
+	expected := `# Generated by cloud-init from the resolv_conf of the cloud-config.
+nameserver 10.0.0.1
+search example.com
+`
+	if string(contents) != expected {
+		t.Errorf("bad resolvconf head: want %q, got %q", expected, contents)
+	}
+	if _, err := os.Lstat(path.Join(dir, "run")); !os.IsNotExist(err) {
+		t.Errorf("Unexpected write through the resolv.conf symlink: %v", err)
+	}
+}
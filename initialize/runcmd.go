@@ -0,0 +1,80 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/system"
+)
+
+// runCommands runs the commands of a stage (e.g. "runcmd") one after the
+// other, appending their output to <stage>.log in the workspace. It returns
+// the result of every command that was run and an error for each one that
+// failed. abort is true if a failed command asked for the remaining stages to
+// be skipped, in which case the commands following it are not run either.
+func runCommands(stage string, cmds []config.Command, env *Environment) (results []system.CommandResult, errs []error, abort bool) {
+	// The log is only opened for stages with commands to run.
+	if len(cmds) == 0 {
+		return nil, nil, false
+	}
+
+	var output io.Writer
+	logPath := path.Join(env.Workspace(), fmt.Sprintf("%s.log", stage))
+	if logFile, err := openCommandLog(logPath); err != nil {
+		log.Printf("Failed opening %s, discarding %s output: %v", logPath, stage, err)
+		errs = append(errs, err)
+	} else {
+		defer logFile.Close()
+		output = logFile
+	}
+
+	cmdEnv := []string{fmt.Sprintf("INSTANCE_ID=%s", env.InstanceID())}
+	for i, cmd := range cmds {
+		log.Printf("Running %s entry %d: %s", stage, i, cmd)
+		if output != nil {
+			fmt.Fprintf(output, "==> %s entry %d: %s\n", stage, i, cmd)
+		}
+
+		result, err := system.RunCommand(cmd, cmdEnv, output)
+		results = append(results, result)
+		if output != nil {
+			fmt.Fprintf(output, "<== exit status %d after %.3fs\n", result.ExitStatus, result.Duration)
+		}
+
+		if err != nil {
+			log.Printf("Failed running %s entry %d: %v", stage, i, err)
+			errs = append(errs, fmt.Errorf("%s entry %d: %v", stage, i, err))
+			if cmd.AbortOnFailure {
+				return results, errs, true
+			}
+		} else {
+			log.Printf("Ran %s entry %d in %.3fs", stage, i, result.Duration)
+		}
+	}
+	return results, errs, false
+}
+
+func openCommandLog(logPath string) (*os.File, error) {
+	if err := system.EnsureDirectoryExists(path.Dir(logPath)); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+}
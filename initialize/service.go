@@ -0,0 +1,47 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"log"
+
+	"github.com/elotl/cloud-init/system"
+)
+
+// reloadService and restartService only log that they skip the service on
+// systems booted without a supported service manager.
+func reloadService(service string) error {
+	sm, err := system.NewServiceManager()
+	if err == system.ErrNoServiceManager {
+		log.Printf("Not reloading %s: %v", service, err)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	log.Printf("Reloading %s with %s", service, sm.Name())
+	return sm.Reload(service)
+}
+
+func restartService(service string) error {
+	sm, err := system.NewServiceManager()
+	if err == system.ErrNoServiceManager {
+		log.Printf("Not restarting %s: %v", service, err)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	log.Printf("Restarting %s with %s", service, sm.Name())
+	return sm.Restart(service)
+}
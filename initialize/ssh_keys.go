@@ -16,41 +16,101 @@ package initialize
 
 import (
 	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
 
+	"github.com/elotl/cloud-init/config"
 	"github.com/elotl/cloud-init/pkg"
 	"github.com/elotl/cloud-init/system"
 )
 
+// sshImportRetries bounds the attempts to fetch the keys of each
+// ssh_import_id, so that an unreachable endpoint does not hold up the boot.
+var sshImportRetries = 5
+
 type UserKey struct {
 	ID  int    `json:"id,omitempty"`
 	Key string `json:"key"`
 }
 
-func SSHImportKeysFromURL(system_user string, url string) error {
-	keys, err := fetchUserKeys(url)
-	if err != nil {
-		return err
+// importSSHKeys authorizes the keys of every ssh_import_id of the user under
+// a block of its own. Keys of an ID which can not be fetched are taken from
+// the last successful fetch cached in the workspace, with a warning in the
+// status. An ID which was never fetched has no keys to authorize, so it is
+// reported as an error and the keys of the other IDs are still authorized.
+// The keys are given options in place of their own unless options is empty.
+func importSSHKeys(user config.User, options string, env *Environment, status *Status) []error {
+	var errs []error
+	keys := []string{}
+	for _, id := range user.SSHImportIDs() {
+		fetched, err := fetchSSHImportID(id)
+		if err == nil {
+			log.Printf("Fetched %d SSH keys of %s for user '%s'", len(fetched), id, user.Name)
+			if err := PersistSSHImportInWorkspace(id, fetched, env.Workspace()); err != nil {
+				log.Printf("Failed caching SSH keys of %s: %v", id, err)
+			}
+			keys = append(keys, fetched...)
+			continue
+		}
+
+		cached, cacheErr := SSHImportFromWorkspace(id, env.Workspace())
+		if cacheErr != nil {
+			log.Printf("Failed fetching SSH keys of %s for user '%s': %v", id, user.Name, err)
+			errs = append(errs, fmt.Errorf("failed fetching SSH keys of %s for user %q: %v", id, user.Name, err))
+			continue
+		}
+		warning := fmt.Sprintf("using cached SSH keys of %s for user %q: %v", id, user.Name, err)
+		log.Printf("Warning: %s", warning)
+		status.Warnings = append(status.Warnings, warning)
+		keys = append(keys, cached...)
 	}
 
-	//key_name := fmt.Sprintf("coreos-cloudinit-%s", system_user)
-	return system.AuthorizeSSHKeys(system_user, keys)
+	if err := system.AuthorizeSSHKeys(user.Name, env.SSHKeyName()+"-ssh-import", keys, options, env.Root()); err != nil {
+		log.Printf("Error authorizing imported SSH keys for user '%s': %v", user.Name, err)
+		errs = append(errs, err)
+	}
+	return errs
 }
 
+// fetchSSHImportID fetches the keys of an ssh_import_id: either gh:<user>
+// for the keys of a GitHub user, or url:<url>.
+func fetchSSHImportID(id string) ([]string, error) {
+	switch {
+	case strings.HasPrefix(id, "gh:"):
+		return fetchUserKeys(githubKeysURL(strings.TrimPrefix(id, "gh:")))
+	case strings.HasPrefix(id, "url:"):
+		return fetchUserKeys(strings.TrimPrefix(id, "url:"))
+	default:
+		return nil, fmt.Errorf("unsupported ssh_import_id %q", id)
+	}
+}
+
+// fetchUserKeys fetches keys given either as a JSON list of objects with a
+// "key", like the GitHub API returns, or as authorized_keys lines.
 func fetchUserKeys(url string) ([]string, error) {
 	client := pkg.NewHttpClient()
+	client.MaxRetries = sshImportRetries
+	client.MaxBackoff = 2 * time.Second
 	data, err := client.GetRetry(url)
 	if err != nil {
 		return nil, err
 	}
 
 	var userKeys []UserKey
-	err = json.Unmarshal(data, &userKeys)
-	if err != nil {
-		return nil, err
+	if err := json.Unmarshal(data, &userKeys); err != nil {
+		keys := make([]string, 0)
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				keys = append(keys, line)
+			}
+		}
+		return keys, nil
 	}
 	keys := make([]string, 0)
 	for _, key := range userKeys {
 		keys = append(keys, key.Key)
 	}
-	return keys, err
+	return keys, nil
 }
@@ -16,9 +16,17 @@ package initialize
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/datasource"
 )
 
 func TestCloudConfigUsersUrlMarshal(t *testing.T) {
@@ -54,3 +62,85 @@ func TestCloudConfigUsersUrlMarshal(t *testing.T) {
 		t.Fatalf("expected %s, got %s", expected, keys[2])
 	}
 }
+
+func TestFetchUserKeysPlain(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "# keys of core\nssh-ed25519 AAAAC3Nza one\n\nssh-ed25519 AAAAC3Nzb two\n")
+	}))
+	defer ts.Close()
+
+	keys, err := fetchUserKeys(ts.URL)
+	if err != nil {
+		t.Fatalf("Encountered unexpected error: %v", err)
+	}
+	expected := []string{"ssh-ed25519 AAAAC3Nza one", "ssh-ed25519 AAAAC3Nzb two"}
+	if !reflect.DeepEqual(expected, keys) {
+		t.Errorf("bad keys: want %q, got %q", expected, keys)
+	}
+}
+
+func TestImportSSHKeys(t *testing.T) {
+	defer func(retries int) { sshImportRetries = retries }(sshImportRetries)
+	sshImportRetries = 1
+
+	keys := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIEwJtednfVsTnrUtfIm8GHF9H/9tGQy2dzK8XE4aHAQd core@ed25519\nssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDd4XREursCW2ysvjBssGrAJZgZU0Ksuyk+UkPBsTp7X core@two\n"
+	available := true
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available || r.URL.Path == "/missing" {
+			http.Error(w, "unavailable", http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, keys)
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(path.Join(dir, "etc"), 0755)
+	os.MkdirAll(path.Join(dir, "home", "core"), 0755)
+	ioutil.WriteFile(path.Join(dir, "etc", "passwd"), []byte("core:x:500:500::/home/core:/bin/sh\n"), 0644)
+	authFile := path.Join(dir, "home", "core", ".ssh", "authorized_keys")
+	expected := "# BEGIN coreos-cloudinit-ssh-import\n" + keys + "# END coreos-cloudinit-ssh-import\n"
+
+	// The URL is longer than a file name can be, so it is cached by its hash.
+	user := config.User{Name: "core", SSHImportID: []string{"url:" + ts.URL + "/keys?token=" + strings.Repeat("x", 300)}}
+	env := NewEnvironment(dir, "", path.Join(dir, "workspace"), "", datasource.Metadata{})
+	status := &Status{}
+	if errs := importSSHKeys(user, "", env, status); len(errs) != 0 {
+		t.Fatalf("bad errors: %v", errs)
+	}
+	if contents, _ := ioutil.ReadFile(authFile); string(contents) != expected {
+		t.Errorf("bad authorized_keys: want %q, got %q", expected, contents)
+	}
+	if len(status.Warnings) != 0 {
+		t.Errorf("bad warnings: want none, got %v", status.Warnings)
+	}
+
+	// The cached keys are used while the source is unavailable.
+	available = false
+	if errs := importSSHKeys(user, "", env, status); len(errs) != 0 {
+		t.Fatalf("bad errors: %v", errs)
+	}
+	if contents, _ := ioutil.ReadFile(authFile); string(contents) != expected {
+		t.Errorf("bad authorized_keys: want %q, got %q", expected, contents)
+	}
+	if len(status.Warnings) != 1 || !strings.Contains(status.Warnings[0], "using cached SSH keys of url:"+ts.URL) {
+		t.Errorf("bad warnings: want cached keys warning, got %v", status.Warnings)
+	}
+
+	// An ID which was never fetched is reported, and the keys of the
+	// others are still authorized.
+	available = true
+	os.RemoveAll(env.Workspace())
+	os.Remove(authFile)
+	user.SSHImportID = []string{"url:" + ts.URL + "/missing", "url:" + ts.URL}
+	if errs := importSSHKeys(user, "", env, &Status{}); len(errs) != 1 {
+		t.Fatalf("bad errors: want 1, got %v", errs)
+	}
+	if contents, _ := ioutil.ReadFile(authFile); string(contents) != expected {
+		t.Errorf("bad authorized_keys: want %q, got %q", expected, contents)
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/system"
+)
+
+// defaultDisableRootOpts are the options given to root's authorized keys
+// when disable_root is set. $USER is replaced by the first user of the
+// cloud-config and $DISABLE_USER by root.
+const defaultDisableRootOpts = `no-port-forwarding,no-agent-forwarding,no-X11-forwarding,command="echo 'Please login as the user \"$USER\" rather than the user \"$DISABLE_USER\".';echo;sleep 10;exit 142"`
+
+// applySSHD installs or generates the SSH host keys and applies the sshd
+// settings of the cloud-config to sshd_config, reloading sshd if either
+// changed. It also restricts root's authorized keys if disable_root is set.
+func applySSHD(cfg config.CloudConfig, env *Environment, status *Status) []error {
+	changed, errs := applySSHHostKeys(cfg, env, status)
+
+	settings := map[string]string{}
+	if cfg.SSHPwAuth != nil {
+		settings["PasswordAuthentication"] = "no"
+		if *cfg.SSHPwAuth {
+			settings["PasswordAuthentication"] = "yes"
+		}
+	}
+	// Explicit sshd_config settings win over the shortcuts above.
+	for key, value := range cfg.SSHDConfig {
+		for k := range settings {
+			if strings.EqualFold(k, key) {
+				delete(settings, k)
+			}
+		}
+		settings[key] = value
+	}
+
+	if len(settings) > 0 {
+		updated, err := system.UpdateSSHDConfig(settings, env.Root())
+		if err != nil {
+			log.Printf("Failed updating %s: %v", system.SSHDConfigPath, err)
+			errs = append(errs, err)
+		} else if updated {
+			log.Printf("Updated %s", system.SSHDConfigPath)
+			changed = true
+		}
+	}
+
+	// There is no sshd to reload when preparing another root.
+	if changed && filepath.Clean(env.Root()) == "/" {
+		if err := reloadService("sshd"); err != nil {
+			log.Printf("Failed reloading sshd: %v", err)
+			errs = append(errs, err)
+		}
+	}
+
+	// The keys of the blocks managed by cloud-init are restricted as they
+	// are authorized, this takes care of the others.
+	if opts := sshKeyOptions(cfg, "root"); opts != "" {
+		if err := system.RestrictSSHKeys("root", opts, env.Root()); err != nil {
+			log.Printf("Failed restricting SSH keys of root: %v", err)
+			errs = append(errs, err)
+		} else {
+			log.Printf("Restricted SSH keys of root")
+		}
+	}
+
+	return errs
+}
+
+// sshKeyOptions returns the options the authorized keys of user are given:
+// those of disable_root for root if it is set, and none otherwise.
+func sshKeyOptions(cfg config.CloudConfig, user string) string {
+	if user != "root" || !cfg.DisableRoot {
+		return ""
+	}
+	opts := cfg.DisableRootOpts
+	if opts == "" {
+		opts = defaultDisableRootOpts
+	}
+	name := "NONE"
+	for _, u := range cfg.Users {
+		if u.Name != "" && u.Name != "root" {
+			name = u.Name
+			break
+		}
+	}
+	return strings.NewReplacer("$USER", name, "$DISABLE_USER", "root").Replace(opts)
+}
+
+// applySSHHostKeys deletes the existing host keys once per instance if
+// ssh_deletekeys is set, installs the keys given in ssh_keys and generates
+// those of ssh_genkeytypes (all types by default, if sshd is installed)
+// which are still missing. The fingerprints of the resulting keys are
+// printed to the console and recorded in the status. It reports whether any
+// key changed.
+func applySSHHostKeys(cfg config.CloudConfig, env *Environment, status *Status) (changed bool, errs []error) {
+	errs = []error{}
+
+	if cfg.SSHDeleteKeys && !RanForInstance("ssh_deletekeys", env.InstanceID(), env.Workspace()) {
+		log.Printf("Deleting SSH host keys")
+		if err := system.DeleteSSHHostKeys(env.Root()); err != nil {
+			log.Printf("Failed deleting SSH host keys: %v", err)
+			errs = append(errs, err)
+		} else {
+			changed = true
+			if err := PersistInstanceInWorkspace("ssh_deletekeys", env.InstanceID(), env.Workspace()); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if cfg.SSHKeys != nil {
+		pairs := cfg.SSHKeys.Pairs()
+		for _, keyType := range system.SSHHostKeyTypes {
+			pair, ok := pairs[keyType]
+			if !ok {
+				continue
+			}
+			written, err := system.WriteSSHHostKey(keyType, pair[0], pair[1], env.Root())
+			if err != nil {
+				log.Printf("Failed writing %s SSH host key: %v", keyType, err)
+				errs = append(errs, err)
+			} else if written {
+				log.Printf("Wrote %s SSH host key", keyType)
+				changed = true
+			}
+		}
+	}
+
+	// Unless told otherwise, every type of key is generated on systems
+	// with sshd installed.
+	var genTypes []string
+	if cfg.SSHGenKeyTypes != nil {
+		genTypes = *cfg.SSHGenKeyTypes
+	} else if system.SSHDInstalled(env.Root()) {
+		genTypes = system.SSHHostKeyTypes
+	}
+	for _, keyType := range genTypes {
+		generated, err := system.GenerateSSHHostKey(keyType, env.Root())
+		if err != nil {
+			log.Printf("Failed generating %s SSH host key: %v", keyType, err)
+			errs = append(errs, err)
+		} else if generated {
+			log.Printf("Generated %s SSH host key", keyType)
+			changed = true
+		}
+	}
+
+	fingerprints, err := system.SSHHostKeyFingerprints(env.Root())
+	if err != nil {
+		log.Printf("Failed reading SSH host key fingerprints: %v", err)
+		errs = append(errs, err)
+	} else if len(fingerprints) > 0 {
+		status.SSHHostKeyFingerprints = fingerprints
+		msg := []string{"-----BEGIN SSH HOST KEY FINGERPRINTS-----"}
+		for _, keyType := range system.SSHHostKeyTypes {
+			if fp, ok := fingerprints[keyType]; ok {
+				msg = append(msg, fmt.Sprintf("%s (%s)", fp, strings.ToUpper(keyType)))
+			}
+		}
+		msg = append(msg, "-----END SSH HOST KEY FINGERPRINTS-----")
+		printToConsole(strings.Join(msg, "\n"))
+	}
+
+	return changed, errs
+}
@@ -0,0 +1,137 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/datasource"
+	"github.com/elotl/cloud-init/system"
+)
+
+func TestApplySSHD(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(path.Join(dir, "etc", "ssh"), 0755)
+	os.MkdirAll(path.Join(dir, "root", ".ssh"), 0700)
+	for name, contents := range map[string]string{
+		"etc/passwd":                "root:x:0:0:root:/root:/bin/sh\n",
+		"etc/ssh/sshd_config":       "#PasswordAuthentication yes\nPermitRootLogin yes\n",
+		"root/.ssh/authorized_keys": "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIEwJtednfVsTnrUtfIm8GHF9H/9tGQy2dzK8XE4aHAQd admin\n",
+	} {
+		if err := ioutil.WriteFile(path.Join(dir, name), []byte(contents), 0600); err != nil {
+			t.Fatalf("Unable to write %s: %v", name, err)
+		}
+	}
+
+	pwauth := true
+	cfg := config.CloudConfig{
+		SSHPwAuth:   &pwauth,
+		SSHDConfig:  map[string]string{"passwordauthentication": "no", "PermitRootLogin": "no"},
+		DisableRoot: true,
+		Users:       []config.User{{Name: "core"}},
+	}
+	env := NewEnvironment(dir, "", "", "", datasource.Metadata{})
+	if errs := applySSHD(cfg, env, &Status{}); len(errs) != 0 {
+		t.Fatalf("bad errors: %v", errs)
+	}
+
+	contents, err := ioutil.ReadFile(path.Join(dir, system.SSHDConfigPath))
+	if err != nil {
+		t.Fatalf("Unable to read sshd_config: %v", err)
+	}
+	if expected := "#PasswordAuthentication yes\nPermitRootLogin no\npasswordauthentication no\n"; string(contents) != expected {
+		t.Errorf("bad sshd_config: want %q, got %q", expected, contents)
+	}
+
+	contents, err = ioutil.ReadFile(path.Join(dir, "root", ".ssh", "authorized_keys"))
+	if err != nil {
+		t.Fatalf("Unable to read authorized_keys: %v", err)
+	}
+	expected := `no-port-forwarding,no-agent-forwarding,no-X11-forwarding,command="echo 'Please login as the user \"core\" rather than the user \"root\".';echo;sleep 10;exit 142" ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIEwJtednfVsTnrUtfIm8GHF9H/9tGQy2dzK8XE4aHAQd admin` + "\n"
+	if string(contents) != expected {
+		t.Errorf("bad authorized_keys: want %q, got %q", expected, contents)
+	}
+}
+
+func TestApplySSHHostKeys(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	consolePath = path.Join(dir, "console")
+	defer func() { consolePath = "/dev/console" }()
+	ioutil.WriteFile(consolePath, nil, 0600)
+	os.MkdirAll(path.Join(dir, "etc", "ssh"), 0755)
+	stale := path.Join(dir, system.SSHHostKeyPath("rsa"))
+	ioutil.WriteFile(stale, []byte("stale"), 0600)
+
+	genTypes := []string{"ed25519"}
+	cfg := config.CloudConfig{SSHDeleteKeys: true, SSHGenKeyTypes: &genTypes}
+	env := NewEnvironment(dir, "", path.Join(dir, "workspace"), "", datasource.Metadata{InstanceID: "i-1"})
+	status := &Status{}
+	changed, errs := applySSHHostKeys(cfg, env, status)
+	if len(errs) != 0 {
+		t.Fatalf("bad errors: %v", errs)
+	}
+	if !changed {
+		t.Errorf("bad changed: want true, got false")
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("bad deletion: stale rsa key still exists")
+	}
+	fp, ok := status.SSHHostKeyFingerprints["ed25519"]
+	if !ok || len(status.SSHHostKeyFingerprints) != 1 {
+		t.Fatalf("bad fingerprints: want only ed25519, got %v", status.SSHHostKeyFingerprints)
+	}
+	console, err := ioutil.ReadFile(consolePath)
+	if err != nil {
+		t.Fatalf("Unable to read console: %v", err)
+	}
+	if !strings.Contains(string(console), fp+" (ED25519)") {
+		t.Errorf("bad console: want fingerprint %q, got %q", fp, console)
+	}
+
+	// The keys generated for this instance survive later boots.
+	changed, errs = applySSHHostKeys(cfg, env, &Status{})
+	if len(errs) != 0 {
+		t.Fatalf("bad errors: %v", errs)
+	}
+	if changed {
+		t.Errorf("bad changed: want false on the second boot, got true")
+	}
+
+	// Given keys only change once as well.
+	empty := []string{}
+	cfg = config.CloudConfig{SSHGenKeyTypes: &empty, SSHKeys: &config.SSHHostKeys{
+		ED25519Private: "private",
+		ED25519Public:  "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIGbHAQ8Rs+LnoMbVf3yxxEqrm0Ae1xS6rJ5FQdpDyIj1 root@host",
+	}}
+	for _, expected := range []bool{true, false} {
+		changed, errs = applySSHHostKeys(cfg, env, &Status{})
+		if len(errs) != 0 || changed != expected {
+			t.Errorf("bad write of given keys: want %t, no errors, got %t, %v", expected, changed, errs)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"github.com/elotl/cloud-init/system"
+	aggerr "github.com/elotl/cloud-init/util/errors"
+)
+
+// Status summarizes the outcome of applying a cloud-config. It is written to
+// status.json in the workspace once Apply finishes.
+type Status struct {
+	BootCmd []system.CommandResult `json:"bootcmd,omitempty"`
+	RunCmd  []system.CommandResult `json:"runcmd,omitempty"`
+	// RandomPasswords maps users to the passwords generated for them by
+	// chpasswd.
+	RandomPasswords map[string]string `json:"random_passwords,omitempty"`
+	// SSHHostKeyFingerprints maps host key types to their SHA256
+	// fingerprints.
+	SSHHostKeyFingerprints map[string]string `json:"ssh_host_key_fingerprints,omitempty"`
+	// Packages are the outcome of installing each package.
+	Packages []system.PackageResult `json:"packages,omitempty"`
+	// RebootRequired tells that upgraded packages need a reboot to take
+	// effect.
+	RebootRequired bool `json:"reboot_required,omitempty"`
+	// Warnings report steps which succeeded in a degraded way, such as
+	// SSH keys imported from the cache instead of their source.
+	Warnings []string `json:"warnings,omitempty"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+// setErrors records err, or each error of an aggregate, in the status.
+func (s *Status) setErrors(err error) {
+	s.Errors = nil
+	if agg, ok := err.(aggerr.Aggregate); ok {
+		for _, e := range agg.Errors() {
+			s.Errors = append(s.Errors, e.Error())
+		}
+	} else if err != nil {
+		s.Errors = append(s.Errors, err.Error())
+	}
+}
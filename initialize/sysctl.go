@@ -0,0 +1,62 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/system"
+)
+
+// applySysctl keeps the kernel parameters of the cloud-config for the
+// following boots and sets them on the running system, if there is one
+// under the root.
+func applySysctl(cfg config.CloudConfig, env *Environment) []error {
+	if len(cfg.Sysctl) == 0 {
+		return nil
+	}
+	if changed, err := system.WriteSysctlConfig(cfg.Sysctl, env.Root()); err != nil {
+		return []error{err}
+	} else if changed {
+		log.Printf("Updated %s", system.SysctlConfigPath)
+	}
+
+	procSys, err := system.SecureJoin(env.Root(), system.ProcSysPath)
+	if err != nil {
+		return []error{err}
+	}
+	if _, err := os.Stat(procSys); err != nil {
+		log.Printf("Not setting the kernel parameters, %s is not available: %v", procSys, err)
+		return nil
+	}
+	keys := make([]string, 0, len(cfg.Sysctl))
+	for k := range cfg.Sysctl {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, k := range keys {
+		if err := system.SetSysctl(k, cfg.Sysctl[k], env.Root()); err != nil {
+			log.Printf("Failed setting kernel parameter %s: %v", k, err)
+			errs = append(errs, fmt.Errorf("setting kernel parameter %s: %v", k, err))
+		}
+	}
+	return errs
+}
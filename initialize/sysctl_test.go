@@ -0,0 +1,61 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/datasource"
+	"github.com/elotl/cloud-init/system"
+)
+
+func TestApplySysctl(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	env := NewEnvironment(dir, "", "", "", datasource.Metadata{})
+	cfg := config.CloudConfig{Sysctl: map[string]string{
+		"net.ipv4.ip_forward":                "1",
+		"net.bridge.bridge-nf-call-iptables": "1",
+	}}
+
+	// Without /proc/sys under the root, the parameters are only kept for
+	// the following boots.
+	if errs := applySysctl(cfg, env); len(errs) != 0 {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+	if _, err := os.Stat(path.Join(dir, system.SysctlConfigPath)); err != nil {
+		t.Fatalf("Missing %s: %v", system.SysctlConfigPath, err)
+	}
+
+	forward := path.Join(dir, system.ProcSysPath, "net/ipv4/ip_forward")
+	os.MkdirAll(path.Dir(forward), 0755)
+	ioutil.WriteFile(forward, []byte("0\n"), 0644)
+
+	// The bridge parameters are missing without br_netfilter.
+	if errs := applySysctl(cfg, env); len(errs) != 1 {
+		t.Fatalf("bad errors: want 1, got %v", errs)
+	}
+	if contents, _ := ioutil.ReadFile(forward); string(contents) != "1\n" {
+		t.Errorf("bad ip_forward: want %q, got %q", "1\n", contents)
+	}
+}
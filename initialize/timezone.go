@@ -0,0 +1,37 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"log"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/system"
+)
+
+// applyTimezone sets the timezone of the host to that of the cloud-config.
+func applyTimezone(cfg config.CloudConfig, env *Environment) error {
+	if cfg.Timezone == "" {
+		return nil
+	}
+	changed, err := system.SetTimezone(cfg.Timezone, env.Root())
+	if err != nil {
+		return err
+	}
+	if changed {
+		log.Printf("Set the timezone to %s", cfg.Timezone)
+	}
+	return nil
+}
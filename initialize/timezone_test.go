@@ -0,0 +1,49 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/datasource"
+	"github.com/elotl/cloud-init/system"
+)
+
+func TestApplyTimezone(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	env := NewEnvironment(dir, "", "", "", datasource.Metadata{})
+	cfg := config.CloudConfig{Timezone: "UTC"}
+	if err := applyTimezone(cfg, env); err == nil {
+		t.Fatalf("Expected an error for a timezone missing from the database")
+	}
+
+	os.MkdirAll(path.Join(dir, system.ZoneinfoDir), 0755)
+	ioutil.WriteFile(path.Join(dir, system.ZoneinfoDir, "UTC"), []byte("TZif"), 0644)
+	if err := applyTimezone(cfg, env); err != nil {
+		t.Fatalf("Unexpected error while applying timezone: %v", err)
+	}
+	if contents, err := ioutil.ReadFile(path.Join(dir, system.TimezonePath)); err != nil || string(contents) != "UTC\n" {
+		t.Errorf("bad /etc/timezone: want %q, <nil>, got %q, %v", "UTC\n", contents, err)
+	}
+}
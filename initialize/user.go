@@ -0,0 +1,81 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/system"
+)
+
+// applyUser creates the given user with um. If the user exists already, the
+// fields which can be changed after creation (password, expiry and locking)
+// are applied instead, and a different uid is reported.
+func applyUser(user config.User, um system.UserManager, root string) []error {
+	errs := []error{}
+
+	if user.PlainTextPasswd != "" {
+		hash, err := system.HashPassword(user.PlainTextPasswd)
+		if err != nil {
+			log.Printf("Failed hashing '%s' user's password: %v", user.Name, err)
+			errs = append(errs, err)
+		} else {
+			user.PasswordHash = hash
+		}
+	}
+
+	existing, err := system.NewPasswd(root).LookupUser(user.Name)
+	if err != nil {
+		log.Printf("Creating user '%s'", user.Name)
+		if err := um.CreateUser(&user); err != nil {
+			log.Printf("Failed creating user '%s': %v", user.Name, err)
+			errs = append(errs, err)
+		}
+		return errs
+	}
+
+	log.Printf("User '%s' exists, ignoring creation-time fields", user.Name)
+	if user.Uid != 0 && existing.Uid != user.Uid {
+		err := fmt.Errorf("user %q already exists with uid %d, not %d", user.Name, existing.Uid, user.Uid)
+		log.Printf("Failed updating user '%s': %v", user.Name, err)
+		errs = append(errs, err)
+	}
+	if user.PasswordHash != "" {
+		log.Printf("Setting '%s' user's password", user.Name)
+		if err := um.SetUserPassword(user.Name, user.PasswordHash); err != nil {
+			log.Printf("Failed setting '%s' user's password: %v", user.Name, err)
+			errs = append(errs, err)
+		}
+	}
+	if user.ExpireDate != "" || user.Inactive != "" {
+		log.Printf("Setting '%s' user's expiry", user.Name)
+		if err := um.SetUserExpiry(user.Name, user.ExpireDate, user.Inactive); err != nil {
+			log.Printf("Failed setting '%s' user's expiry: %v", user.Name, err)
+			errs = append(errs, err)
+		}
+	}
+	// Existing users, such as root listed for its authorized keys, keep
+	// their password unless asked to lock it.
+	if user.LockPasswd != nil && *user.LockPasswd {
+		log.Printf("Locking '%s' user's password", user.Name)
+		if err := um.LockPassword(user.Name); err != nil {
+			log.Printf("Failed locking '%s' user's password: %v", user.Name, err)
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
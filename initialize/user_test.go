@@ -0,0 +1,90 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/system"
+)
+
+func TestApplyUser(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(path.Join(dir, "etc"), 0755)
+	for name, contents := range map[string]string{
+		"passwd": "root:x:0:0:root:/root:/bin/sh\ncore:x:500:500::/home/core:/bin/sh\n",
+		"shadow": "root:*:16000:0:99999:7:::\ncore:$6$old$hash:16000:0:99999:7:::\n",
+		"group":  "root:x:0:\ncore:x:500:\n",
+	} {
+		if err := ioutil.WriteFile(path.Join(dir, "etc", name), []byte(contents), 0640); err != nil {
+			t.Fatalf("Unable to write %s: %v", name, err)
+		}
+	}
+
+	locked, unlocked := true, false
+	um := system.NewFileUserManager(dir)
+	for _, tt := range []struct {
+		user   config.User
+		nerrs  int
+		shadow string
+	}{
+		// Existing users are only locked when asked to.
+		{
+			user:   config.User{Name: "core", ExpireDate: "2030-01-01", Inactive: "7"},
+			shadow: "core:$6$old$hash:16000:0:99999:7:7:21915:",
+		},
+		{
+			user:   config.User{Name: "core", LockPasswd: &locked},
+			shadow: "core:!$6$old$hash:16000:0:99999:7:7:21915:",
+		},
+		{
+			user:   config.User{Name: "core", Uid: 501, PasswordHash: "$6$new$hash", LockPasswd: &unlocked},
+			nerrs:  1,
+			shadow: "core:$6$new$hash:",
+		},
+		{
+			user:   config.User{Name: "alice", Uid: 2000, PlainTextPasswd: "secret", LockPasswd: &unlocked},
+			shadow: "alice:$6$",
+		},
+		{
+			user:   config.User{Name: "bob", PasswordHash: "$6$bob$hash", ExpireDate: "2030-01-01"},
+			shadow: "bob:!$6$bob$hash:",
+		},
+	} {
+		if errs := applyUser(tt.user, um, dir); len(errs) != tt.nerrs {
+			t.Errorf("bad errors applying %+v: want %d, got %v", tt.user, tt.nerrs, errs)
+		}
+		contents, err := ioutil.ReadFile(path.Join(dir, "etc", "shadow"))
+		if err != nil {
+			t.Fatalf("Unable to read shadow: %v", err)
+		}
+		if !strings.Contains(string(contents), "\n"+tt.shadow) {
+			t.Errorf("bad shadow after applying %+v: want %q in %q", tt.user, tt.shadow, contents)
+		}
+	}
+
+	if u, err := system.NewPasswd(dir).LookupUser("alice"); err != nil || u.Uid != 2000 {
+		t.Errorf("bad user alice: want uid 2000, got %+v (%v)", u, err)
+	}
+}
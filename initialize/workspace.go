@@ -15,6 +15,9 @@
 package initialize
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"io/ioutil"
 	"path"
 	"strings"
@@ -64,3 +67,72 @@ func PersistUnitNameInWorkspace(name string, workspace string) error {
 	_, err := system.WriteFile(&file, workspace)
 	return err
 }
+
+func PersistStatusInWorkspace(status *Status, workspace string) error {
+	contents, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := system.File{File: config.File{
+		Path:               "status.json",
+		RawFilePermissions: "0600",
+		Content:            string(contents) + "\n",
+	}}
+	_, err = system.WriteFile(&file, workspace)
+	return err
+}
+
+// RanForInstance determines if the step of the given name was already
+// completed for the instance, as recorded by PersistInstanceInWorkspace.
+func RanForInstance(step, instanceID, workspace string) bool {
+	contents, err := ioutil.ReadFile(path.Join(workspace, "instance", step))
+	return err == nil && string(contents) == instanceID
+}
+
+// PersistInstanceInWorkspace records that the step of the given name was
+// completed for the instance, so it is not repeated on later boots.
+func PersistInstanceInWorkspace(step, instanceID, workspace string) error {
+	file := system.File{File: config.File{
+		Path:               path.Join("instance", step),
+		RawFilePermissions: "0644",
+		Content:            instanceID,
+	}}
+	_, err := system.WriteFile(&file, workspace)
+	return err
+}
+
+// sshImportCachePath returns the path of the cache of an ssh_import_id in
+// the workspace, named after the hash of the ID as URLs may carry tokens and
+// be longer than a file name can be.
+func sshImportCachePath(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return path.Join("ssh_import", hex.EncodeToString(sum[:]))
+}
+
+// PersistSSHImportInWorkspace caches the keys fetched for an ssh_import_id,
+// for SSHImportFromWorkspace to fall back on.
+func PersistSSHImportInWorkspace(id string, keys []string, workspace string) error {
+	file := system.File{File: config.File{
+		Path:               sshImportCachePath(id),
+		RawFilePermissions: "0644",
+		Content:            strings.Join(keys, "\n") + "\n",
+	}}
+	_, err := system.WriteFile(&file, workspace)
+	return err
+}
+
+// SSHImportFromWorkspace returns the keys last cached for an ssh_import_id
+// by PersistSSHImportInWorkspace.
+func SSHImportFromWorkspace(id, workspace string) ([]string, error) {
+	contents, err := ioutil.ReadFile(path.Join(workspace, sshImportCachePath(id)))
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for _, key := range strings.Split(string(contents), "\n") {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/elotl/cloud-init/pkg"
+	"github.com/elotl/cloud-init/system"
+)
+
+// fetchFileSource replaces the content of the given file with the data
+// referenced by its source. Local file:// sources are read under root. If a
+// checksum is provided, the data must match it before the content is
+// replaced.
+func fetchFileSource(f *system.File, root string) error {
+	uri := f.Source.URI
+	if u, err := url.Parse(uri); err == nil && u.Scheme == "file" {
+		fullpath, err := system.SecureJoin(root, u.Path)
+		if err != nil {
+			return fmt.Errorf("failed resolving source of %s: %v", f.Path, err)
+		}
+		uri = (&url.URL{Scheme: "file", Path: fullpath}).String()
+	}
+
+	header := http.Header{}
+	for k, v := range f.Source.Headers {
+		header.Set(k, v)
+	}
+
+	client := pkg.NewHttpClientHeader(header)
+	data, err := client.Fetch(uri)
+	if err != nil {
+		return fmt.Errorf("failed fetching content of %s from %s: %v", f.Path, f.Source.URI, err)
+	}
+
+	if f.Source.SHA256 != "" {
+		sum := sha256.Sum256(data)
+		if actual := hex.EncodeToString(sum[:]); !strings.EqualFold(actual, f.Source.SHA256) {
+			return fmt.Errorf("checksum mismatch for %s: want sha256 %s, got %s", f.Path, f.Source.SHA256, actual)
+		}
+	}
+
+	f.Content = string(data)
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/elotl/cloud-init/config"
+	"github.com/elotl/cloud-init/system"
+)
+
+func TestFetchFileSource(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, "hello")
+	}))
+	defer ts.Close()
+
+	// sha256 of "hello"
+	sum := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	headers := map[string]string{"Authorization": "Bearer token"}
+
+	for _, tt := range []struct {
+		source  config.FileSource
+		content string
+		err     bool
+	}{
+		{
+			source:  config.FileSource{URI: ts.URL, Headers: headers},
+			content: "hello",
+		},
+		{
+			source:  config.FileSource{URI: ts.URL, Headers: headers, SHA256: sum},
+			content: "hello",
+		},
+		{
+			source:  config.FileSource{URI: ts.URL, Headers: headers, SHA256: "2CF24DBA5FB0A30E26E83B2AC5B9E29E1B161E5C1FA7425E73043362938B9824"},
+			content: "hello",
+		},
+		{
+			source: config.FileSource{URI: ts.URL, Headers: headers, SHA256: "0000000000000000000000000000000000000000000000000000000000000000"},
+			err:    true,
+		},
+		{
+			source: config.FileSource{URI: ts.URL},
+			err:    true,
+		},
+		{
+			source:  config.FileSource{URI: "data:,hello", SHA256: sum},
+			content: "hello",
+		},
+	} {
+		source := tt.source
+		f := system.File{File: config.File{Path: "/tmp/foo", Source: &source}}
+		err := fetchFileSource(&f, "/")
+		if tt.err != (err != nil) {
+			t.Errorf("bad error (%+v): want error %t, got %v", tt.source, tt.err, err)
+		}
+		if f.Content != tt.content {
+			t.Errorf("bad content (%+v): want %q, got %q", tt.source, tt.content, f.Content)
+		}
+	}
+}
+
+func TestFetchFileSourceUnderRoot(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(path.Join(dir, "etc"), 0755)
+	ioutil.WriteFile(path.Join(dir, "etc", "source"), []byte("hello"), 0644)
+
+	for _, tt := range []struct {
+		uri     string
+		content string
+		err     bool
+	}{
+		{uri: "file:///etc/source", content: "hello"},
+		{uri: "file:///../../etc/source", err: true},
+	} {
+		f := system.File{File: config.File{Path: "/tmp/foo", Source: &config.FileSource{URI: tt.uri}}}
+		err := fetchFileSource(&f, dir)
+		if tt.err != (err != nil) {
+			t.Errorf("bad error (%s): want error %t, got %v", tt.uri, tt.err, err)
+		}
+		if f.Content != tt.content {
+			t.Errorf("bad content (%s): want %q, got %q", tt.uri, tt.content, f.Content)
+		}
+	}
+}
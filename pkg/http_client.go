@@ -15,6 +15,7 @@
 package pkg
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -142,6 +143,58 @@ func (h *HttpClient) GetRetry(rawurl string) ([]byte, error) {
 	return nil, ErrTimeout{fmt.Errorf("Unable to fetch data. Maximum retries reached: %d", h.MaxRetries)}
 }
 
+// Fetch retrieves the content referenced by a URI. In addition to the http
+// and https schemes handled by GetRetry, it supports local file:// URIs and
+// RFC 2397 data: URIs.
+func (h *HttpClient) Fetch(rawurl string) ([]byte, error) {
+	if rawurl == "" {
+		return nil, ErrInvalid{errors.New("URL is empty. Skipping.")}
+	}
+
+	url, err := neturl.Parse(rawurl)
+	if err != nil {
+		return nil, ErrInvalid{err}
+	}
+
+	switch url.Scheme {
+	case "http", "https":
+		return h.GetRetry(rawurl)
+	case "file":
+		data, err := ioutil.ReadFile(url.Path)
+		if err != nil {
+			return nil, ErrNotFound{err}
+		}
+		return data, nil
+	case "data":
+		return decodeDataURL(rawurl[len("data:"):])
+	default:
+		return nil, ErrInvalid{fmt.Errorf("URL %s does not have a supported scheme. Skipping.", rawurl)}
+	}
+}
+
+// decodeDataURL decodes the part of a data: URI following the scheme, i.e.
+// "[<mediatype>][;base64],<data>".
+func decodeDataURL(opaque string) ([]byte, error) {
+	parts := strings.SplitN(opaque, ",", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalid{errors.New("data URL is missing a ',' separator")}
+	}
+
+	if strings.HasSuffix(parts[0], ";base64") {
+		data, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, ErrInvalid{err}
+		}
+		return data, nil
+	}
+
+	data, err := neturl.PathUnescape(parts[1])
+	if err != nil {
+		return nil, ErrInvalid{err}
+	}
+	return []byte(data), nil
+}
+
 func (h *HttpClient) Get(dataURL string) ([]byte, error) {
 	request, err := http.NewRequest("GET", dataURL, nil)
 	if err != nil {
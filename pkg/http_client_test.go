@@ -17,9 +17,12 @@ package pkg
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path"
 	"testing"
 	"time"
 )
@@ -152,3 +155,48 @@ func TestGetMalformedURL(t *testing.T) {
 		}
 	}
 }
+
+// Test fetching from the non-HTTP schemes supported by Fetch
+func TestFetch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloud-init-fetch")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	local := path.Join(dir, "local")
+	if err := ioutil.WriteFile(local, []byte("from file"), 0644); err != nil {
+		t.Fatalf("Unable to write file: %v", err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "from http")
+	}))
+	defer ts.Close()
+
+	client := NewHttpClient()
+	var tests = []struct {
+		url  string
+		want string
+		err  bool
+	}{
+		{ts.URL, "from http", false},
+		{"file://" + local, "from file", false},
+		{"file://" + path.Join(dir, "missing"), "", true},
+		{"data:,hello%20world", "hello world", false},
+		{"data:text/plain;base64,aGVsbG8=", "hello", false},
+		{"data:;base64,!!!", "", true},
+		{"data:hello", "", true},
+		{"ftp://boo", "", true},
+		{"", "", true},
+	}
+
+	for _, tt := range tests {
+		data, err := client.Fetch(tt.url)
+		if tt.err != (err != nil) {
+			t.Errorf("bad error (%q): want error %t, got %v", tt.url, tt.err, err)
+		}
+		if string(data) != tt.want {
+			t.Errorf("bad data (%q): want %q, got %q", tt.url, tt.want, data)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/elotl/cloud-init/config"
+)
+
+const (
+	// APKRepositoriesPath lists the repositories of apk.
+	APKRepositoriesPath = "/etc/apk/repositories"
+	// APKKeysDir holds the keys apk trusts.
+	APKKeysDir = "/etc/apk/keys"
+
+	apkReposHeader = "# Generated by cloud-init from the apk_repos of the cloud-config."
+)
+
+// WriteAPKRepositories writes the repositories of apk under root. Unless
+// they are preserved, the repositories of the system are replaced;
+// otherwise the missing repositories are appended to them. Without any
+// repositories, for instance when only keys are given, the file is left
+// alone. It reports whether the file changed.
+func WriteAPKRepositories(repos config.APKRepos, root string) (bool, error) {
+	if len(repos.Repositories) == 0 {
+		return false, nil
+	}
+
+	var lines []string
+	if repos.PreserveRepositories {
+		fullpath, err := SecureJoin(root, APKRepositoriesPath)
+		if err != nil {
+			return false, err
+		}
+		contents, err := ioutil.ReadFile(fullpath)
+		if err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+		if existing := strings.TrimRight(string(contents), "\n"); existing != "" {
+			lines = strings.Split(existing, "\n")
+		}
+	} else {
+		lines = []string{apkReposHeader}
+	}
+
+	present := map[string]bool{}
+	for _, line := range lines {
+		present[strings.Join(strings.Fields(line), " ")] = true
+	}
+	for _, repo := range repos.Repositories {
+		if line := repo.String(); !present[line] {
+			lines = append(lines, line)
+			present[line] = true
+		}
+	}
+
+	return writeFileIfChanged(&File{config.File{
+		Path:               APKRepositoriesPath,
+		RawFilePermissions: "0644",
+		Content:            strings.Join(lines, "\n") + "\n",
+	}}, root)
+}
+
+// WriteAPKKey writes a key for apk to trust under root, once checked to be
+// a PEM encoded public key. It reports whether the key changed.
+func WriteAPKKey(name, content, root string) (bool, error) {
+	if err := config.AssertAPKKeyValid(content); err != nil {
+		return false, err
+	}
+	return writeFileIfChanged(&File{config.File{
+		Path:               path.Join(APKKeysDir, name),
+		RawFilePermissions: "0644",
+		Content:            content,
+	}}, root)
+}
@@ -0,0 +1,131 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/elotl/cloud-init/config"
+)
+
+const testAPKKey = `-----BEGIN PUBLIC KEY-----
+MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAEC5q1wx+kwl3nrFpsa0Gw/2qS2tBV
+VaohFK2Z3uHX4sxwyyun8f8vmKznRXVIjo29PvC87nhlAkk2xrjL8Ngdpw==
+-----END PUBLIC KEY-----
+`
+
+func TestWriteAPKRepositories(t *testing.T) {
+	repos := []config.APKRepository{
+		{URL: "https://dl-cdn.alpinelinux.org/alpine/v3.14/main"},
+		{URL: "https://mirror.example.com/alpine/edge/testing", Tag: "testing"},
+	}
+	for _, tt := range []struct {
+		preserve bool
+		contents string
+		expected string
+	}{
+		{
+			false,
+			"https://dl-cdn.alpinelinux.org/alpine/v3.14/community\n",
+			apkReposHeader + `
+https://dl-cdn.alpinelinux.org/alpine/v3.14/main
+@testing https://mirror.example.com/alpine/edge/testing
+`,
+		},
+		{
+			true,
+			"https://dl-cdn.alpinelinux.org/alpine/v3.14/main\n#https://dl-cdn.alpinelinux.org/alpine/v3.14/community\n",
+			`https://dl-cdn.alpinelinux.org/alpine/v3.14/main
+#https://dl-cdn.alpinelinux.org/alpine/v3.14/community
+@testing https://mirror.example.com/alpine/edge/testing
+`,
+		},
+		{
+			true,
+			"",
+			`https://dl-cdn.alpinelinux.org/alpine/v3.14/main
+@testing https://mirror.example.com/alpine/edge/testing
+`,
+		},
+	} {
+		dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+		if err != nil {
+			t.Fatalf("Unable to create tempdir: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		fullpath := path.Join(dir, APKRepositoriesPath)
+		if tt.contents != "" {
+			os.MkdirAll(path.Dir(fullpath), 0755)
+			ioutil.WriteFile(fullpath, []byte(tt.contents), 0644)
+		}
+		apkRepos := config.APKRepos{PreserveRepositories: tt.preserve, Repositories: repos}
+		if changed, err := WriteAPKRepositories(apkRepos, dir); err != nil || !changed {
+			t.Errorf("bad write (%q): want true, <nil>, got %t, %v", tt.contents, changed, err)
+		}
+		contents, err := ioutil.ReadFile(fullpath)
+		if err != nil {
+			t.Fatalf("Unable to read %s: %v", fullpath, err)
+		}
+		if string(contents) != tt.expected {
+			t.Errorf("bad repositories (%q): want %q, got %q", tt.contents, tt.expected, contents)
+		}
+		if changed, err := WriteAPKRepositories(apkRepos, dir); err != nil || changed {
+			t.Errorf("bad rewrite (%q): want false, <nil>, got %t, %v", tt.contents, changed, err)
+		}
+	}
+
+	// Without repositories, those of the system are kept.
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fullpath := path.Join(dir, APKRepositoriesPath)
+	os.MkdirAll(path.Dir(fullpath), 0755)
+	ioutil.WriteFile(fullpath, []byte("https://dl-cdn.alpinelinux.org/alpine/v3.14/main\n"), 0644)
+	if changed, err := WriteAPKRepositories(config.APKRepos{}, dir); err != nil || changed {
+		t.Errorf("bad write without repositories: want false, <nil>, got %t, %v", changed, err)
+	}
+	if contents, err := ioutil.ReadFile(fullpath); err != nil || string(contents) != "https://dl-cdn.alpinelinux.org/alpine/v3.14/main\n" {
+		t.Errorf("bad repositories without repositories: got %q, %v", contents, err)
+	}
+}
+
+func TestWriteAPKKey(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := WriteAPKKey("bad.rsa.pub", "not a key", dir); err == nil {
+		t.Errorf("Expected an error for an invalid key")
+	}
+	if changed, err := WriteAPKKey("mirror.rsa.pub", testAPKKey, dir); err != nil || !changed {
+		t.Fatalf("bad write: want true, <nil>, got %t, %v", changed, err)
+	}
+	contents, err := ioutil.ReadFile(path.Join(dir, APKKeysDir, "mirror.rsa.pub"))
+	if err != nil || string(contents) != testAPKKey {
+		t.Errorf("bad key: want %q, <nil>, got %q, %v", testAPKKey, contents, err)
+	}
+	if _, err := os.Stat(path.Join(dir, APKKeysDir, "bad.rsa.pub")); !os.IsNotExist(err) {
+		t.Errorf("Unexpected invalid key written: %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/elotl/cloud-init/config"
+)
+
+const (
+	// CACertsBundlePath is the bundle of trusted certificates written when
+	// the system has no tool to generate it.
+	CACertsBundlePath = "/etc/ssl/certs/ca-certificates.crt"
+	// CACertsConfPath lists the certificates of the distribution
+	// update-ca-certificates trusts.
+	CACertsConfPath = "/etc/ca-certificates.conf"
+	// CATrustSourceDir holds the certificates of the distribution
+	// update-ca-trust trusts.
+	CATrustSourceDir = "/usr/share/pki/ca-trust-source"
+
+	caCertPrefix = "cloud-init-ca-cert-"
+	caCertsBegin = "# BEGIN cloud-init trusted certificates"
+	caCertsEnd   = "# END cloud-init trusted certificates"
+	caCertsConf  = "# Generated by cloud-init: the certificates of the distribution are not trusted.\n"
+)
+
+// CATrust is how a distribution trusts certificate authorities: the tool
+// generating the bundle of trusted certificates, if any, and the directory
+// of the certificates trusted locally.
+type CATrust struct {
+	Tool      string
+	AnchorDir string
+}
+
+// DetectCATrust returns the CATrust of the system under root: Debian and
+// Alpine use update-ca-certificates, Fedora and RHEL update-ca-trust, and
+// others get their bundle written by WriteCABundle.
+func DetectCATrust(root string) CATrust {
+	for _, t := range []struct {
+		binaries []string
+		trust    CATrust
+	}{
+		{
+			[]string{"/usr/sbin/update-ca-certificates", "/usr/bin/update-ca-certificates", "/sbin/update-ca-certificates"},
+			CATrust{"update-ca-certificates", "/usr/local/share/ca-certificates"},
+		},
+		{
+			[]string{"/usr/bin/update-ca-trust"},
+			CATrust{"update-ca-trust", "/etc/pki/ca-trust/source/anchors"},
+		},
+	} {
+		for _, b := range t.binaries {
+			if fullpath, err := SecureJoin(root, b); err == nil {
+				if _, err := os.Stat(fullpath); err == nil {
+					return t.trust
+				}
+			}
+		}
+	}
+	return CATrust{"", "/usr/local/share/ca-certificates"}
+}
+
+// WriteTrustedCerts writes each of the PEM encoded certificates to a file
+// of its own in the anchor directory under root, and removes those written
+// before which are no longer trusted. It reports whether any file changed.
+func (t CATrust) WriteTrustedCerts(certs []string, root string) (bool, error) {
+	dir, err := SecureJoin(root, t.AnchorDir)
+	if err != nil {
+		return false, err
+	}
+	changed := false
+	names := map[string]bool{}
+	for i, cert := range certs {
+		name := fmt.Sprintf("%s%d.crt", caCertPrefix, i+1)
+		names[name] = true
+		written, err := writeFileIfChanged(&File{config.File{
+			Path:               path.Join(t.AnchorDir, name),
+			RawFilePermissions: "0644",
+			Content:            cert,
+		}}, root)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || written
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), caCertPrefix) && !names[e.Name()] {
+			if err := os.Remove(path.Join(dir, e.Name())); err != nil {
+				return false, err
+			}
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// RemoveDefaults stops the tool from trusting the certificates of the
+// distribution: update-ca-certificates is left with none of them enabled,
+// and those of update-ca-trust are deleted. It reports whether anything
+// changed.
+func (t CATrust) RemoveDefaults(root string) (bool, error) {
+	switch t.Tool {
+	case "update-ca-certificates":
+		return writeFileIfChanged(&File{config.File{
+			Path:               CACertsConfPath,
+			RawFilePermissions: "0644",
+			Content:            caCertsConf,
+		}}, root)
+	case "update-ca-trust":
+		dir, err := SecureJoin(root, CATrustSourceDir)
+		if err != nil {
+			return false, err
+		}
+		entries, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		for _, e := range entries {
+			if err := os.RemoveAll(path.Join(dir, e.Name())); err != nil {
+				return false, err
+			}
+		}
+		return len(entries) > 0, nil
+	default:
+		return false, nil
+	}
+}
+
+// Update regenerates the bundle of trusted certificates under root with
+// the tool, or else writes it with WriteCABundle.
+func (t CATrust) Update(certs []string, removeDefaults bool, root string) error {
+	switch t.Tool {
+	case "update-ca-certificates":
+		// Without --fresh, the links to the certificates no longer
+		// trusted would be left behind.
+		if removeDefaults {
+			return execCommandIn(root, t.Tool, "--fresh")
+		}
+		return execCommandIn(root, t.Tool)
+	case "update-ca-trust":
+		return execCommandIn(root, t.Tool, "extract")
+	default:
+		_, err := WriteCABundle(certs, removeDefaults, root)
+		return err
+	}
+}
+
+// WriteCABundle writes the PEM encoded certificates at the end of the bundle
+// of trusted certificates under root, replacing those written before. The
+// certificates of the distribution already in the bundle are kept unless
+// they are removed. It reports whether the bundle changed.
+func WriteCABundle(certs []string, removeDefaults bool, root string) (bool, error) {
+	fullpath, err := SecureJoin(root, CACertsBundlePath)
+	if err != nil {
+		return false, err
+	}
+	contents, err := ioutil.ReadFile(fullpath)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	before, _, after, _, err := splitBlock(string(contents), caCertsBegin, caCertsEnd)
+	if err != nil {
+		return false, err
+	}
+
+	var out []string
+	if !removeDefaults {
+		out = append(before, after...)
+	}
+	if len(certs) > 0 {
+		out = append(out, caCertsBegin)
+		for _, cert := range certs {
+			out = append(out, strings.TrimSuffix(cert, "\n"))
+		}
+		out = append(out, caCertsEnd)
+	}
+	updated := ""
+	if len(out) > 0 {
+		updated = strings.Join(out, "\n") + "\n"
+	}
+	if updated == string(contents) {
+		return false, nil
+	}
+	file := File{config.File{
+		Path:               CACertsBundlePath,
+		RawFilePermissions: "0644",
+		Content:            updated,
+	}}
+	if _, err := WriteFile(&file, root); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+const testCACert = `-----BEGIN CERTIFICATE-----
+MIIBpTCCAUugAwIBAgIUeZqzcaONHQu/UyRFZjEa5BbpQqgwCgYIKoZIzj0EAwIw
+JzETMBEGA1UEAwwKQ2x1c3RlciBDQTEQMA4GA1UECgwHRXhhbXBsZTAgFw0yNjEw
+MTkxNzQ2MTZaGA8yMTI2MDkyNTE3NDYxNlowJzETMBEGA1UEAwwKQ2x1c3RlciBD
+QTEQMA4GA1UECgwHRXhhbXBsZTBZMBMGByqGSM49AgEGCCqGSM49AwEHA0IABAhC
+HKUBv8+gHoH3z6FF1ILPKVmjCgdxmA/fx44lEoL4ocb+gAzW60ZtnQ11iw0vX5ZC
+kz1JY78pZuA6ND99hPSjUzBRMB0GA1UdDgQWBBR9h21udVgMEXHy9k36hf9D5bIr
+5TAfBgNVHSMEGDAWgBR9h21udVgMEXHy9k36hf9D5bIr5TAPBgNVHRMBAf8EBTAD
+AQH/MAoGCCqGSM49BAMCA0gAMEUCIFoNQSjzubww+hEyaAk+yiMMG1bE9VvuW+cx
+27MuzZNFAiEApK3cOa7t0EUyS4erJK4Laq2rSv4NIDF4cTvbNiD+EMw=
+-----END CERTIFICATE-----
+`
+
+func TestDetectCATrust(t *testing.T) {
+	for _, tt := range []struct {
+		binary string
+		trust  CATrust
+	}{
+		{"/usr/sbin/update-ca-certificates", CATrust{"update-ca-certificates", "/usr/local/share/ca-certificates"}},
+		{"/usr/bin/update-ca-trust", CATrust{"update-ca-trust", "/etc/pki/ca-trust/source/anchors"}},
+		{"", CATrust{"", "/usr/local/share/ca-certificates"}},
+	} {
+		dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+		if err != nil {
+			t.Fatalf("Unable to create tempdir: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		if tt.binary != "" {
+			os.MkdirAll(path.Join(dir, path.Dir(tt.binary)), 0755)
+			ioutil.WriteFile(path.Join(dir, tt.binary), nil, 0755)
+		}
+		if trust := DetectCATrust(dir); trust != tt.trust {
+			t.Errorf("bad trust (%q): want %+v, got %+v", tt.binary, tt.trust, trust)
+		}
+	}
+}
+
+func TestWriteTrustedCerts(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	trust := CATrust{"update-ca-certificates", "/usr/local/share/ca-certificates"}
+	anchors := path.Join(dir, trust.AnchorDir)
+	os.MkdirAll(anchors, 0755)
+	ioutil.WriteFile(path.Join(anchors, "local.crt"), []byte(testCACert), 0644)
+
+	if changed, err := trust.WriteTrustedCerts([]string{testCACert, testCACert}, dir); err != nil || !changed {
+		t.Fatalf("bad write: want true, <nil>, got %t, %v", changed, err)
+	}
+	if changed, err := trust.WriteTrustedCerts([]string{testCACert, testCACert}, dir); err != nil || changed {
+		t.Fatalf("bad rewrite: want false, <nil>, got %t, %v", changed, err)
+	}
+	if changed, err := trust.WriteTrustedCerts([]string{testCACert}, dir); err != nil || !changed {
+		t.Fatalf("bad removal: want true, <nil>, got %t, %v", changed, err)
+	}
+
+	entries, err := ioutil.ReadDir(anchors)
+	if err != nil {
+		t.Fatalf("Unable to read %s: %v", anchors, err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if len(names) != 2 || names[0] != "cloud-init-ca-cert-1.crt" || names[1] != "local.crt" {
+		t.Errorf("bad anchors: want [cloud-init-ca-cert-1.crt local.crt], got %v", names)
+	}
+}
+
+func TestRemoveDefaultCACerts(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(path.Join(dir, "etc"), 0755)
+	ioutil.WriteFile(path.Join(dir, CACertsConfPath), []byte("mozilla/ISRG_Root_X1.crt\n"), 0644)
+	trust := CATrust{"update-ca-certificates", "/usr/local/share/ca-certificates"}
+	if changed, err := trust.RemoveDefaults(dir); err != nil || !changed {
+		t.Fatalf("bad removal: want true, <nil>, got %t, %v", changed, err)
+	}
+	if contents, _ := ioutil.ReadFile(path.Join(dir, CACertsConfPath)); string(contents) != caCertsConf {
+		t.Errorf("bad %s: want %q, got %q", CACertsConfPath, caCertsConf, contents)
+	}
+
+	source := path.Join(dir, CATrustSourceDir)
+	os.MkdirAll(path.Join(source, "anchors"), 0755)
+	ioutil.WriteFile(path.Join(source, "ca-bundle.trust.p11-kit"), nil, 0644)
+	trust = CATrust{"update-ca-trust", "/etc/pki/ca-trust/source/anchors"}
+	if changed, err := trust.RemoveDefaults(dir); err != nil || !changed {
+		t.Fatalf("bad removal: want true, <nil>, got %t, %v", changed, err)
+	}
+	if entries, err := ioutil.ReadDir(source); err != nil || len(entries) != 0 {
+		t.Errorf("bad %s: want it empty, got %v, %v", CATrustSourceDir, entries, err)
+	}
+	if changed, err := trust.RemoveDefaults(dir); err != nil || changed {
+		t.Errorf("bad second removal: want false, <nil>, got %t, %v", changed, err)
+	}
+}
+
+func TestWriteCABundle(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	bundle := path.Join(dir, CACertsBundlePath)
+	os.MkdirAll(path.Dir(bundle), 0755)
+	ioutil.WriteFile(bundle, []byte("distro\n"), 0644)
+
+	if changed, err := WriteCABundle([]string{testCACert}, false, dir); err != nil || !changed {
+		t.Fatalf("bad write: want true, <nil>, got %t, %v", changed, err)
+	}
+	expected := "distro\n" + caCertsBegin + "\n" + testCACert + caCertsEnd + "\n"
+	if contents, _ := ioutil.ReadFile(bundle); string(contents) != expected {
+		t.Errorf("bad bundle: want %q, got %q", expected, contents)
+	}
+	if changed, err := WriteCABundle([]string{testCACert}, false, dir); err != nil || changed {
+		t.Errorf("bad rewrite: want false, <nil>, got %t, %v", changed, err)
+	}
+
+	if changed, err := WriteCABundle([]string{testCACert}, true, dir); err != nil || !changed {
+		t.Fatalf("bad write without defaults: want true, <nil>, got %t, %v", changed, err)
+	}
+	expected = caCertsBegin + "\n" + testCACert + caCertsEnd + "\n"
+	if contents, _ := ioutil.ReadFile(bundle); string(contents) != expected {
+		t.Errorf("bad bundle without defaults: want %q, got %q", expected, contents)
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"fmt"
+)
+
+const (
+	cryptAlphabet      = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	passwordAlphabet   = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	sha512SaltLength   = 16
+	sha512DefaultRound = 5000
+	randomPasswdLength = 20
+)
+
+// HashPassword hashes a plain text password with SHA-512 crypt and a random
+// salt, in the form expected in /etc/shadow.
+func HashPassword(password string) (string, error) {
+	salt, err := randomString(cryptAlphabet, sha512SaltLength)
+	if err != nil {
+		return "", err
+	}
+	return sha512Crypt([]byte(password), []byte(salt), sha512DefaultRound), nil
+}
+
+// RandomPassword generates a random alphanumeric password.
+func RandomPassword() (string, error) {
+	return randomString(passwordAlphabet, randomPasswdLength)
+}
+
+// randomString returns n characters picked uniformly at random from
+// alphabet.
+func randomString(alphabet string, n int) (string, error) {
+	// Bytes above the largest multiple of the alphabet size are rejected so
+	// that every character is equally likely.
+	limit := 256 - 256%len(alphabet)
+	out := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(out) < n {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if int(b) < limit && len(out) < n {
+				out = append(out, alphabet[int(b)%len(alphabet)])
+			}
+		}
+	}
+	return string(out), nil
+}
+
+// sha512Crypt implements the SHA-512 based crypt(3) scheme ("$6$") as
+// specified by Ulrich Drepper in "Unix crypt using SHA-256 and SHA-512".
+func sha512Crypt(key, salt []byte, rounds int) string {
+	if len(salt) > sha512SaltLength {
+		salt = salt[:sha512SaltLength]
+	}
+
+	b := sha512.New()
+	b.Write(key)
+	b.Write(salt)
+	b.Write(key)
+	digestB := b.Sum(nil)
+
+	a := sha512.New()
+	a.Write(key)
+	a.Write(salt)
+	a.Write(repeatBytes(digestB, len(key)))
+	for n := len(key); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			a.Write(digestB)
+		} else {
+			a.Write(key)
+		}
+	}
+	digestA := a.Sum(nil)
+
+	dp := sha512.New()
+	for range key {
+		dp.Write(key)
+	}
+	p := repeatBytes(dp.Sum(nil), len(key))
+
+	ds := sha512.New()
+	for i := 0; i < 16+int(digestA[0]); i++ {
+		ds.Write(salt)
+	}
+	s := repeatBytes(ds.Sum(nil), len(salt))
+
+	c := digestA
+	for i := 0; i < rounds; i++ {
+		h := sha512.New()
+		if i&1 != 0 {
+			h.Write(p)
+		} else {
+			h.Write(c)
+		}
+		if i%3 != 0 {
+			h.Write(s)
+		}
+		if i%7 != 0 {
+			h.Write(p)
+		}
+		if i&1 != 0 {
+			h.Write(c)
+		} else {
+			h.Write(p)
+		}
+		c = h.Sum(nil)
+	}
+
+	prefix := "$6$"
+	if rounds != sha512DefaultRound {
+		prefix = fmt.Sprintf("$6$rounds=%d$", rounds)
+	}
+	return prefix + string(salt) + "$" + encodeSHA512Crypt(c)
+}
+
+// repeatBytes returns the first n bytes of b repeated as often as needed.
+func repeatBytes(b []byte, n int) []byte {
+	out := make([]byte, 0, n)
+	for len(out) < n {
+		if n-len(out) < len(b) {
+			return append(out, b[:n-len(out)]...)
+		}
+		out = append(out, b...)
+	}
+	return out
+}
+
+// encodeSHA512Crypt encodes a SHA-512 crypt digest with the byte order and
+// base64 alphabet of crypt(3).
+func encodeSHA512Crypt(c []byte) string {
+	var out []byte
+	encode := func(b2, b1, b0 byte, n int) {
+		w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+		for ; n > 0; n-- {
+			out = append(out, cryptAlphabet[w&0x3f])
+			w >>= 6
+		}
+	}
+	for i := 0; i < 21; i++ {
+		switch i % 3 {
+		case 0:
+			encode(c[i], c[i+21], c[i+42], 4)
+		case 1:
+			encode(c[i+21], c[i+42], c[i], 4)
+		case 2:
+			encode(c[i+42], c[i], c[i+21], 4)
+		}
+	}
+	encode(0, 0, c[63], 2)
+	return string(out)
+}
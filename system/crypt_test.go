@@ -0,0 +1,85 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSHA512Crypt(t *testing.T) {
+	// Test vectors from "Unix crypt using SHA-256 and SHA-512".
+	for _, tt := range []struct {
+		key    string
+		salt   string
+		rounds int
+		hash   string
+	}{
+		{
+			"Hello world!", "saltstring", 5000,
+			"$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1",
+		},
+		{
+			"Hello world!", "saltstringsaltstring", 10000,
+			"$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v.",
+		},
+		{
+			"This is just a test", "toolongsaltstring", 5000,
+			"$6$toolongsaltstrin$lQ8jolhgVRVhY4b5pZKaysCLi0QBxGoNeKQzQ3glMhwllF7oGDZxUhx1yxdYcz/e1JSbq3y6JMxxl8audkUEm0",
+		},
+	} {
+		if hash := sha512Crypt([]byte(tt.key), []byte(tt.salt), tt.rounds); hash != tt.hash {
+			t.Errorf("bad hash of %q with salt %q: want %q, got %q", tt.key, tt.salt, tt.hash, hash)
+		}
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	a, err := HashPassword("secret")
+	if err != nil {
+		t.Fatalf("Unable to hash password: %v", err)
+	}
+	b, err := HashPassword("secret")
+	if err != nil {
+		t.Fatalf("Unable to hash password: %v", err)
+	}
+	if a == b {
+		t.Errorf("bad hashes: want different salts, got %q twice", a)
+	}
+	parts := strings.Split(a, "$")
+	if len(parts) != 4 || parts[1] != "6" || len(parts[2]) != 16 || len(parts[3]) != 86 {
+		t.Fatalf("bad hash format: %q", a)
+	}
+	if hash := sha512Crypt([]byte("secret"), []byte(parts[2]), 5000); hash != a {
+		t.Errorf("bad hash: want %q, got %q", hash, a)
+	}
+}
+
+func TestRandomPassword(t *testing.T) {
+	a, err := RandomPassword()
+	if err != nil {
+		t.Fatalf("Unable to generate password: %v", err)
+	}
+	b, err := RandomPassword()
+	if err != nil {
+		t.Fatalf("Unable to generate password: %v", err)
+	}
+	if len(a) != 20 || strings.Trim(a, passwordAlphabet) != "" {
+		t.Errorf("bad password: %q", a)
+	}
+	if a == b {
+		t.Errorf("bad passwords: want different passwords, got %q twice", a)
+	}
+}
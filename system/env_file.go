@@ -19,7 +19,6 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
-	"path"
 	"regexp"
 	"sort"
 )
@@ -85,7 +84,12 @@ func WriteEnvFile(ef *EnvFile, root string) error {
 		return nil
 	}
 
-	oldContent, err := ioutil.ReadFile(path.Join(root, ef.Path))
+	fullpath, err := SecureJoin(root, ef.Path)
+	if err != nil {
+		return err
+	}
+
+	oldContent, err := ioutil.ReadFile(fullpath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			oldContent = []byte{}
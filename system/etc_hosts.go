@@ -16,47 +16,109 @@ package system
 
 import (
 	"errors"
-	"fmt"
+	"io/ioutil"
+	"net"
 	"os"
-	"path"
+	"strings"
 
 	"github.com/elotl/cloud-init/config"
 )
 
-const DefaultIpv4Address = "127.0.0.1"
+const (
+	// EtcHostsPath is the path of the hosts file.
+	EtcHostsPath = "/etc/hosts"
+	// EtcHostsTemplatePath is the path of the template which replaces
+	// DefaultEtcHostsTemplate, if present.
+	EtcHostsTemplatePath = "/etc/cloud-init/templates/hosts.tmpl"
+
+	etcHostsBegin = "# BEGIN cloud-init managed entries"
+	etcHostsEnd   = "# END cloud-init managed entries"
+)
+
+// DefaultEtcHostsTemplate is the hosts file rendered when manage_etc_hosts is
+// true or template. $hostname and $fqdn are replaced by the names of the
+// host, and $private_ipv4 and the like by the addresses of the metadata.
+const DefaultEtcHostsTemplate = `127.0.0.1 localhost
+127.0.1.1 $fqdn $hostname
+$private_ipv4 $fqdn $hostname
+::1 localhost ip6-localhost ip6-loopback
+$private_ipv6 $fqdn $hostname
+ff02::1 ip6-allnodes
+ff02::2 ip6-allrouters
+`
+
+// localhostEtcHostsTemplate is the template used when manage_etc_hosts is
+// localhost, to only resolve the names of the host to a loopback address.
+const localhostEtcHostsTemplate = "127.0.1.1 $fqdn $hostname\n"
 
 type EtcHosts struct {
 	config.EtcHosts
 }
 
-func (eh EtcHosts) generateEtcHosts() (out string, err error) {
-	if eh.EtcHosts != "localhost" {
+// Template returns the template of the entries to manage in /etc/hosts,
+// which is empty if it is not managed.
+func (eh EtcHosts) Template(root string) (string, error) {
+	switch eh.EtcHosts {
+	case "", "false":
+		return "", nil
+	case "localhost":
+		return localhostEtcHostsTemplate, nil
+	case "true", "template":
+		fullpath, err := SecureJoin(root, EtcHostsTemplatePath)
+		if err != nil {
+			return "", err
+		}
+		contents, err := ioutil.ReadFile(fullpath)
+		if os.IsNotExist(err) {
+			return DefaultEtcHostsTemplate, nil
+		}
+		return string(contents), err
+	default:
 		return "", errors.New("Invalid option to manage_etc_hosts")
 	}
+}
 
-	// use the operating system hostname
-	hostname, err := os.Hostname()
+// UpdateEtcHosts replaces the entries managed by cloud-init in /etc/hosts
+// under root with the given ones, leaving the other entries as they are.
+// The managed entries come first so that they take precedence. Entries
+// without an address, such as those of a template referring to an address
+// the metadata lacks, are dropped. It reports whether the file changed.
+func UpdateEtcHosts(entries, root string) (bool, error) {
+	fullpath, err := SecureJoin(root, EtcHostsPath)
 	if err != nil {
-		return "", err
+		return false, err
 	}
-
-	return fmt.Sprintf("%s %s\n", DefaultIpv4Address, hostname), nil
-
-}
-
-func (eh EtcHosts) File() (*File, error) {
-	if eh.EtcHosts == "" {
-		return nil, nil
+	contents, err := ioutil.ReadFile(fullpath)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
 	}
-
-	etcHosts, err := eh.generateEtcHosts()
+	before, _, after, _, err := splitBlock(string(contents), etcHostsBegin, etcHostsEnd)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
 
-	return &File{config.File{
-		Path:               path.Join("etc", "hosts"),
+	out := []string{etcHostsBegin}
+	for _, line := range strings.Split(entries, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || net.ParseIP(fields[0]) == nil {
+			continue
+		}
+		out = append(out, strings.Join(fields, " "))
+	}
+	out = append(out, etcHostsEnd)
+	out = append(append(out, before...), after...)
+	updated := strings.Join(out, "\n") + "\n"
+	if updated == string(contents) {
+		return false, nil
+	}
+
+	file := File{config.File{
+		Path:               EtcHostsPath,
 		RawFilePermissions: "0644",
-		Content:            etcHosts,
-	}}, nil
+		Content:            updated,
+	}}
+	if _, err := WriteFile(&file, root); err != nil {
+		return false, err
+	}
+	return true, nil
 }
@@ -16,45 +16,93 @@ package system
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path"
 	"reflect"
 	"testing"
 
 	"github.com/elotl/cloud-init/config"
 )
 
-func TestEtcdHostsFile(t *testing.T) {
-	hostname, err := os.Hostname()
+func TestEtcHostsTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
 	if err != nil {
-		panic(err)
+		t.Fatalf("Unable to create tempdir: %v", err)
 	}
+	defer os.RemoveAll(dir)
 
 	for _, tt := range []struct {
-		config config.EtcHosts
-		file   *File
-		err    error
+		config   config.EtcHosts
+		template string
+		err      error
 	}{
+		{"", "", nil},
+		{"false", "", nil},
+		{"invalid", "", fmt.Errorf("Invalid option to manage_etc_hosts")},
+		{"localhost", "127.0.1.1 $fqdn $hostname\n", nil},
+		{"true", DefaultEtcHostsTemplate, nil},
+		{"template", DefaultEtcHostsTemplate, nil},
+	} {
+		template, err := EtcHosts{tt.config}.Template(dir)
+		if !reflect.DeepEqual(tt.err, err) {
+			t.Errorf("bad error (%q): want %q, got %q", tt.config, tt.err, err)
+		}
+		if template != tt.template {
+			t.Errorf("bad template (%q): want %q, got %q", tt.config, tt.template, template)
+		}
+	}
+
+	os.MkdirAll(path.Join(dir, path.Dir(EtcHostsTemplatePath)), 0755)
+	ioutil.WriteFile(path.Join(dir, EtcHostsTemplatePath), []byte("10.0.0.1 $fqdn\n"), 0644)
+	if template, err := (EtcHosts{"template"}).Template(dir); err != nil || template != "10.0.0.1 $fqdn\n" {
+		t.Errorf("bad custom template: want %q, <nil>, got %q, %v", "10.0.0.1 $fqdn\n", template, err)
+	}
+}
+
+func TestUpdateEtcHosts(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(path.Join(dir, "etc"), 0755)
+	fullpath := path.Join(dir, EtcHostsPath)
+	ioutil.WriteFile(fullpath, []byte("# static entries\n10.1.1.1 registry\n"), 0644)
+
+	for _, tt := range []struct {
+		entries  string
+		expected string
+		changed  bool
+	}{
+		{
+			entries:  "127.0.1.1 core.example.com core\n fqdn core\n::1  localhost\n",
+			expected: "# BEGIN cloud-init managed entries\n127.0.1.1 core.example.com core\n::1 localhost\n# END cloud-init managed entries\n# static entries\n10.1.1.1 registry\n",
+			changed:  true,
+		},
 		{
-			"invalid",
-			nil,
-			fmt.Errorf("Invalid option to manage_etc_hosts"),
+			entries:  "127.0.1.1 core.example.com core\n::1 localhost\n",
+			expected: "# BEGIN cloud-init managed entries\n127.0.1.1 core.example.com core\n::1 localhost\n# END cloud-init managed entries\n# static entries\n10.1.1.1 registry\n",
 		},
 		{
-			"localhost",
-			&File{config.File{
-				Content:            fmt.Sprintf("127.0.0.1 %s\n", hostname),
-				Path:               "etc/hosts",
-				RawFilePermissions: "0644",
-			}},
-			nil,
+			entries:  "10.0.0.2 node.example.com node\n",
+			expected: "# BEGIN cloud-init managed entries\n10.0.0.2 node.example.com node\n# END cloud-init managed entries\n# static entries\n10.1.1.1 registry\n",
+			changed:  true,
 		},
 	} {
-		file, err := EtcHosts{tt.config}.File()
-		if !reflect.DeepEqual(tt.err, err) {
-			t.Errorf("bad error (%q): want %q, got %q", tt.config, tt.err, err)
+		changed, err := UpdateEtcHosts(tt.entries, dir)
+		if err != nil {
+			t.Fatalf("Unexpected error while updating /etc/hosts: %v", err)
+		}
+		if changed != tt.changed {
+			t.Errorf("bad changed (%q): want %t, got %t", tt.entries, tt.changed, changed)
+		}
+		contents, err := ioutil.ReadFile(fullpath)
+		if err != nil {
+			t.Fatalf("Unable to read /etc/hosts: %v", err)
 		}
-		if !reflect.DeepEqual(tt.file, file) {
-			t.Errorf("bad units (%q): want %#v, got %#v", tt.config, tt.file, file)
+		if string(contents) != tt.expected {
+			t.Errorf("bad /etc/hosts (%q): want %q, got %q", tt.entries, tt.expected, contents)
 		}
 	}
 }
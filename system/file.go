@@ -19,9 +19,9 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
 	"path"
 	"strconv"
+	"strings"
 
 	"github.com/elotl/cloud-init/config"
 )
@@ -51,7 +51,10 @@ func WriteFile(f *File, root string) (string, error) {
 		return "", fmt.Errorf("Unable to write file with encoding %s", f.Encoding)
 	}
 
-	fullpath := path.Join(root, f.Path)
+	fullpath, err := SecureJoin(root, f.Path)
+	if err != nil {
+		return "", err
+	}
 	dir := path.Dir(fullpath)
 	log.Printf("Writing file to %q", fullpath)
 
@@ -84,9 +87,13 @@ func WriteFile(f *File, root string) (string, error) {
 	}
 
 	if f.Owner != "" {
-		// We shell out since we don't have a way to look up unix groups natively
-		cmd := exec.Command("chown", f.Owner, tmp.Name())
-		if err := cmd.Run(); err != nil {
+		uid, gid, err := NewPasswd(root).ResolveOwner(f.Owner)
+		if err != nil {
+			os.Remove(tmp.Name())
+			return "", fmt.Errorf("Unable to resolve owner %q of %s: %v", f.Owner, f.Path, err)
+		}
+		if err := os.Chown(tmp.Name(), uid, gid); err != nil {
+			os.Remove(tmp.Name())
 			return "", err
 		}
 	}
@@ -99,6 +106,22 @@ func WriteFile(f *File, root string) (string, error) {
 	return fullpath, nil
 }
 
+// writeFileIfChanged writes the file under root unless it already has the
+// same contents, and reports whether it was written.
+func writeFileIfChanged(f *File, root string) (bool, error) {
+	fullpath, err := SecureJoin(root, f.Path)
+	if err != nil {
+		return false, err
+	}
+	if contents, err := ioutil.ReadFile(fullpath); err == nil && string(contents) == f.Content {
+		return false, nil
+	}
+	if _, err := WriteFile(f, root); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func EnsureDirectoryExists(dir string) error {
 	info, err := os.Stat(dir)
 	if err == nil {
@@ -113,3 +136,32 @@ func EnsureDirectoryExists(dir string) error {
 	}
 	return nil
 }
+
+// splitBlock splits the lines of contents around the block delimited by the
+// lines begin and end, which are not part of any of the returned lines. The
+// block is reported as not found if begin is missing, and as an error if
+// end does not follow it.
+func splitBlock(contents, begin, end string) (before, block, after []string, found bool, err error) {
+	if contents == "" {
+		return nil, nil, nil, false, nil
+	}
+	inBlock := false
+	for _, line := range strings.Split(strings.TrimSuffix(contents, "\n"), "\n") {
+		switch {
+		case strings.TrimSpace(line) == begin && !found:
+			inBlock, found = true, true
+		case strings.TrimSpace(line) == end && inBlock:
+			inBlock = false
+		case inBlock:
+			block = append(block, line)
+		case found:
+			after = append(after, line)
+		default:
+			before = append(before, line)
+		}
+	}
+	if inBlock {
+		return nil, nil, nil, false, fmt.Errorf("%q is not followed by %q", begin, end)
+	}
+	return before, block, after, found, nil
+}
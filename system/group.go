@@ -0,0 +1,80 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/elotl/cloud-init/config"
+)
+
+// CreateGroup creates the given group with m unless a group of the same
+// name already exists. An existing group with a different gid than the one
+// requested is reported as an error.
+func CreateGroup(g *config.Group, m UserManager, root string) (created bool, err error) {
+	existing, err := NewPasswd(root).LookupGroup(g.Name)
+	if err == nil {
+		if g.Gid != 0 && existing.Gid != g.Gid {
+			return false, fmt.Errorf("group %q already exists with gid %d, not %d", g.Name, existing.Gid, g.Gid)
+		}
+		return false, nil
+	} else if _, ok := err.(UnknownGroupError); !ok {
+		return false, err
+	}
+
+	if err := m.CreateGroup(g); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// AddGroupMembers adds the members of the given group that do not belong to
+// it yet with m. Every member is tried; the error returned lists those that
+// could not be added.
+func AddGroupMembers(g *config.Group, m UserManager, root string) error {
+	passwd := NewPasswd(root)
+	existing, err := passwd.LookupGroup(g.Name)
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, member := range g.Members {
+		if contains(existing.Members, member) {
+			continue
+		}
+		if _, err := passwd.LookupUser(member); err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%v)", member, err))
+			continue
+		}
+		if err := m.AddUserToGroup(member, g.Name); err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%v)", member, strings.TrimSpace(err.Error())))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("unable to add members to group %q: %s", g.Name, strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"os"
+	"testing"
+
+	"github.com/elotl/cloud-init/config"
+)
+
+func TestCreateExistingGroup(t *testing.T) {
+	dir := makeTestRoot(t)
+	defer os.RemoveAll(dir)
+
+	for _, tt := range []struct {
+		group config.Group
+		fail  bool
+	}{
+		{group: config.Group{Name: "docker"}},
+		{group: config.Group{Name: "docker", Gid: 233, System: true}},
+		{group: config.Group{Name: "docker", Gid: 999}, fail: true},
+	} {
+		created, err := CreateGroup(&tt.group, NewFileUserManager(dir), dir)
+		if tt.fail != (err != nil) {
+			t.Errorf("bad error creating %+v: want failure %t, got %v", tt.group, tt.fail, err)
+		}
+		if created {
+			t.Errorf("bad result creating %+v: existing group was created", tt.group)
+		}
+	}
+}
+
+func TestAddGroupMembers(t *testing.T) {
+	dir := makeTestRoot(t)
+	defer os.RemoveAll(dir)
+
+	// Members already in the group are left alone.
+	if err := AddGroupMembers(&config.Group{Name: "wheel", Members: []string{"root", "core"}}, NewFileUserManager(dir), dir); err != nil {
+		t.Errorf("bad error adding existing members: want nil, got %v", err)
+	}
+
+	if err := AddGroupMembers(&config.Group{Name: "wheel", Members: []string{"core", "nobody"}}, NewFileUserManager(dir), dir); err == nil {
+		t.Errorf("bad error adding unknown member: want failure, got nil")
+	}
+
+	if err := AddGroupMembers(&config.Group{Name: "missing", Members: []string{"core"}}, NewFileUserManager(dir), dir); err == nil {
+		t.Errorf("bad error adding to unknown group: want failure, got nil")
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"github.com/elotl/cloud-init/config"
+)
+
+const (
+	// ModulesLoadPath lists the kernel modules to load on boot.
+	ModulesLoadPath = "/etc/modules-load.d/90-cloud-init.conf"
+	// ModprobeOptionsPath holds the parameters of the kernel modules.
+	ModprobeOptionsPath = "/etc/modprobe.d/90-cloud-init.conf"
+
+	kernelModulesHeader = "# Generated by cloud-init from the kernel_modules of the cloud-config."
+)
+
+// KernelModuleFiles returns the file listing the modules to load on boot
+// and, if any of them has parameters, the file giving them to modprobe.
+func KernelModuleFiles(modules []config.KernelModule) []*File {
+	load := []string{kernelModulesHeader}
+	options := []string{kernelModulesHeader}
+	for _, m := range modules {
+		load = append(load, m.Name)
+		if params := m.Params(); len(params) > 0 {
+			options = append(options, "options "+m.Name+" "+strings.Join(params, " "))
+		}
+	}
+	files := []*File{{config.File{
+		Path:               ModulesLoadPath,
+		RawFilePermissions: "0644",
+		Content:            strings.Join(load, "\n") + "\n",
+	}}}
+	if len(options) > 1 {
+		files = append(files, &File{config.File{
+			Path:               ModprobeOptionsPath,
+			RawFilePermissions: "0644",
+			Content:            strings.Join(options, "\n") + "\n",
+		}})
+	}
+	return files
+}
+
+// WriteKernelModuleConfig writes the KernelModuleFiles of the modules under
+// root, removing the options left by an earlier configuration if none of
+// the modules has parameters. It returns the paths it changed.
+func WriteKernelModuleConfig(modules []config.KernelModule, root string) ([]string, error) {
+	var written []string
+	files := KernelModuleFiles(modules)
+	for _, f := range files {
+		changed, err := writeFileIfChanged(f, root)
+		if err != nil {
+			return written, err
+		}
+		if changed {
+			written = append(written, f.Path)
+		}
+	}
+	if len(files) == 1 {
+		fullpath, err := SecureJoin(root, ModprobeOptionsPath)
+		if err != nil {
+			return written, err
+		}
+		if err := os.Remove(fullpath); err == nil {
+			written = append(written, ModprobeOptionsPath)
+		} else if !os.IsNotExist(err) {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// LoadKernelModule loads a kernel module into the running kernel with
+// modprobe, passing it the given parameters.
+func LoadKernelModule(name string, params ...string) error {
+	log.Printf("Probing LKM %q (%q)\n", name, params)
+	return execCommand("modprobe", append([]string{name}, params...)...)
+}
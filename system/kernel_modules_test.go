@@ -0,0 +1,78 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/elotl/cloud-init/config"
+)
+
+func TestWriteKernelModuleConfig(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tt := range []struct {
+		modules []config.KernelModule
+		written []string
+		load    string
+		options string
+	}{
+		{
+			modules: []config.KernelModule{
+				{Name: "br_netfilter"},
+				{Name: "bonding", Parameters: map[string]string{"mode": "4", "miimon": "100"}},
+			},
+			written: []string{ModulesLoadPath, ModprobeOptionsPath},
+			load:    kernelModulesHeader + "\nbr_netfilter\nbonding\n",
+			options: kernelModulesHeader + "\noptions bonding miimon=100 mode=4\n",
+		},
+		{
+			modules: []config.KernelModule{
+				{Name: "br_netfilter"},
+				{Name: "bonding", Parameters: map[string]string{"mode": "4", "miimon": "100"}},
+			},
+			load:    kernelModulesHeader + "\nbr_netfilter\nbonding\n",
+			options: kernelModulesHeader + "\noptions bonding miimon=100 mode=4\n",
+		},
+		{
+			// The options of modules left out are removed.
+			modules: []config.KernelModule{{Name: "br_netfilter"}},
+			written: []string{ModulesLoadPath, ModprobeOptionsPath},
+			load:    kernelModulesHeader + "\nbr_netfilter\n",
+		},
+	} {
+		written, err := WriteKernelModuleConfig(tt.modules, dir)
+		if err != nil {
+			t.Fatalf("Unexpected error writing %v: %v", tt.modules, err)
+		}
+		if !reflect.DeepEqual(tt.written, written) {
+			t.Errorf("bad written paths (%v): want %v, got %v", tt.modules, tt.written, written)
+		}
+		if contents, _ := ioutil.ReadFile(path.Join(dir, ModulesLoadPath)); string(contents) != tt.load {
+			t.Errorf("bad %s (%v): want %q, got %q", ModulesLoadPath, tt.modules, tt.load, contents)
+		}
+		if contents, _ := ioutil.ReadFile(path.Join(dir, ModprobeOptionsPath)); string(contents) != tt.options {
+			t.Errorf("bad %s (%v): want %q, got %q", ModprobeOptionsPath, tt.modules, tt.options, contents)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"bufio"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/elotl/cloud-init/config"
+)
+
+const (
+	// FstabPath is the path of the table of filesystems to mount.
+	FstabPath = "/etc/fstab"
+	// DefaultSwapFile is the swap file created when swap has no filename.
+	DefaultSwapFile = "/swap.img"
+
+	fstabBegin = "# BEGIN cloud-init mounts"
+	fstabEnd   = "# END cloud-init mounts"
+
+	gigabyte = int64(1) << 30
+)
+
+// Mounter formats, activates and mounts what /etc/fstab describes. Paths
+// are relative to the root the Mounter was created for.
+type Mounter interface {
+	// Mkswap formats a file as swap.
+	Mkswap(path string) error
+	// Swapon activates a swap file, unless it is active already.
+	Swapon(path string) error
+	// MountAll mounts the entries of /etc/fstab which are not mounted.
+	MountAll() error
+}
+
+// NewMounter returns a Mounter running mkswap, swapon and mount within
+// root.
+func NewMounter(root string) Mounter {
+	return commandMounter{root}
+}
+
+type commandMounter struct {
+	root string
+}
+
+func (m commandMounter) Mkswap(path string) error {
+	return execCommandIn(m.root, "mkswap", path)
+}
+
+func (m commandMounter) Swapon(path string) error {
+	if filepath.Clean(m.root) == "/" && swapActive(path) {
+		return nil
+	}
+	return execCommandIn(m.root, "swapon", path)
+}
+
+func (m commandMounter) MountAll() error {
+	return execCommandIn(m.root, "mount", "-a")
+}
+
+// swapActive determines if the swap file at path is listed in /proc/swaps.
+func swapActive(path string) bool {
+	f, err := os.Open("/proc/swaps")
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) > 0 && fields[0] == path {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateFstab replaces the entries managed by cloud-init at the end of
+// /etc/fstab under root with those of the mounts. Other entries for the
+// same mount points, and the entries of the devices of mounts without a
+// mount point, are removed. It reports whether the file changed.
+func UpdateFstab(mounts []config.Mount, root string) (bool, error) {
+	fullpath, err := SecureJoin(root, FstabPath)
+	if err != nil {
+		return false, err
+	}
+	contents, err := ioutil.ReadFile(fullpath)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	before, _, after, _, err := splitBlock(string(contents), fstabBegin, fstabEnd)
+	if err != nil {
+		return false, err
+	}
+
+	var entries []string
+	mountPoints := map[string]bool{}
+	devices := map[string]bool{}
+	for _, m := range mounts {
+		fields := m.Fields()
+		if m.Removes() || fields[1] == "none" {
+			devices[fields[0]] = true
+		} else {
+			mountPoints[fields[1]] = true
+		}
+		if !m.Removes() {
+			entries = append(entries, strings.Join(fields, "\t"))
+		}
+	}
+
+	var out []string
+	for _, line := range append(before, after...) {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && !strings.HasPrefix(fields[0], "#") && (devices[fields[0]] || mountPoints[fields[1]]) {
+			log.Printf("Removing %q from %s", line, FstabPath)
+			continue
+		}
+		out = append(out, line)
+	}
+	if len(entries) > 0 {
+		out = append(append(append(out, fstabBegin), entries...), fstabEnd)
+	}
+	updated := ""
+	if len(out) > 0 {
+		updated = strings.Join(out, "\n") + "\n"
+	}
+	if updated == string(contents) {
+		return false, nil
+	}
+
+	file := File{config.File{
+		Path:               FstabPath,
+		RawFilePermissions: "0644",
+		Content:            updated,
+	}}
+	if _, err := WriteFile(&file, root); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SwapSize returns the size of the swap file in bytes. An auto size is
+// derived from the memory of the host, up to the maxsize of the swap or
+// else up to 8G and half of the space available for the file under root.
+func SwapSize(swap config.Swap, root string) (int64, error) {
+	if swap.Size != "auto" {
+		return config.ParseSize(swap.Size)
+	}
+	var info syscall.Sysinfo_t
+	if err := syscall.Sysinfo(&info); err != nil {
+		return 0, err
+	}
+	memory := int64(info.Totalram) * int64(info.Unit)
+
+	maxSize := 8 * gigabyte
+	if swap.MaxSize != "" {
+		var err error
+		if maxSize, err = config.ParseSize(swap.MaxSize); err != nil {
+			return 0, err
+		}
+	} else {
+		dir, err := SecureJoin(root, path.Dir(swapFilename(swap)))
+		if err != nil {
+			return 0, err
+		}
+		var fs syscall.Statfs_t
+		if err := syscall.Statfs(dir, &fs); err != nil {
+			return 0, err
+		}
+		if available := int64(fs.Bavail) * int64(fs.Bsize) / 2; available < maxSize {
+			maxSize = available
+		}
+	}
+	return suggestedSwapSize(memory, maxSize), nil
+}
+
+// suggestedSwapSize sizes swap after memory: as much as small amounts of
+// memory, 4G for up to 16G of memory, and the square root of larger
+// amounts in gigabytes, up to maxSize.
+func suggestedSwapSize(memory, maxSize int64) int64 {
+	size := memory
+	switch {
+	case memory < 4*gigabyte:
+	case memory < 16*gigabyte:
+		size = 4 * gigabyte
+	default:
+		size = int64(math.Round(math.Sqrt(float64(memory/gigabyte)))) * gigabyte
+	}
+	if size > maxSize {
+		size = maxSize
+	}
+	return size
+}
+
+func swapFilename(swap config.Swap) string {
+	if swap.Filename == "" {
+		return DefaultSwapFile
+	}
+	return swap.Filename
+}
+
+// CreateSwapFile creates the swap file of the given size under root, with
+// all of its blocks allocated as swapon requires. An existing file is left
+// as it is. It reports whether the file was created.
+func CreateSwapFile(swap config.Swap, size int64, root string) (bool, error) {
+	fullpath, err := SecureJoin(root, swapFilename(swap))
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(fullpath); err == nil {
+		return false, nil
+	}
+	if err := EnsureDirectoryExists(path.Dir(fullpath)); err != nil {
+		return false, err
+	}
+	f, err := os.OpenFile(fullpath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return false, err
+	}
+	if err := allocate(f, size); err != nil {
+		f.Close()
+		os.Remove(fullpath)
+		return false, err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(fullpath)
+		return false, err
+	}
+	return true, nil
+}
+
+// allocate allocates size bytes of f, writing zeros where the filesystem
+// does not support fallocate.
+func allocate(f *os.File, size int64) error {
+	if err := syscall.Fallocate(int(f.Fd()), 0, 0, size); err == nil {
+		return nil
+	}
+	zeros := make([]byte, 1<<20)
+	for written := int64(0); written < size; {
+		chunk := zeros
+		if size-written < int64(len(chunk)) {
+			chunk = chunk[:size-written]
+		}
+		n, err := f.Write(chunk)
+		if err != nil {
+			return err
+		}
+		written += int64(n)
+	}
+	return nil
+}
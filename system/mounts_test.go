@@ -0,0 +1,131 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/elotl/cloud-init/config"
+)
+
+func TestUpdateFstab(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fullpath := path.Join(dir, FstabPath)
+	os.MkdirAll(path.Dir(fullpath), 0755)
+	ioutil.WriteFile(fullpath, []byte(`# <file system> <mount point> <type> <options> <dump> <pass>
+/dev/sda1 / ext4 defaults 0 1
+/dev/sdb /mnt auto defaults 0 2
+/dev/sdc /data auto defaults 0 2
+`), 0644)
+
+	mounts := []config.Mount{
+		{Device: "sdb", MountPoint: "/var/lib/itzo"},
+		{Device: "LABEL=data", MountPoint: "/data", Type: "ext4", Options: "noatime"},
+		{Device: "/swap.img", MountPoint: "none", Type: "swap", Options: "sw", Freq: "0", Passno: "0"},
+		{Device: "sdd"},
+	}
+	if changed, err := UpdateFstab(mounts, dir); err != nil || !changed {
+		t.Fatalf("bad update: want true, <nil>, got %t, %v", changed, err)
+	}
+	expected := `# <file system> <mount point> <type> <options> <dump> <pass>
+/dev/sda1 / ext4 defaults 0 1
+/dev/sdb /mnt auto defaults 0 2
+# BEGIN cloud-init mounts
+/dev/sdb	/var/lib/itzo	auto	defaults,nofail	0	2
+LABEL=data	/data	ext4	noatime	0	2
+/swap.img	none	swap	sw	0	0
+# END cloud-init mounts
+`
+	contents, err := ioutil.ReadFile(fullpath)
+	if err != nil {
+		t.Fatalf("Unable to read %s: %v", fullpath, err)
+	}
+	if string(contents) != expected {
+		t.Errorf("bad fstab: want %q, got %q", expected, contents)
+	}
+
+	if changed, err := UpdateFstab(mounts, dir); err != nil || changed {
+		t.Errorf("bad rewrite: want false, <nil>, got %t, %v", changed, err)
+	}
+
+	// Removing the device of the managed entry removes the block.
+	if changed, err := UpdateFstab([]config.Mount{{Device: "/swap.img"}}, dir); err != nil || !changed {
+		t.Fatalf("bad removal: want true, <nil>, got %t, %v", changed, err)
+	}
+	expected = `# <file system> <mount point> <type> <options> <dump> <pass>
+/dev/sda1 / ext4 defaults 0 1
+/dev/sdb /mnt auto defaults 0 2
+`
+	if contents, _ := ioutil.ReadFile(fullpath); string(contents) != expected {
+		t.Errorf("bad fstab after removal: want %q, got %q", expected, contents)
+	}
+}
+
+func TestSuggestedSwapSize(t *testing.T) {
+	for _, tt := range []struct {
+		memory  int64
+		maxSize int64
+		size    int64
+	}{
+		{512 << 20, 8 * gigabyte, 512 << 20},
+		{2 * gigabyte, 1 * gigabyte, 1 * gigabyte},
+		{8 * gigabyte, 8 * gigabyte, 4 * gigabyte},
+		{64 * gigabyte, 16 * gigabyte, 8 * gigabyte},
+		{256 * gigabyte, 8 * gigabyte, 8 * gigabyte},
+	} {
+		if size := suggestedSwapSize(tt.memory, tt.maxSize); size != tt.size {
+			t.Errorf("bad size (%d, %d): want %d, got %d", tt.memory, tt.maxSize, tt.size, size)
+		}
+	}
+}
+
+func TestCreateSwapFile(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	swap := config.Swap{Filename: "/var/swap", Size: "1M"}
+	size, err := SwapSize(swap, dir)
+	if err != nil || size != 1<<20 {
+		t.Fatalf("bad size: want %d, <nil>, got %d, %v", 1<<20, size, err)
+	}
+	if created, err := CreateSwapFile(swap, size, dir); err != nil || !created {
+		t.Fatalf("bad creation: want true, <nil>, got %t, %v", created, err)
+	}
+	info, err := os.Stat(path.Join(dir, "var/swap"))
+	if err != nil {
+		t.Fatalf("Unable to stat the swap file: %v", err)
+	}
+	if info.Size() != size || info.Mode().Perm() != 0600 {
+		t.Errorf("bad swap file: want %d bytes and 0600, got %d bytes and %o", size, info.Size(), info.Mode().Perm())
+	}
+	if created, err := CreateSwapFile(swap, size, dir); err != nil || created {
+		t.Errorf("bad recreation: want false, <nil>, got %t, %v", created, err)
+	}
+
+	if size, err := SwapSize(config.Swap{Size: "auto", MaxSize: "1M"}, dir); err != nil || size > 1<<20 {
+		t.Errorf("bad auto size: want at most %d, got %d, %v", 1<<20, size, err)
+	}
+}
@@ -17,7 +17,6 @@ package system
 import (
 	"log"
 	"net"
-	"os/exec"
 	"strings"
 
 	"github.com/elotl/cloud-init/config"
@@ -69,8 +68,7 @@ func downNetworkInterfaces(interfaces []network.InterfaceGenerator) error {
 func maybeProbe8012q(interfaces []network.InterfaceGenerator) error {
 	for _, iface := range interfaces {
 		if iface.Type() == "vlan" {
-			log.Printf("Probing LKM %q (%q)\n", "8021q", "8021q")
-			return exec.Command("modprobe", "8021q").Run()
+			return LoadKernelModule("8021q")
 		}
 	}
 	return nil
@@ -79,9 +77,7 @@ func maybeProbe8012q(interfaces []network.InterfaceGenerator) error {
 func maybeProbeBonding(interfaces []network.InterfaceGenerator) error {
 	for _, iface := range interfaces {
 		if iface.Type() == "bond" {
-			args := append([]string{"bonding"}, strings.Split(iface.ModprobeParams(), " ")...)
-			log.Printf("Probing LKM %q (%q)\n", "bonding", args)
-			return exec.Command("modprobe", args...).Run()
+			return LoadKernelModule("bonding", strings.Split(iface.ModprobeParams(), " ")...)
 		}
 	}
 	return nil
@@ -0,0 +1,198 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/elotl/cloud-init/config"
+)
+
+// The NTP clients NTP configures.
+const (
+	NTPClientChrony    = "chrony"
+	NTPClientNTPd      = "ntpd"
+	NTPClientBusybox   = "busybox"
+	NTPClientTimesyncd = "systemd-timesyncd"
+)
+
+const (
+	// BusyboxNTPdConfigPath is where OpenRC takes the options of the
+	// busybox ntpd from.
+	BusyboxNTPdConfigPath = "/etc/conf.d/ntpd"
+	// TimesyncdDropInPath is the drop-in configuring systemd-timesyncd.
+	TimesyncdDropInPath = "/etc/systemd/timesyncd.conf.d/90-cloud-init.conf"
+
+	ntpHeader = "# Generated by cloud-init from the ntp of the cloud-config."
+)
+
+// DefaultNTPPools are the pools synchronized with when neither servers nor
+// pools are given.
+var DefaultNTPPools = []string{"0.pool.ntp.org", "1.pool.ntp.org", "2.pool.ntp.org", "3.pool.ntp.org"}
+
+// ntpClientBinaries are the programs telling each NTP client is installed,
+// in order of preference.
+var ntpClientBinaries = []struct {
+	client string
+	paths  []string
+}{
+	{NTPClientChrony, []string{"/usr/sbin/chronyd", "/usr/bin/chronyd"}},
+	{NTPClientNTPd, []string{"/usr/sbin/ntpd", "/usr/bin/ntpd"}},
+	{NTPClientTimesyncd, []string{"/lib/systemd/systemd-timesyncd", "/usr/lib/systemd/systemd-timesyncd"}},
+	{NTPClientBusybox, []string{"/bin/busybox"}},
+}
+
+type NTP struct {
+	config.NTP
+}
+
+// Client returns the NTP client to configure under root: the one chosen in
+// the cloud-config or else the first one installed.
+func (n NTP) Client(root string) (string, error) {
+	if n.NTPClient != "" && n.NTPClient != "auto" {
+		return n.NTPClient, nil
+	}
+	for _, b := range ntpClientBinaries {
+		for _, p := range b.paths {
+			fullpath, err := SecureJoin(root, p)
+			if err != nil {
+				return "", err
+			}
+			if _, err := os.Stat(fullpath); err != nil {
+				continue
+			}
+			// ntpd may be a link to the applet of busybox.
+			if b.client == NTPClientNTPd && path.Base(fullpath) == "busybox" {
+				return NTPClientBusybox, nil
+			}
+			return b.client, nil
+		}
+	}
+	return "", errors.New("no NTP client found")
+}
+
+// Service returns the name of the service of an NTP client under root.
+// Debian and its derivatives name the services of chrony and ntpd after
+// their packages.
+func (n NTP) Service(client, root string) (string, error) {
+	debian := false
+	if client == NTPClientChrony || client == NTPClientNTPd {
+		fullpath, err := SecureJoin(root, "/etc/debian_version")
+		if err != nil {
+			return "", err
+		}
+		_, err = os.Stat(fullpath)
+		debian = err == nil
+	}
+	switch {
+	case client == NTPClientChrony && debian:
+		return "chrony", nil
+	case client == NTPClientChrony:
+		return "chronyd", nil
+	case client == NTPClientNTPd && debian:
+		return "ntp", nil
+	case client == NTPClientNTPd, client == NTPClientBusybox:
+		return "ntpd", nil
+	default:
+		return client, nil
+	}
+}
+
+// ConfigFile returns the configuration of an NTP client under root
+// synchronizing the clock with the servers and pools.
+func (n NTP) ConfigFile(client, root string) (*File, error) {
+	servers, pools := n.Servers, n.Pools
+	if len(servers) == 0 && len(pools) == 0 {
+		pools = DefaultNTPPools
+	}
+
+	lines := []string{ntpHeader}
+	var filepath string
+	switch client {
+	case NTPClientChrony:
+		// Debian and Alpine keep the configuration in a directory.
+		filepath = "/etc/chrony.conf"
+		dir, err := SecureJoin(root, "/etc/chrony")
+		if err != nil {
+			return nil, err
+		}
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			filepath = "/etc/chrony/chrony.conf"
+		}
+		lines = append(lines, ntpServerLines(servers, pools)...)
+		lines = append(lines,
+			"driftfile /var/lib/chrony/chrony.drift",
+			"makestep 1.0 3",
+			"rtcsync")
+	case NTPClientNTPd:
+		filepath = "/etc/ntp.conf"
+		lines = append(lines, ntpServerLines(servers, pools)...)
+		lines = append(lines,
+			"driftfile /var/lib/ntp/ntp.drift",
+			"restrict -4 default kod notrap nomodify nopeer noquery limited",
+			"restrict -6 default kod notrap nomodify nopeer noquery limited",
+			"restrict 127.0.0.1",
+			"restrict ::1")
+	case NTPClientBusybox:
+		// The busybox ntpd makes no difference between servers and pools.
+		filepath = BusyboxNTPdConfigPath
+		opts := []string{"-N"}
+		for _, s := range append(append([]string{}, servers...), pools...) {
+			opts = append(opts, "-p", s)
+		}
+		lines = append(lines, fmt.Sprintf("NTPD_OPTS=%q", strings.Join(opts, " ")))
+	case NTPClientTimesyncd:
+		filepath = TimesyncdDropInPath
+		lines = append(lines,
+			"[Time]",
+			"NTP="+strings.Join(append(append([]string{}, servers...), pools...), " "))
+	default:
+		return nil, fmt.Errorf("unknown NTP client %q", client)
+	}
+
+	return &File{config.File{
+		Path:               filepath,
+		RawFilePermissions: "0644",
+		Content:            strings.Join(lines, "\n") + "\n",
+	}}, nil
+}
+
+func ntpServerLines(servers, pools []string) (lines []string) {
+	for _, s := range servers {
+		lines = append(lines, "server "+s+" iburst")
+	}
+	for _, p := range pools {
+		lines = append(lines, "pool "+p+" iburst")
+	}
+	return
+}
+
+// WriteNTPConfig writes the configuration of an NTP client under root. It
+// returns the path it wrote, or an empty path if the configuration was
+// already there.
+func WriteNTPConfig(n NTP, client, root string) (string, error) {
+	file, err := n.ConfigFile(client, root)
+	if err != nil {
+		return "", err
+	}
+	if changed, err := writeFileIfChanged(file, root); err != nil || !changed {
+		return "", err
+	}
+	return file.Path, nil
+}
@@ -0,0 +1,179 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/elotl/cloud-init/config"
+)
+
+func TestNTPClient(t *testing.T) {
+	for _, tt := range []struct {
+		chosen   string
+		binaries map[string]string
+		client   string
+	}{
+		{"ntpd", nil, NTPClientNTPd},
+		{"auto", map[string]string{"/usr/sbin/chronyd": "", "/usr/sbin/ntpd": ""}, NTPClientChrony},
+		{"", map[string]string{"/usr/sbin/ntpd": "", "/bin/busybox": ""}, NTPClientNTPd},
+		{"", map[string]string{"/usr/sbin/ntpd": "/bin/busybox", "/bin/busybox": ""}, NTPClientBusybox},
+		{"", map[string]string{"/lib/systemd/systemd-timesyncd": ""}, NTPClientTimesyncd},
+		{"", map[string]string{"/bin/busybox": ""}, NTPClientBusybox},
+		{"", nil, ""},
+	} {
+		dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+		if err != nil {
+			t.Fatalf("Unable to create tempdir: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		for p, target := range tt.binaries {
+			os.MkdirAll(path.Join(dir, path.Dir(p)), 0755)
+			if target != "" {
+				os.Symlink(target, path.Join(dir, p))
+			} else {
+				ioutil.WriteFile(path.Join(dir, p), nil, 0755)
+			}
+		}
+		client, err := NTP{config.NTP{NTPClient: tt.chosen}}.Client(dir)
+		if (err != nil) != (tt.client == "") {
+			t.Errorf("bad error (%q, %v): %v", tt.chosen, tt.binaries, err)
+		}
+		if client != tt.client {
+			t.Errorf("bad client (%q, %v): want %q, got %q", tt.chosen, tt.binaries, tt.client, client)
+		}
+	}
+}
+
+func TestNTPService(t *testing.T) {
+	for _, tt := range []struct {
+		client  string
+		debian  bool
+		service string
+	}{
+		{NTPClientChrony, false, "chronyd"},
+		{NTPClientChrony, true, "chrony"},
+		{NTPClientNTPd, false, "ntpd"},
+		{NTPClientNTPd, true, "ntp"},
+		{NTPClientBusybox, false, "ntpd"},
+		{NTPClientTimesyncd, true, "systemd-timesyncd"},
+	} {
+		dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+		if err != nil {
+			t.Fatalf("Unable to create tempdir: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		if tt.debian {
+			os.MkdirAll(path.Join(dir, "etc"), 0755)
+			ioutil.WriteFile(path.Join(dir, "etc", "debian_version"), []byte("12.0\n"), 0644)
+		}
+		service, err := NTP{}.Service(tt.client, dir)
+		if err != nil {
+			t.Errorf("bad error (%q, %t): %v", tt.client, tt.debian, err)
+		}
+		if service != tt.service {
+			t.Errorf("bad service (%q, %t): want %q, got %q", tt.client, tt.debian, tt.service, service)
+		}
+	}
+}
+
+func TestNTPConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ntp := NTP{config.NTP{Servers: []string{"ntp.example.com"}, Pools: []string{"pool.example.com"}}}
+	for _, tt := range []struct {
+		client   string
+		path     string
+		contents string
+	}{
+		{
+			NTPClientChrony,
+			"/etc/chrony.conf",
+			ntpHeader + `
+server ntp.example.com iburst
+pool pool.example.com iburst
+driftfile /var/lib/chrony/chrony.drift
+makestep 1.0 3
+rtcsync
+`,
+		},
+		{
+			NTPClientNTPd,
+			"/etc/ntp.conf",
+			ntpHeader + `
+server ntp.example.com iburst
+pool pool.example.com iburst
+driftfile /var/lib/ntp/ntp.drift
+restrict -4 default kod notrap nomodify nopeer noquery limited
+restrict -6 default kod notrap nomodify nopeer noquery limited
+restrict 127.0.0.1
+restrict ::1
+`,
+		},
+		{
+			NTPClientBusybox,
+			BusyboxNTPdConfigPath,
+			ntpHeader + `
+NTPD_OPTS="-N -p ntp.example.com -p pool.example.com"
+`,
+		},
+		{
+			NTPClientTimesyncd,
+			TimesyncdDropInPath,
+			ntpHeader + `
+[Time]
+NTP=ntp.example.com pool.example.com
+`,
+		},
+	} {
+		file, err := ntp.ConfigFile(tt.client, dir)
+		if err != nil {
+			t.Errorf("Unexpected error (%q): %v", tt.client, err)
+			continue
+		}
+		if file.Path != tt.path {
+			t.Errorf("bad path (%q): want %q, got %q", tt.client, tt.path, file.Path)
+		}
+		if file.Content != tt.contents {
+			t.Errorf("bad contents (%q): want %q, got %q", tt.client, tt.contents, file.Content)
+		}
+	}
+
+	// Debian keeps the configuration of chrony in a directory.
+	os.MkdirAll(path.Join(dir, "etc/chrony"), 0755)
+	if file, err := ntp.ConfigFile(NTPClientChrony, dir); err != nil || file.Path != "/etc/chrony/chrony.conf" {
+		t.Errorf("bad chrony configuration: want %q, got %+v, %v", "/etc/chrony/chrony.conf", file, err)
+	}
+
+	// The default pools are used without servers and pools.
+	file, err := NTP{}.ConfigFile(NTPClientTimesyncd, dir)
+	expected := ntpHeader + "\n[Time]\nNTP=0.pool.ntp.org 1.pool.ntp.org 2.pool.ntp.org 3.pool.ntp.org\n"
+	if err != nil || file.Content != expected {
+		t.Errorf("bad default configuration: want %q, got %+v, %v", expected, file, err)
+	}
+
+	if _, err := ntp.ConfigFile("openntpd", dir); err == nil {
+		t.Errorf("Expected an error for an unknown NTP client")
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/elotl/cloud-init/config"
+)
+
+const (
+	// PackageBatchSize is the number of packages installed at once.
+	PackageBatchSize = 20
+	// PackageRetries bounds the attempts of each package manager command,
+	// as mirrors and locks held by other package managers fail transiently.
+	PackageRetries = 3
+)
+
+// PackageRetryDelay is the delay before the first retry of a package
+// manager command, doubled before each further retry.
+var PackageRetryDelay = 5 * time.Second
+
+// PackageManager installs and upgrades the packages of the system with the
+// package manager of its distribution.
+type PackageManager interface {
+	// Name identifies the package manager in logs.
+	Name() string
+	// Update refreshes the index of the available packages.
+	Update() error
+	// Upgrade upgrades the installed packages.
+	Upgrade() error
+	// Install installs the packages, all or none of them.
+	Install(pkgs []config.Package) error
+	// RebootRequired reports whether upgraded packages need the system to
+	// reboot to take effect.
+	RebootRequired() (bool, error)
+}
+
+// PackageResult is the outcome of installing a package.
+type PackageResult struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// NewPackageManager returns the PackageManager of the system under root:
+// apk, apt, dnf or yum.
+func NewPackageManager(root string) (PackageManager, error) {
+	for _, pm := range []struct {
+		binary string
+		new    func(root string) PackageManager
+	}{
+		{"/sbin/apk", func(root string) PackageManager { return apkPackageManager{root} }},
+		{"/usr/bin/apt-get", func(root string) PackageManager { return aptPackageManager{root} }},
+		{"/usr/bin/dnf", func(root string) PackageManager { return yumPackageManager{root, "dnf"} }},
+		{"/usr/bin/yum", func(root string) PackageManager { return yumPackageManager{root, "yum"} }},
+	} {
+		fullpath, err := SecureJoin(root, pm.binary)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(fullpath); err == nil {
+			return pm.new(root), nil
+		}
+	}
+	return nil, errors.New("no supported package manager found")
+}
+
+// RetryPackageCommand runs fn until it succeeds, at most PackageRetries
+// times, backing off between attempts.
+func RetryPackageCommand(fn func() error) (err error) {
+	delay := PackageRetryDelay
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || attempt == PackageRetries {
+			return
+		}
+		log.Printf("Retrying in %s after failure: %v", delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// InstallPackages installs the packages with pm in batches of
+// PackageBatchSize, retrying each batch. The packages of a batch which
+// keeps failing are installed one by one so that the failure is reported
+// for the packages causing it.
+func InstallPackages(pm PackageManager, pkgs []config.Package) []PackageResult {
+	var results []PackageResult
+	for start := 0; start < len(pkgs); start += PackageBatchSize {
+		end := start + PackageBatchSize
+		if end > len(pkgs) {
+			end = len(pkgs)
+		}
+		batch := pkgs[start:end]
+
+		err := RetryPackageCommand(func() error { return pm.Install(batch) })
+		for _, p := range batch {
+			result := PackageResult{Name: p.Name, Version: p.Version}
+			if err != nil && len(batch) > 1 {
+				if perr := pm.Install([]config.Package{p}); perr != nil {
+					result.Error = perr.Error()
+				}
+			} else if err != nil {
+				result.Error = err.Error()
+			}
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// kernelReplaced determines if the modules of the running kernel are gone
+// from root, which happens once an upgrade replaced the kernel. Without any
+// modules under root, as in containers, there is no telling and it reports
+// false.
+func kernelReplaced(root string) (bool, error) {
+	var uts syscall.Utsname
+	if err := syscall.Uname(&uts); err != nil {
+		return false, err
+	}
+	var release []byte
+	for _, c := range uts.Release {
+		if c == 0 {
+			break
+		}
+		release = append(release, byte(c))
+	}
+	modules, err := SecureJoin(root, "/lib/modules")
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(modules); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(path.Join(modules, string(release)))
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	return false, err
+}
+
+// apkPackageManager manages the packages of Alpine Linux.
+type apkPackageManager struct {
+	root string
+}
+
+func (apkPackageManager) Name() string {
+	return "apk"
+}
+
+func (m apkPackageManager) Update() error {
+	return execCommandIn(m.root, "apk", "update", "--quiet")
+}
+
+func (m apkPackageManager) Upgrade() error {
+	return execCommandIn(m.root, "apk", "upgrade", "--quiet", "--no-progress")
+}
+
+func (m apkPackageManager) Install(pkgs []config.Package) error {
+	args := []string{"add", "--quiet", "--no-progress", "--"}
+	for _, p := range pkgs {
+		args = append(args, p.String())
+	}
+	return execCommandIn(m.root, "apk", args...)
+}
+
+func (m apkPackageManager) RebootRequired() (bool, error) {
+	return kernelReplaced(m.root)
+}
+
+// aptPackageManager manages the packages of Debian and its derivatives.
+type aptPackageManager struct {
+	root string
+}
+
+func (aptPackageManager) Name() string {
+	return "apt"
+}
+
+func (m aptPackageManager) aptGet(args ...string) error {
+	// Keep the configuration files which were changed locally instead of
+	// prompting about them.
+	args = append([]string{
+		"DEBIAN_FRONTEND=noninteractive", "apt-get", "--quiet", "--yes",
+		"--option", "Dpkg::Options::=--force-confdef",
+		"--option", "Dpkg::Options::=--force-confold",
+	}, args...)
+	return execCommandIn(m.root, "env", args...)
+}
+
+func (m aptPackageManager) Update() error {
+	return m.aptGet("update")
+}
+
+func (m aptPackageManager) Upgrade() error {
+	return m.aptGet("dist-upgrade")
+}
+
+func (m aptPackageManager) Install(pkgs []config.Package) error {
+	args := []string{"install", "--"}
+	for _, p := range pkgs {
+		args = append(args, p.String())
+	}
+	return m.aptGet(args...)
+}
+
+func (m aptPackageManager) RebootRequired() (bool, error) {
+	fullpath, err := SecureJoin(m.root, "/var/run/reboot-required")
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(fullpath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// yumPackageManager manages the packages of Fedora and RHEL with dnf, or
+// yum on older releases.
+type yumPackageManager struct {
+	root   string
+	binary string
+}
+
+func (m yumPackageManager) Name() string {
+	return m.binary
+}
+
+func (m yumPackageManager) Update() error {
+	return execCommandIn(m.root, m.binary, "--quiet", "--assumeyes", "makecache")
+}
+
+func (m yumPackageManager) Upgrade() error {
+	return execCommandIn(m.root, m.binary, "--quiet", "--assumeyes", "upgrade")
+}
+
+func (m yumPackageManager) Install(pkgs []config.Package) error {
+	args := []string{"--quiet", "--assumeyes", "install", "--"}
+	for _, p := range pkgs {
+		if p.Version != "" {
+			args = append(args, p.Name+"-"+p.Version)
+		} else {
+			args = append(args, p.Name)
+		}
+	}
+	return execCommandIn(m.root, m.binary, args...)
+}
+
+// RebootRequired asks needs-restarting, which exits with 1 when a reboot is
+// required, falling back to checking whether the kernel was replaced.
+func (m yumPackageManager) RebootRequired() (bool, error) {
+	if filepath.Clean(m.root) != "/" {
+		return kernelReplaced(m.root)
+	}
+	if _, err := exec.LookPath("needs-restarting"); err != nil {
+		return kernelReplaced(m.root)
+	}
+	err := exec.Command("needs-restarting", "--reboothint").Run()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		return true, nil
+	} else if err != nil {
+		return false, fmt.Errorf("needs-restarting failed: %v", err)
+	}
+	return false, nil
+}
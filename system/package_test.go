@@ -0,0 +1,171 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/elotl/cloud-init/config"
+)
+
+// testPackageManager fails to install the packages it is given the names
+// of, the first failures times for each batch.
+type testPackageManager struct {
+	broken   map[string]bool
+	failures int
+	installs [][]config.Package
+}
+
+func (*testPackageManager) Name() string                  { return "test" }
+func (*testPackageManager) Update() error                 { return nil }
+func (*testPackageManager) Upgrade() error                { return nil }
+func (*testPackageManager) RebootRequired() (bool, error) { return false, nil }
+
+func (m *testPackageManager) Install(pkgs []config.Package) error {
+	m.installs = append(m.installs, pkgs)
+	if m.failures > 0 {
+		m.failures--
+		return errors.New("temporary failure")
+	}
+	for _, p := range pkgs {
+		if m.broken[p.Name] {
+			return fmt.Errorf("%s not found", p.Name)
+		}
+	}
+	return nil
+}
+
+func TestNewPackageManager(t *testing.T) {
+	for _, tt := range []struct {
+		binaries []string
+		name     string
+	}{
+		{[]string{"/sbin/apk"}, "apk"},
+		{[]string{"/usr/bin/apt-get"}, "apt"},
+		{[]string{"/usr/bin/dnf", "/usr/bin/yum"}, "dnf"},
+		{[]string{"/usr/bin/yum"}, "yum"},
+		{nil, ""},
+	} {
+		dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+		if err != nil {
+			t.Fatalf("Unable to create tempdir: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		for _, b := range tt.binaries {
+			os.MkdirAll(path.Join(dir, path.Dir(b)), 0755)
+			ioutil.WriteFile(path.Join(dir, b), nil, 0755)
+		}
+		pm, err := NewPackageManager(dir)
+		if tt.name == "" {
+			if err == nil {
+				t.Errorf("Expected an error without a package manager (%v)", tt.binaries)
+			}
+			continue
+		}
+		if err != nil || pm.Name() != tt.name {
+			t.Errorf("bad package manager (%v): want %q, got %v, %v", tt.binaries, tt.name, pm, err)
+		}
+	}
+}
+
+func TestInstallPackages(t *testing.T) {
+	PackageRetryDelay = 0
+	defer func() { PackageRetryDelay = 5 * time.Second }()
+
+	var pkgs []config.Package
+	for i := 0; i < PackageBatchSize+2; i++ {
+		pkgs = append(pkgs, config.Package{Name: fmt.Sprintf("pkg%d", i)})
+	}
+	pkgs[1].Version = "1.0"
+
+	// A transient failure is retried.
+	pm := &testPackageManager{failures: PackageRetries - 1}
+	results := InstallPackages(pm, pkgs)
+	if len(pm.installs) != PackageRetries+1 {
+		t.Errorf("bad installs: want %d, got %d", PackageRetries+1, len(pm.installs))
+	}
+	for _, r := range results {
+		if r.Error != "" {
+			t.Errorf("Unexpected failure of %s: %s", r.Name, r.Error)
+		}
+	}
+
+	// A broken package fails its batch, whose packages are then installed
+	// one by one.
+	pm = &testPackageManager{broken: map[string]bool{"pkg1": true}}
+	results = InstallPackages(pm, pkgs)
+	if len(pm.installs) != PackageRetries+PackageBatchSize+1 {
+		t.Errorf("bad installs: want %d, got %d", PackageRetries+PackageBatchSize+1, len(pm.installs))
+	}
+	expected := []PackageResult{
+		{Name: "pkg0"},
+		{Name: "pkg1", Version: "1.0", Error: "pkg1 not found"},
+		{Name: "pkg2"},
+	}
+	if !reflect.DeepEqual(expected, results[:3]) || len(results) != len(pkgs) {
+		t.Errorf("bad results: want %v first, got %v", expected, results)
+	}
+	for _, r := range results[3:] {
+		if r.Error != "" {
+			t.Errorf("Unexpected failure of %s: %s", r.Name, r.Error)
+		}
+	}
+}
+
+func TestKernelReplaced(t *testing.T) {
+	var uts syscall.Utsname
+	if err := syscall.Uname(&uts); err != nil {
+		t.Fatalf("Unable to get the kernel release: %v", err)
+	}
+	var release []byte
+	for _, c := range uts.Release {
+		if c == 0 {
+			break
+		}
+		release = append(release, byte(c))
+	}
+
+	for _, tt := range []struct {
+		modules  []string
+		replaced bool
+	}{
+		{nil, false},
+		{[]string{"0.0.0-old"}, true},
+		{[]string{"0.0.0-old", string(release)}, false},
+	} {
+		dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+		if err != nil {
+			t.Fatalf("Unable to create tempdir: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		for _, m := range tt.modules {
+			os.MkdirAll(path.Join(dir, "lib", "modules", m), 0755)
+		}
+		replaced, err := kernelReplaced(dir)
+		if err != nil || replaced != tt.replaced {
+			t.Errorf("bad replacement (%v): want %t, got %t, %v", tt.modules, tt.replaced, replaced, err)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// UnknownUserError is returned when a user cannot be found in the passwd
+// database.
+type UnknownUserError string
+
+func (e UnknownUserError) Error() string {
+	return fmt.Sprintf("unknown user %q", string(e))
+}
+
+// UnknownGroupError is returned when a group cannot be found in the group
+// database.
+type UnknownGroupError string
+
+func (e UnknownGroupError) Error() string {
+	return fmt.Sprintf("unknown group %q", string(e))
+}
+
+// PasswdEntry is a single line of /etc/passwd.
+type PasswdEntry struct {
+	Name    string
+	Uid     int
+	Gid     int
+	GECOS   string
+	HomeDir string
+	Shell   string
+}
+
+// GroupEntry is a single line of /etc/group.
+type GroupEntry struct {
+	Name    string
+	Gid     int
+	Members []string
+}
+
+// Passwd reads the user and group databases of the system found under
+// root. Unlike os/user, it never consults the databases of the host when
+// root points somewhere else (e.g. an image being prepared).
+type Passwd struct {
+	root string
+}
+
+func NewPasswd(root string) *Passwd {
+	return &Passwd{root}
+}
+
+// Users returns every entry of <root>/etc/passwd.
+func (p *Passwd) Users() ([]PasswdEntry, error) {
+	var users []PasswdEntry
+	err := readColonFile(path.Join(p.root, "etc", "passwd"), 7, func(fields []string) error {
+		uid, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return fmt.Errorf("invalid uid %q for user %q", fields[2], fields[0])
+		}
+		gid, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return fmt.Errorf("invalid gid %q for user %q", fields[3], fields[0])
+		}
+		users = append(users, PasswdEntry{
+			Name:    fields[0],
+			Uid:     uid,
+			Gid:     gid,
+			GECOS:   fields[4],
+			HomeDir: fields[5],
+			Shell:   fields[6],
+		})
+		return nil
+	})
+	return users, err
+}
+
+// Groups returns every entry of <root>/etc/group.
+func (p *Passwd) Groups() ([]GroupEntry, error) {
+	var groups []GroupEntry
+	err := readColonFile(path.Join(p.root, "etc", "group"), 4, func(fields []string) error {
+		gid, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return fmt.Errorf("invalid gid %q for group %q", fields[2], fields[0])
+		}
+		var members []string
+		if fields[3] != "" {
+			members = strings.Split(fields[3], ",")
+		}
+		groups = append(groups, GroupEntry{
+			Name:    fields[0],
+			Gid:     gid,
+			Members: members,
+		})
+		return nil
+	})
+	return groups, err
+}
+
+// LookupUser finds a user by name.
+func (p *Passwd) LookupUser(name string) (*PasswdEntry, error) {
+	users, err := p.Users()
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		if u.Name == name {
+			return &u, nil
+		}
+	}
+	return nil, UnknownUserError(name)
+}
+
+// LookupUserId finds a user by uid.
+func (p *Passwd) LookupUserId(uid int) (*PasswdEntry, error) {
+	users, err := p.Users()
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		if u.Uid == uid {
+			return &u, nil
+		}
+	}
+	return nil, UnknownUserError(strconv.Itoa(uid))
+}
+
+// LookupGroup finds a group by name.
+func (p *Passwd) LookupGroup(name string) (*GroupEntry, error) {
+	groups, err := p.Groups()
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		if g.Name == name {
+			return &g, nil
+		}
+	}
+	return nil, UnknownGroupError(name)
+}
+
+// LookupGroupId finds a group by gid.
+func (p *Passwd) LookupGroupId(gid int) (*GroupEntry, error) {
+	groups, err := p.Groups()
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		if g.Gid == gid {
+			return &g, nil
+		}
+	}
+	return nil, UnknownGroupError(strconv.Itoa(gid))
+}
+
+// ResolveOwner converts an owner specification, as accepted by chown(1),
+// into a uid and gid suitable for os.Chown. The specification has the form
+// "user", "user:group", "user:" (the user's login group) or ":group", where
+// users and groups may be given by name or numeric id. Parts which are not
+// specified are returned as -1 so os.Chown leaves them untouched.
+func (p *Passwd) ResolveOwner(owner string) (uid, gid int, err error) {
+	uid, gid = -1, -1
+	userPart, groupPart := owner, ""
+	hasGroup := false
+	if i := strings.Index(owner, ":"); i != -1 {
+		userPart, groupPart = owner[:i], owner[i+1:]
+		hasGroup = true
+	}
+
+	if userPart != "" {
+		u, err := p.LookupUser(userPart)
+		if _, ok := err.(UnknownUserError); ok {
+			if id, nerr := strconv.Atoi(userPart); nerr == nil && id >= 0 {
+				uid = id
+			} else {
+				return -1, -1, err
+			}
+		} else if err != nil {
+			return -1, -1, err
+		} else {
+			uid = u.Uid
+			if hasGroup && groupPart == "" {
+				gid = u.Gid
+			}
+		}
+	}
+
+	if groupPart != "" {
+		g, err := p.LookupGroup(groupPart)
+		if _, ok := err.(UnknownGroupError); ok {
+			if id, nerr := strconv.Atoi(groupPart); nerr == nil && id >= 0 {
+				gid = id
+			} else {
+				return -1, -1, err
+			}
+		} else if err != nil {
+			return -1, -1, err
+		} else {
+			gid = g.Gid
+		}
+	}
+
+	return uid, gid, nil
+}
+
+// readColonFile calls fn with the fields of every entry in a colon separated
+// database such as /etc/passwd. Blank lines, comments and NIS compat entries
+// are skipped. A missing file is treated as an empty database.
+func readColonFile(filename string, nfields int, fn func([]string) error) error {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") ||
+			strings.HasPrefix(line, "+") || strings.HasPrefix(line, "-") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) < nfields {
+			return fmt.Errorf("%s:%d: expected %d fields, found %d", filename, lineno, nfields, len(fields))
+		}
+		if err := fn(fields); err != nil {
+			return fmt.Errorf("%s:%d: %v", filename, lineno, err)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,151 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/elotl/cloud-init/config"
+)
+
+const testPasswd = `root:x:0:0:root:/root:/bin/ash
+# a comment
+core:x:500:500:CoreOS Admin:/home/core:/bin/bash
+
++nisuser::::::
+`
+
+const testGroup = `root:x:0:root
+wheel:x:10:root,core
+core:x:500:
+docker:x:233:core
+`
+
+func makeTestRoot(t *testing.T) string {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	if err := os.MkdirAll(path.Join(dir, "etc"), 0755); err != nil {
+		t.Fatalf("Unable to create etc: %v", err)
+	}
+	if err := ioutil.WriteFile(path.Join(dir, "etc", "passwd"), []byte(testPasswd), 0644); err != nil {
+		t.Fatalf("Unable to write passwd: %v", err)
+	}
+	if err := ioutil.WriteFile(path.Join(dir, "etc", "group"), []byte(testGroup), 0644); err != nil {
+		t.Fatalf("Unable to write group: %v", err)
+	}
+	return dir
+}
+
+func TestPasswdLookup(t *testing.T) {
+	dir := makeTestRoot(t)
+	defer os.RemoveAll(dir)
+	p := NewPasswd(dir)
+
+	u, err := p.LookupUser("core")
+	if err != nil {
+		t.Fatalf("bad error: want nil, got %v", err)
+	}
+	want := &PasswdEntry{Name: "core", Uid: 500, Gid: 500, GECOS: "CoreOS Admin", HomeDir: "/home/core", Shell: "/bin/bash"}
+	if !reflect.DeepEqual(want, u) {
+		t.Errorf("bad user: want %#v, got %#v", want, u)
+	}
+
+	if _, err := p.LookupUser("nisuser"); err != UnknownUserError("nisuser") {
+		t.Errorf("bad error: want %v, got %v", UnknownUserError("nisuser"), err)
+	}
+
+	g, err := p.LookupGroupId(10)
+	if err != nil {
+		t.Fatalf("bad error: want nil, got %v", err)
+	}
+	wantGroup := &GroupEntry{Name: "wheel", Gid: 10, Members: []string{"root", "core"}}
+	if !reflect.DeepEqual(wantGroup, g) {
+		t.Errorf("bad group: want %#v, got %#v", wantGroup, g)
+	}
+
+	if _, err := p.LookupGroup("nogroup"); err != UnknownGroupError("nogroup") {
+		t.Errorf("bad error: want %v, got %v", UnknownGroupError("nogroup"), err)
+	}
+}
+
+func TestPasswdMissingDatabase(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := NewPasswd(dir).LookupUser("root"); err != UnknownUserError("root") {
+		t.Errorf("bad error: want %v, got %v", UnknownUserError("root"), err)
+	}
+}
+
+func TestResolveOwner(t *testing.T) {
+	dir := makeTestRoot(t)
+	defer os.RemoveAll(dir)
+	p := NewPasswd(dir)
+
+	for _, tt := range []struct {
+		owner string
+
+		uid int
+		gid int
+		err error
+	}{
+		{"core", 500, -1, nil},
+		{"core:", 500, 500, nil},
+		{"core:docker", 500, 233, nil},
+		{":wheel", -1, 10, nil},
+		{"1000:1000", 1000, 1000, nil},
+		{"root:1000", 0, 1000, nil},
+		{"nobody", -1, -1, UnknownUserError("nobody")},
+		{"core:nogroup", -1, -1, UnknownGroupError("nogroup")},
+		{"-1", -1, -1, UnknownUserError("-1")},
+	} {
+		uid, gid, err := p.ResolveOwner(tt.owner)
+		if !reflect.DeepEqual(tt.err, err) {
+			t.Errorf("bad error (%q): want %v, got %v", tt.owner, tt.err, err)
+		}
+		if uid != tt.uid || gid != tt.gid {
+			t.Errorf("bad ids (%q): want %d:%d, got %d:%d", tt.owner, tt.uid, tt.gid, uid, gid)
+		}
+	}
+}
+
+func TestWriteFileOwner(t *testing.T) {
+	dir := makeTestRoot(t)
+	defer os.RemoveAll(dir)
+
+	wf := File{config.File{
+		Path:    "foo",
+		Content: "bar",
+		Owner:   fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+	}}
+	if _, err := WriteFile(&wf, dir); err != nil {
+		t.Fatalf("Processing of WriteFile failed: %v", err)
+	}
+
+	wf.Owner = "nobody"
+	if _, err := WriteFile(&wf, dir); err == nil {
+		t.Fatalf("Expected error to be raised when writing file with unknown owner")
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// maxSymlinks bounds the number of symlinks followed by SecureJoin, the same
+// way the kernel bounds path resolution (see path_resolution(7)).
+const maxSymlinks = 40
+
+// ErrPathEscapes is returned when a path, or a symlink encountered while
+// resolving it, points outside of the root it is being resolved under.
+type ErrPathEscapes struct {
+	Root string
+	Path string
+}
+
+func (e ErrPathEscapes) Error() string {
+	return fmt.Sprintf("path %q escapes root %q", e.Path, e.Root)
+}
+
+// SecureJoin joins unsafePath onto root the way path.Join would, but resolves
+// every symlink along the way as if root were the root of the filesystem
+// (similar to a chroot). Absolute symlinks are therefore interpreted relative
+// to root, and any '..' component, either in unsafePath or in a symlink
+// target, which would leave root results in ErrPathEscapes. Components which
+// do not exist yet are joined as is.
+func SecureJoin(root, unsafePath string) (string, error) {
+	if root == "" {
+		root = "/"
+	}
+	root = path.Clean(root)
+
+	var resolved []string
+	remaining := strings.Split(unsafePath, "/")
+	links := 0
+	for len(remaining) > 0 {
+		part := remaining[0]
+		remaining = remaining[1:]
+
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if len(resolved) == 0 {
+				return "", ErrPathEscapes{root, unsafePath}
+			}
+			resolved = resolved[:len(resolved)-1]
+			continue
+		}
+
+		current := path.Join(root, path.Join(resolved...), part)
+		fi, err := os.Lstat(current)
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			resolved = append(resolved, part)
+			continue
+		}
+
+		links++
+		if links > maxSymlinks {
+			return "", fmt.Errorf("too many levels of symbolic links resolving %q under %q", unsafePath, root)
+		}
+		target, err := os.Readlink(current)
+		if err != nil {
+			return "", err
+		}
+		if path.IsAbs(target) {
+			resolved = nil
+		}
+		remaining = append(strings.Split(target, "/"), remaining...)
+	}
+
+	return path.Join(root, path.Join(resolved...)), nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/elotl/cloud-init/config"
+)
+
+func TestSecureJoin(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(path.Join(dir, "etc", "ssl"), 0755); err != nil {
+		t.Fatalf("Unable to create directories: %v", err)
+	}
+	for link, target := range map[string]string{
+		"abs":      "/etc",
+		"rel":      "etc/ssl",
+		"escape":   "../../etc",
+		"loop":     "loop",
+		"etc/up":   "..",
+		"etc/ssl2": "./ssl",
+	} {
+		if err := os.Symlink(target, path.Join(dir, link)); err != nil {
+			t.Fatalf("Unable to create symlink: %v", err)
+		}
+	}
+
+	for _, tt := range []struct {
+		path string
+
+		result string
+		err    bool
+	}{
+		{"/etc/hosts", path.Join(dir, "etc/hosts"), false},
+		{"etc/hosts", path.Join(dir, "etc/hosts"), false},
+		{"/missing/dir/file", path.Join(dir, "missing/dir/file"), false},
+		{"/etc/../etc/hosts", path.Join(dir, "etc/hosts"), false},
+		{"/abs/shadow", path.Join(dir, "etc/shadow"), false},
+		{"/rel/cert.pem", path.Join(dir, "etc/ssl/cert.pem"), false},
+		{"/etc/up/etc/hosts", path.Join(dir, "etc/hosts"), false},
+		{"/etc/ssl2/cert.pem", path.Join(dir, "etc/ssl/cert.pem"), false},
+		{"/", dir, false},
+		{"../../etc/shadow", "", true},
+		{"/etc/../../shadow", "", true},
+		{"/escape/shadow", "", true},
+		{"/loop/file", "", true},
+	} {
+		result, err := SecureJoin(dir, tt.path)
+		if tt.err != (err != nil) {
+			t.Errorf("bad error (%q): want error %t, got %v", tt.path, tt.err, err)
+		}
+		if result != tt.result {
+			t.Errorf("bad result (%q): want %q, got %q", tt.path, tt.result, result)
+		}
+	}
+}
+
+func TestWriteFileSymlinkEscape(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	outside, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(outside)
+
+	// An absolute symlink planted in the image is resolved inside the root
+	if err := os.Symlink(outside, path.Join(dir, "planted")); err != nil {
+		t.Fatalf("Unable to create symlink: %v", err)
+	}
+	wf := File{config.File{Path: "/planted/foo", Content: "bar"}}
+	fullPath, err := WriteFile(&wf, dir)
+	if err != nil {
+		t.Fatalf("Processing of WriteFile failed: %v", err)
+	}
+	if want := path.Join(dir, outside, "foo"); fullPath != want {
+		t.Errorf("WriteFile returned bad path: want %s, got %s", want, fullPath)
+	}
+	if _, err := os.Stat(path.Join(outside, "foo")); !os.IsNotExist(err) {
+		t.Errorf("WriteFile wrote outside of the root: %v", err)
+	}
+
+	wf = File{config.File{Path: "../foo", Content: "bar"}}
+	if _, err := WriteFile(&wf, dir); err == nil {
+		t.Fatalf("Expected error to be raised when writing file outside of the root")
+	}
+}
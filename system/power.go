@@ -0,0 +1,86 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// The modes of power_state.
+const (
+	PowerReboot   = "reboot"
+	PowerPoweroff = "poweroff"
+	PowerHalt     = "halt"
+)
+
+// PowerManager changes the power state of the running system.
+type PowerManager interface {
+	// Shutdown reboots, powers off or halts the system, as given by mode,
+	// once delay has passed. The message is broadcast to logged in users.
+	Shutdown(mode string, delay time.Duration, message string) error
+}
+
+// NewPowerManager returns a PowerManager using shutdown, or the reboot,
+// poweroff and halt applets of busybox on systems without it.
+func NewPowerManager() PowerManager {
+	if _, err := exec.LookPath("shutdown"); err == nil && !isBusybox("shutdown") {
+		return shutdownPowerManager{}
+	}
+	return busyboxPowerManager{}
+}
+
+var shutdownFlags = map[string]string{
+	PowerReboot:   "-r",
+	PowerPoweroff: "-P",
+	PowerHalt:     "-H",
+}
+
+type shutdownPowerManager struct{}
+
+func (shutdownPowerManager) Shutdown(mode string, delay time.Duration, message string) error {
+	flag, ok := shutdownFlags[mode]
+	if !ok {
+		return fmt.Errorf("invalid power state mode %q", mode)
+	}
+	when := "now"
+	if minutes := int((delay + time.Minute - 1) / time.Minute); minutes > 0 {
+		when = "+" + strconv.Itoa(minutes)
+	}
+	args := []string{flag, when}
+	if message != "" {
+		args = append(args, message)
+	}
+	return execCommand("shutdown", args...)
+}
+
+type busyboxPowerManager struct{}
+
+func (busyboxPowerManager) Shutdown(mode string, delay time.Duration, message string) error {
+	if _, ok := shutdownFlags[mode]; !ok {
+		return fmt.Errorf("invalid power state mode %q", mode)
+	}
+	if message != "" {
+		// Broadcasting the message is a courtesy, it does not stop the
+		// shutdown if it fails.
+		execCommand("wall", message)
+	}
+	// The applets wait for the delay to pass before they return, so they
+	// are left running in the background.
+	seconds := strconv.Itoa(int(delay / time.Second))
+	return exec.Command(mode, "-d", seconds).Start()
+}
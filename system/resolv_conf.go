@@ -0,0 +1,167 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/elotl/cloud-init/config"
+)
+
+const (
+	// ResolvConfPath is the path of the resolver configuration.
+	ResolvConfPath = "/etc/resolv.conf"
+	// ResolvconfHeadPath is the file resolvconf puts at the top of the
+	// resolver configuration it generates.
+	ResolvconfHeadPath = "/etc/resolvconf/resolv.conf.d/head"
+	// ResolvedDropInPath is the drop-in configuring systemd-resolved.
+	ResolvedDropInPath = "/etc/systemd/resolved.conf.d/90-cloud-init.conf"
+
+	resolvConfHeader = "# Generated by cloud-init from the resolv_conf of the cloud-config."
+)
+
+// The managers of /etc/resolv.conf ResolvConfManager detects.
+const (
+	ResolvConfUnmanaged  = ""
+	ResolvConfResolvconf = "resolvconf"
+	ResolvConfResolved   = "systemd-resolved"
+)
+
+type ResolvConf struct {
+	config.ResolvConf
+}
+
+// ResolvConfManager returns the program generating /etc/resolv.conf under
+// root, as told by where it links to, or ResolvConfUnmanaged if it is a
+// plain file.
+func ResolvConfManager(root string) (string, error) {
+	dir, err := SecureJoin(root, path.Dir(ResolvConfPath))
+	if err != nil {
+		return "", err
+	}
+	link := path.Join(dir, path.Base(ResolvConfPath))
+	info, err := os.Lstat(link)
+	if os.IsNotExist(err) {
+		return ResolvConfUnmanaged, nil
+	} else if err != nil {
+		return "", err
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return ResolvConfUnmanaged, nil
+	}
+	target, err := os.Readlink(link)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case strings.Contains(target, "systemd/resolve"):
+		return ResolvConfResolved, nil
+	case strings.Contains(target, "resolvconf"):
+		return ResolvConfResolvconf, nil
+	default:
+		return ResolvConfUnmanaged, nil
+	}
+}
+
+// Nameservers returns the nameservers the resolver uses.
+func (rc ResolvConf) Nameservers() []string {
+	if len(rc.ResolvConf.Nameservers) > config.MaxNameservers {
+		return rc.ResolvConf.Nameservers[:config.MaxNameservers]
+	}
+	return rc.ResolvConf.Nameservers
+}
+
+// String renders the resolver configuration in the format of resolv.conf.
+func (rc ResolvConf) String() string {
+	lines := []string{resolvConfHeader}
+	for _, ns := range rc.Nameservers() {
+		lines = append(lines, "nameserver "+ns)
+	}
+	if rc.Domain != "" {
+		lines = append(lines, "domain "+rc.Domain)
+	}
+	if len(rc.SearchDomains) > 0 {
+		lines = append(lines, "search "+strings.Join(rc.SearchDomains, " "))
+	}
+	if len(rc.Sortlist) > 0 {
+		lines = append(lines, "sortlist "+strings.Join(rc.Sortlist, " "))
+	}
+	var options []string
+	for opt, val := range rc.Options {
+		switch strings.ToLower(val) {
+		case "false", "no", "off":
+		case "true", "yes", "on":
+			options = append(options, opt)
+		default:
+			options = append(options, opt+":"+val)
+		}
+	}
+	if len(options) > 0 {
+		sort.Strings(options)
+		lines = append(lines, "options "+strings.Join(options, " "))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// ResolvedDropIn renders the nameservers and domains of the resolver
+// configuration as a systemd-resolved drop-in. systemd-resolved has no
+// equivalent of the options and sortlist, which are left out.
+func (rc ResolvConf) ResolvedDropIn() string {
+	lines := []string{resolvConfHeader, "[Resolve]"}
+	if len(rc.ResolvConf.Nameservers) > 0 {
+		lines = append(lines, "DNS="+strings.Join(rc.ResolvConf.Nameservers, " "))
+	}
+	domains := rc.SearchDomains
+	if rc.Domain != "" {
+		domains = append([]string{rc.Domain}, domains...)
+	}
+	if len(domains) > 0 {
+		lines = append(lines, "Domains="+strings.Join(domains, " "))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// WriteResolvConf writes the resolver configuration under root where the
+// manager of /etc/resolv.conf picks it up: a systemd-resolved drop-in, the
+// head of resolvconf, or /etc/resolv.conf itself. It returns the path it
+// wrote, or an empty path if the configuration was already there.
+func WriteResolvConf(rc ResolvConf, manager, root string) (string, error) {
+	var file File
+	switch manager {
+	case ResolvConfResolved:
+		file.Path, file.Content = ResolvedDropInPath, rc.ResolvedDropIn()
+	case ResolvConfResolvconf:
+		file.Path, file.Content = ResolvconfHeadPath, rc.String()
+	case ResolvConfUnmanaged:
+		file.Path, file.Content = ResolvConfPath, rc.String()
+	default:
+		return "", fmt.Errorf("unknown manager of %s: %q", ResolvConfPath, manager)
+	}
+	file.RawFilePermissions = "0644"
+
+	if changed, err := writeFileIfChanged(&file, root); err != nil || !changed {
+		return "", err
+	}
+	return file.Path, nil
+}
+
+// UpdateResolvconf has resolvconf regenerate /etc/resolv.conf.
+func UpdateResolvconf() error {
+	return execCommand("resolvconf", "-u")
+}
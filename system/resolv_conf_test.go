@@ -0,0 +1,147 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/elotl/cloud-init/config"
+)
+
+func TestResolvConfString(t *testing.T) {
+	for _, tt := range []struct {
+		config   config.ResolvConf
+		contents string
+	}{
+		{
+			config.ResolvConf{},
+			resolvConfHeader + "\n",
+		},
+		{
+			config.ResolvConf{
+				Nameservers:   []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"},
+				SearchDomains: []string{"example.com", "example.org"},
+				Domain:        "example.com",
+				Options:       map[string]string{"rotate": "true", "timeout": "1", "edns0": "false"},
+				Sortlist:      []string{"10.0.0.0/255.0.0.0"},
+			},
+			resolvConfHeader + `
+nameserver 10.0.0.1
+nameserver 10.0.0.2
+nameserver 10.0.0.3
+domain example.com
+search example.com example.org
+sortlist 10.0.0.0/255.0.0.0
+options rotate timeout:1
+`,
+		},
+	} {
+		if contents := (ResolvConf{tt.config}).String(); contents != tt.contents {
+			t.Errorf("bad resolv.conf (%+v): want %q, got %q", tt.config, tt.contents, contents)
+		}
+	}
+}
+
+func TestResolvConfResolvedDropIn(t *testing.T) {
+	rc := ResolvConf{config.ResolvConf{
+		Nameservers:   []string{"10.0.0.1", "2001:db8::1"},
+		SearchDomains: []string{"example.org"},
+		Domain:        "example.com",
+		Options:       map[string]string{"rotate": "true"},
+	}}
+	expected := resolvConfHeader + `
+[Resolve]
+DNS=10.0.0.1 2001:db8::1
+Domains=example.com example.org
+`
+	if dropIn := rc.ResolvedDropIn(); dropIn != expected {
+		t.Errorf("bad drop-in: want %q, got %q", expected, dropIn)
+	}
+}
+
+func TestResolvConfManager(t *testing.T) {
+	for _, tt := range []struct {
+		target  string
+		manager string
+	}{
+		{"", ResolvConfUnmanaged},
+		{"../run/systemd/resolve/stub-resolv.conf", ResolvConfResolved},
+		{"/run/resolvconf/resolv.conf", ResolvConfResolvconf},
+		{"/run/NetworkManager/resolv.conf", ResolvConfUnmanaged},
+	} {
+		dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+		if err != nil {
+			t.Fatalf("Unable to create tempdir: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		os.MkdirAll(path.Join(dir, "etc"), 0755)
+		if tt.target != "" {
+			if err := os.Symlink(tt.target, path.Join(dir, ResolvConfPath)); err != nil {
+				t.Fatalf("Unable to create symlink: %v", err)
+			}
+		}
+		manager, err := ResolvConfManager(dir)
+		if err != nil {
+			t.Errorf("Unexpected error (%q): %v", tt.target, err)
+		}
+		if manager != tt.manager {
+			t.Errorf("bad manager (%q): want %q, got %q", tt.target, tt.manager, manager)
+		}
+	}
+}
+
+func TestWriteResolvConf(t *testing.T) {
+	rc := ResolvConf{config.ResolvConf{Nameservers: []string{"10.0.0.1"}}}
+	for _, tt := range []struct {
+		manager  string
+		path     string
+		contents string
+	}{
+		{ResolvConfUnmanaged, ResolvConfPath, rc.String()},
+		{ResolvConfResolvconf, ResolvconfHeadPath, rc.String()},
+		{ResolvConfResolved, ResolvedDropInPath, rc.ResolvedDropIn()},
+	} {
+		dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+		if err != nil {
+			t.Fatalf("Unable to create tempdir: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		written, err := WriteResolvConf(rc, tt.manager, dir)
+		if err != nil || written != tt.path {
+			t.Errorf("bad write (%q): want %q, <nil>, got %q, %v", tt.manager, tt.path, written, err)
+		}
+		contents, err := ioutil.ReadFile(path.Join(dir, tt.path))
+		if err != nil {
+			t.Fatalf("Unable to read %s: %v", tt.path, err)
+		}
+		if string(contents) != tt.contents {
+			t.Errorf("bad contents (%q): want %q, got %q", tt.manager, tt.contents, contents)
+		}
+
+		// Writing the same configuration again changes nothing.
+		if written, err := WriteResolvConf(rc, tt.manager, dir); err != nil || written != "" {
+			t.Errorf("bad rewrite (%q): want \"\", <nil>, got %q, %v", tt.manager, written, err)
+		}
+	}
+
+	if _, err := WriteResolvConf(rc, "unknown", os.TempDir()); err == nil {
+		t.Errorf("Expected an error for an unknown manager")
+	}
+}
@@ -1,25 +1,121 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
 package system
 
 import (
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/elotl/cloud-init/config"
 )
 
-func RunScript(script string) error {
-	tempfile, err := ioutil.TempFile("", "cloud-init-script")
-	if err != nil {
-		return fmt.Errorf("could not create runcmd script: %v", err)
+// CommandResult records the outcome of running a single config.Command.
+type CommandResult struct {
+	Command    string `json:"command"`
+	ExitStatus int    `json:"exit_status"`
+	// Duration is the wall clock time the command ran for, in seconds.
+	Duration float64 `json:"duration"`
+	TimedOut bool    `json:"timed_out,omitempty"`
+}
+
+// RunCommand runs the given command and waits for it to exit, or kills it
+// (along with any process it started) once its timeout expires. Shell
+// commands are run with /bin/sh. The variables in env, in the form
+// "key=value", are added to the environment of the command before its own
+// environment. Both stdout and stderr are written to output as the command
+// runs. An error is returned if the command could not be started or did not
+// exit successfully.
+func RunCommand(cmd config.Command, env []string, output io.Writer) (CommandResult, error) {
+	result := CommandResult{Command: cmd.String(), ExitStatus: -1}
+
+	var c *exec.Cmd
+	switch {
+	case len(cmd.Args) > 0:
+		c = exec.Command(cmd.Args[0], cmd.Args[1:]...)
+	case cmd.Shell != "":
+		c = exec.Command("/bin/sh", "-c", cmd.Shell)
+	default:
+		return result, errors.New("empty command")
+	}
+
+	c.Env = append(os.Environ(), env...)
+	for _, k := range keys(cmd.Environment) {
+		c.Env = append(c.Env, fmt.Sprintf("%s=%s", k, cmd.Environment[k]))
+	}
+	c.Stdout = output
+	c.Stderr = output
+	// Run the command in its own process group so a timeout can kill
+	// everything it started, not just the direct child.
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	start := time.Now()
+	if err := c.Start(); err != nil {
+		return result, fmt.Errorf("could not start %q: %v", result.Command, err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- c.Wait() }()
+
+	var timeout <-chan time.Time
+	if cmd.Timeout > 0 {
+		timer := time.NewTimer(time.Duration(cmd.Timeout) * time.Second)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var err error
+	select {
+	case err = <-done:
+	case <-timeout:
+		syscall.Kill(-c.Process.Pid, syscall.SIGKILL)
+		err = <-done
+		result.TimedOut = true
+	}
+	result.Duration = time.Since(start).Seconds()
+	result.ExitStatus = c.ProcessState.ExitCode()
+
+	if result.TimedOut {
+		return result, fmt.Errorf("%q timed out after %ds", result.Command, cmd.Timeout)
+	} else if err != nil {
+		return result, fmt.Errorf("%q failed: %v", result.Command, err)
 	}
-	defer os.Remove(tempfile.Name())
-	tempfile.Write([]byte(script))
-	tempfile.Close()
-	output, err := exec.Command("/bin/sh", tempfile.Name()).CombinedOutput()
+	return result, nil
+}
+
+// execCommand runs a command of the system to completion, including its
+// output in the error returned when it fails.
+func execCommand(name string, args ...string) error {
+	output, err := exec.Command(name, args...).CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("error executing runcmd script: %v", err)
+		return fmt.Errorf("command '%s %s' failed: %v\n%s", name, strings.Join(args, " "), err, output)
 	}
-	log.Println("Successfully ran runcmd script, output was", string(output))
 	return nil
 }
+
+// execCommandIn runs a command like execCommand, within root if it is not
+// that of the running system.
+func execCommandIn(root, name string, args ...string) error {
+	if filepath.Clean(root) != "/" {
+		return execCommand("chroot", append([]string{root, name}, args...)...)
+	}
+	return execCommand(name, args...)
+}
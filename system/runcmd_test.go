@@ -0,0 +1,76 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/elotl/cloud-init/config"
+)
+
+func TestRunCommand(t *testing.T) {
+	for _, tt := range []struct {
+		cmd    config.Command
+		env    []string
+		output string
+		result CommandResult
+		fail   bool
+	}{
+		{
+			cmd:    config.Command{Shell: "echo $FOO $BAR", Environment: map[string]string{"BAR": "baz"}},
+			env:    []string{"FOO=foo", "BAR=bar"},
+			output: "foo baz\n",
+			result: CommandResult{Command: "echo $FOO $BAR", ExitStatus: 0},
+		},
+		{
+			cmd:    config.Command{Args: []string{"echo", "$FOO", "a b"}},
+			output: "$FOO a b\n",
+			result: CommandResult{Command: "echo $FOO a b", ExitStatus: 0},
+		},
+		{
+			cmd:    config.Command{Shell: "echo oops >&2; exit 3"},
+			output: "oops\n",
+			result: CommandResult{Command: "echo oops >&2; exit 3", ExitStatus: 3},
+			fail:   true,
+		},
+		{
+			cmd:    config.Command{Args: []string{"/nonexistent"}},
+			result: CommandResult{Command: "/nonexistent", ExitStatus: -1},
+			fail:   true,
+		},
+		{
+			cmd:    config.Command{Shell: "sleep 60 & wait", Timeout: 1},
+			result: CommandResult{Command: "sleep 60 & wait", ExitStatus: -1, TimedOut: true},
+			fail:   true,
+		},
+	} {
+		var output bytes.Buffer
+		result, err := RunCommand(tt.cmd, tt.env, &output)
+		if tt.fail != (err != nil) {
+			t.Errorf("bad error running %q: want failure %t, got %v", tt.result.Command, tt.fail, err)
+		}
+		if output.String() != tt.output {
+			t.Errorf("bad output running %q: want %q, got %q", tt.result.Command, tt.output, output.String())
+		}
+		if tt.result.TimedOut && result.Duration >= 60 {
+			t.Errorf("bad duration running %q: want less than 60s, got %f", tt.result.Command, result.Duration)
+		}
+		result.Duration = 0
+		if result != tt.result {
+			t.Errorf("bad result running %q: want %+v, got %+v", tt.result.Command, tt.result, result)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+
+	"github.com/elotl/cloud-init/config"
+)
+
+// ServiceManager controls the services of the running system, whichever
+// init system it uses.
+type ServiceManager interface {
+	// Name identifies the init system in logs.
+	Name() string
+	// Reload makes a running service reload its configuration. Services
+	// which are not running are left alone.
+	Reload(service string) error
+	// Restart restarts a service, starting it if it is not running.
+	Restart(service string) error
+}
+
+// ErrNoServiceManager is returned by NewServiceManager when the running
+// system was booted with neither systemd nor OpenRC.
+var ErrNoServiceManager = errors.New("no supported service manager found")
+
+// NewServiceManager returns the ServiceManager of the init system the
+// running system was booted with: systemd or OpenRC.
+func NewServiceManager() (ServiceManager, error) {
+	if _, err := os.Stat("/run/systemd/system"); err == nil {
+		return systemdServiceManager{NewUnitManager("")}, nil
+	}
+	if _, err := exec.LookPath("rc-service"); err == nil {
+		return openrcServiceManager{}, nil
+	}
+	return nil, ErrNoServiceManager
+}
+
+type systemdServiceManager struct {
+	units UnitManager
+}
+
+func (systemdServiceManager) Name() string {
+	return "systemd"
+}
+
+func (m systemdServiceManager) Reload(service string) error {
+	return m.run(service, "reload-or-try-restart")
+}
+
+func (m systemdServiceManager) Restart(service string) error {
+	return m.run(service, "restart")
+}
+
+func (m systemdServiceManager) run(service, command string) error {
+	unit := Unit{config.Unit{Name: service + ".service"}}
+	_, err := m.units.RunUnitCommand(unit, command)
+	return err
+}
+
+type openrcServiceManager struct{}
+
+func (openrcServiceManager) Name() string {
+	return "openrc"
+}
+
+func (openrcServiceManager) Reload(service string) error {
+	return execCommand("rc-service", "--ifstarted", service, "reload")
+}
+
+func (openrcServiceManager) Restart(service string) error {
+	return execCommand("rc-service", service, "restart")
+}
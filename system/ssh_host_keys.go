@@ -0,0 +1,258 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/elotl/cloud-init/config"
+)
+
+const (
+	sshHostKeyDir  = "/etc/ssh"
+	rsaHostKeyBits = 3072
+)
+
+// SSHHostKeyTypes are the types of host keys which can be generated, in the
+// order they are generated in.
+var SSHHostKeyTypes = []string{"rsa", "ecdsa", "ed25519"}
+
+// SSHHostKeyPath returns the path of the private host key of the given type.
+// The public key is found at the same path with ".pub" appended.
+func SSHHostKeyPath(keyType string) string {
+	return path.Join(sshHostKeyDir, fmt.Sprintf("ssh_host_%s_key", keyType))
+}
+
+// DeleteSSHHostKeys removes every host key, private or public, from
+// /etc/ssh under root.
+func DeleteSSHHostKeys(root string) error {
+	dir, err := SecureJoin(root, sshHostKeyDir)
+	if err != nil {
+		return err
+	}
+	matches, err := filepath.Glob(path.Join(dir, "ssh_host_*key*"))
+	if err != nil {
+		return err
+	}
+	for _, m := range matches {
+		if err := os.Remove(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteSSHHostKey installs a given private and public host key of the given
+// type. It reports whether either key changed.
+func WriteSSHHostKey(keyType, private, public, root string) (bool, error) {
+	if private == "" || public == "" {
+		return false, fmt.Errorf("both the private and public %s host keys must be given", keyType)
+	}
+	return writeSSHHostKey(keyType, []byte(private), []byte(public), root)
+}
+
+// GenerateSSHHostKey generates a host key of the given type, unless one
+// exists already. It reports whether a key was generated.
+func GenerateSSHHostKey(keyType, root string) (bool, error) {
+	fullpath, err := SecureJoin(root, SSHHostKeyPath(keyType))
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(fullpath); err == nil {
+		return false, nil
+	}
+
+	var pub, priv []byte
+	switch keyType {
+	case "rsa":
+		key, err := rsa.GenerateKey(rand.Reader, rsaHostKeyBits)
+		if err != nil {
+			return false, err
+		}
+		pub = sshWire("ssh-rsa", sshMpint(big.NewInt(int64(key.E))), sshMpint(key.N))
+		priv = sshWire("ssh-rsa", sshMpint(key.N), sshMpint(big.NewInt(int64(key.E))), sshMpint(key.D),
+			sshMpint(key.Precomputed.Qinv), sshMpint(key.Primes[0]), sshMpint(key.Primes[1]))
+	case "ecdsa":
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return false, err
+		}
+		point := elliptic.Marshal(key.Curve, key.X, key.Y)
+		pub = sshWire("ecdsa-sha2-nistp256", sshString([]byte("nistp256")), sshString(point))
+		priv = sshWire("ecdsa-sha2-nistp256", sshString([]byte("nistp256")), sshString(point), sshMpint(key.D))
+	case "ed25519":
+		pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return false, err
+		}
+		pub = sshWire("ssh-ed25519", sshString(pubKey))
+		priv = sshWire("ssh-ed25519", sshString(pubKey), sshString(privKey))
+	default:
+		return false, fmt.Errorf("unsupported host key type %q", keyType)
+	}
+
+	comment := fmt.Sprintf("root@%s", hostnameOrLocalhost())
+	private, err := marshalOpenSSHPrivateKey(pub, priv, comment)
+	if err != nil {
+		return false, err
+	}
+	public := fmt.Sprintf("%s %s %s\n", sshKeyType(pub), base64.StdEncoding.EncodeToString(pub), comment)
+	if _, err := writeSSHHostKey(keyType, private, []byte(public), root); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func writeSSHHostKey(keyType string, private, public []byte, root string) (bool, error) {
+	changed := false
+	for _, f := range []File{
+		{config.File{Path: SSHHostKeyPath(keyType), RawFilePermissions: "0600", Content: withNewline(private)}},
+		{config.File{Path: SSHHostKeyPath(keyType) + ".pub", RawFilePermissions: "0644", Content: withNewline(public)}},
+	} {
+		written, err := writeFileIfChanged(&f, root)
+		if err != nil {
+			return changed, err
+		}
+		changed = changed || written
+	}
+	return changed, nil
+}
+
+// SSHHostKeyFingerprints returns the SHA256 fingerprint, as printed by
+// ssh-keygen -l, of every public host key found under root by key type.
+func SSHHostKeyFingerprints(root string) (map[string]string, error) {
+	fingerprints := map[string]string{}
+	for _, keyType := range SSHHostKeyTypes {
+		fullpath, err := SecureJoin(root, SSHHostKeyPath(keyType)+".pub")
+		if err != nil {
+			return nil, err
+		}
+		contents, err := ioutil.ReadFile(fullpath)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		fields := strings.Fields(string(contents))
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("invalid public key in %s", SSHHostKeyPath(keyType)+".pub")
+		}
+		blob, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key in %s: %v", SSHHostKeyPath(keyType)+".pub", err)
+		}
+		fingerprints[keyType] = SSHFingerprint(blob)
+	}
+	return fingerprints, nil
+}
+
+// SSHFingerprint returns the SHA256 fingerprint of a public key in the SSH
+// wire format.
+func SSHFingerprint(blob []byte) string {
+	sum := sha256.Sum256(blob)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// marshalOpenSSHPrivateKey encodes a private key in the "openssh-key-v1"
+// format written by ssh-keygen, without encryption. pub is the public key
+// and priv the private key in the SSH wire format.
+func marshalOpenSSHPrivateKey(pub, priv []byte, comment string) ([]byte, error) {
+	check := make([]byte, 4)
+	if _, err := rand.Read(check); err != nil {
+		return nil, err
+	}
+	private := append(append(append([]byte{}, check...), check...), priv...)
+	private = append(private, sshString([]byte(comment))...)
+	for i := byte(1); len(private)%8 != 0; i++ {
+		private = append(private, i)
+	}
+
+	blob := []byte("openssh-key-v1\x00")
+	blob = append(blob, sshString([]byte("none"))...)
+	blob = append(blob, sshString([]byte("none"))...)
+	blob = append(blob, sshString(nil)...)
+	blob = append(blob, 0, 0, 0, 1)
+	blob = append(blob, sshString(pub)...)
+	blob = append(blob, sshString(private)...)
+	return pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: blob}), nil
+}
+
+// sshWire encodes a key of the given type followed by its already encoded
+// fields in the SSH wire format.
+func sshWire(keyType string, fields ...[]byte) []byte {
+	out := sshString([]byte(keyType))
+	for _, f := range fields {
+		out = append(out, f...)
+	}
+	return out
+}
+
+// sshKeyType returns the type a key in the SSH wire format starts with.
+func sshKeyType(blob []byte) string {
+	if len(blob) < 4 {
+		return ""
+	}
+	n := binary.BigEndian.Uint32(blob)
+	if uint32(len(blob)-4) < n {
+		return ""
+	}
+	return string(blob[4 : 4+n])
+}
+
+// sshString encodes b as an SSH string: its length followed by its bytes.
+func sshString(b []byte) []byte {
+	out := make([]byte, 4, 4+len(b))
+	binary.BigEndian.PutUint32(out, uint32(len(b)))
+	return append(out, b...)
+}
+
+// sshMpint encodes a non-negative integer as an SSH mpint.
+func sshMpint(n *big.Int) []byte {
+	b := n.Bytes()
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return sshString(b)
+}
+
+func withNewline(b []byte) string {
+	s := string(b)
+	if !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	return s
+}
+
+func hostnameOrLocalhost() string {
+	if h, err := Hostname(); err == nil && h != "" {
+		return h
+	}
+	return "localhost"
+}
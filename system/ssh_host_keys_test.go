@@ -0,0 +1,135 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestGenerateSSHHostKey(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, keyType := range SSHHostKeyTypes {
+		generated, err := GenerateSSHHostKey(keyType, dir)
+		if err != nil {
+			t.Fatalf("Unable to generate %s key: %v", keyType, err)
+		}
+		if !generated {
+			t.Errorf("bad generated (%s): want true, got false", keyType)
+		}
+
+		private := path.Join(dir, SSHHostKeyPath(keyType))
+		for p, mode := range map[string]os.FileMode{private: 0600, private + ".pub": 0644} {
+			fi, err := os.Stat(p)
+			if err != nil {
+				t.Fatalf("Unable to stat %s: %v", p, err)
+			}
+			if fi.Mode().Perm() != mode {
+				t.Errorf("bad permissions (%s): want %v, got %v", p, mode, fi.Mode().Perm())
+			}
+		}
+
+		if generated, err := GenerateSSHHostKey(keyType, dir); err != nil || generated {
+			t.Errorf("bad second generation (%s): want false, <nil>, got %v, %v", keyType, generated, err)
+		}
+	}
+
+	fingerprints, err := SSHHostKeyFingerprints(dir)
+	if err != nil {
+		t.Fatalf("Unable to read fingerprints: %v", err)
+	}
+	if len(fingerprints) != len(SSHHostKeyTypes) {
+		t.Errorf("bad fingerprints: want %d, got %v", len(SSHHostKeyTypes), fingerprints)
+	}
+
+	// Cross-check the keys with OpenSSH where it is available.
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not found")
+	}
+	for _, keyType := range SSHHostKeyTypes {
+		private := path.Join(dir, SSHHostKeyPath(keyType))
+		derived, err := exec.Command("ssh-keygen", "-y", "-f", private).Output()
+		if err != nil {
+			t.Fatalf("ssh-keygen could not read %s key: %v", keyType, err)
+		}
+		public, err := ioutil.ReadFile(private + ".pub")
+		if err != nil {
+			t.Fatalf("Unable to read %s public key: %v", keyType, err)
+		}
+		if d, p := strings.Fields(string(derived)), strings.Fields(string(public)); d[0] != p[0] || d[1] != p[1] {
+			t.Errorf("bad public key (%s): want %q, got %q", keyType, derived, public)
+		}
+
+		out, err := exec.Command("ssh-keygen", "-l", "-E", "sha256", "-f", private+".pub").Output()
+		if err != nil {
+			t.Fatalf("ssh-keygen could not fingerprint %s key: %v", keyType, err)
+		}
+		if fp := strings.Fields(string(out))[1]; fp != fingerprints[keyType] {
+			t.Errorf("bad fingerprint (%s): want %q, got %q", keyType, fp, fingerprints[keyType])
+		}
+	}
+}
+
+func TestWriteSSHHostKey(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := WriteSSHHostKey("ed25519", "private", "", dir); err == nil {
+		t.Errorf("bad error: want error for a missing public key, got <nil>")
+	}
+
+	// Writing the same key again changes nothing.
+	public := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIGbHAQ8Rs+LnoMbVf3yxxEqrm0Ae1xS6rJ5FQdpDyIj1 root@host"
+	for _, expected := range []bool{true, false} {
+		if changed, err := WriteSSHHostKey("ed25519", "private", public, dir); err != nil || changed != expected {
+			t.Fatalf("bad write: want %t, <nil>, got %t, %v", expected, changed, err)
+		}
+	}
+	contents, err := ioutil.ReadFile(path.Join(dir, SSHHostKeyPath("ed25519")+".pub"))
+	if err != nil {
+		t.Fatalf("Unable to read public key: %v", err)
+	}
+	if string(contents) != public+"\n" {
+		t.Errorf("bad public key: want %q, got %q", public+"\n", contents)
+	}
+	fingerprints, err := SSHHostKeyFingerprints(dir)
+	if err != nil {
+		t.Fatalf("Unable to read fingerprints: %v", err)
+	}
+	if fp := fingerprints["ed25519"]; !strings.HasPrefix(fp, "SHA256:") || len(fp) != 50 {
+		t.Errorf("bad fingerprint: got %q", fp)
+	}
+
+	if err := DeleteSSHHostKeys(dir); err != nil {
+		t.Fatalf("Unable to delete keys: %v", err)
+	}
+	for _, p := range []string{SSHHostKeyPath("ed25519"), SSHHostKeyPath("ed25519") + ".pub"} {
+		if _, err := os.Stat(path.Join(dir, p)); !os.IsNotExist(err) {
+			t.Errorf("bad deletion: %s still exists", p)
+		}
+	}
+}
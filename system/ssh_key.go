@@ -17,11 +17,12 @@ package system
 import (
 	"fmt"
 	"io/ioutil"
+	"log"
 	"os"
-	"os/user"
-	"path/filepath"
-	"strconv"
+	"path"
 	"strings"
+
+	"github.com/elotl/cloud-init/config"
 )
 
 var (
@@ -35,12 +36,19 @@ type SSHAuthorizer struct {
 	HomeDir string
 	Uid     int
 	Gid     int
-	//KeysName string
-	Keys []string
+	// KeysName names the block of authorized_keys managed by the
+	// authorizer, so that keys of several sources can be told apart.
+	KeysName string
+	Keys     []string
+	// Options, if set, replace the options of every key of the block.
+	Options string
 }
 
 func (ssh *SSHAuthorizer) SetupSSHDirectory() error {
-	sshdir := filepath.Join(ssh.HomeDir, ".ssh")
+	sshdir, err := SecureJoin(ssh.HomeDir, ".ssh")
+	if err != nil {
+		return err
+	}
 	perms := os.FileMode(0700)
 	if err := os.MkdirAll(sshdir, perms); err != nil {
 		return err
@@ -63,58 +71,189 @@ func GetAuthorizedKeysContents(sshfile string) (string, error) {
 	}
 	// add a trailing slash
 	contents = string(byteContents)
-	if contents[len(contents)-1] != '\n' {
+	if len(contents) > 0 && contents[len(contents)-1] != '\n' {
 		contents += "\n"
 	}
 	return contents, nil
 }
 
+// Authorize replaces the block of authorized_keys delimited by
+// "# BEGIN <KeysName>" and "# END <KeysName>" with the given keys, leaving
+// every line outside of it untouched. Keys which do not parse are skipped
+// and the others are deduplicated by their key material, including against
+// the keys outside of the block. Without any keys the block is removed.
+// The options of the keys are replaced by those of the authorizer, if any.
 func (ssh *SSHAuthorizer) Authorize(keys []string) error {
-	if err := ssh.SetupSSHDirectory(); err != nil {
-		return fmt.Errorf("Could not setup .ssh directory for uid %d: %v\n",
-			ssh.Uid, err)
-	}
+	keys = validSSHKeys(keys)
 
-	sshfile := filepath.Join(ssh.HomeDir, AuthorizedKeysPath)
+	sshfile, err := SecureJoin(ssh.HomeDir, AuthorizedKeysPath)
+	if err != nil {
+		return fmt.Errorf("Could not locate authorized_keys for uid %d: %v\n", ssh.Uid, err)
+	}
 	contents, err := GetAuthorizedKeysContents(sshfile)
 	if err != nil {
 		return fmt.Errorf("Could not get contents of authorized_keys for uid %d: %v\n", ssh.Uid, err)
 	}
+	if contents == "" && len(keys) == 0 {
+		return nil
+	}
 
-	joined := fmt.Sprintf("%s\n", strings.Join(keys, "\n"))
-	contents += joined
-	err = ioutil.WriteFile(sshfile, []byte(contents), 0600)
+	updated, err := replaceKeysBlock(contents, ssh.keysName(), keys, ssh.Options)
 	if err != nil {
+		return fmt.Errorf("Could not update authorized_keys for uid %d: %v", ssh.Uid, err)
+	}
+	if updated == contents {
+		return nil
+	}
+
+	if err := ssh.SetupSSHDirectory(); err != nil {
+		return fmt.Errorf("Could not setup .ssh directory for uid %d: %v\n",
+			ssh.Uid, err)
+	}
+	if err := ssh.writeAuthorizedKeys(sshfile, updated); err != nil {
 		return fmt.Errorf("Could not write authorized_keys for uid %d: %v\n", ssh.Uid, err)
 	}
-	if err := os.Chown(sshfile, ssh.Uid, ssh.Gid); err != nil {
+	return nil
+}
+
+func (ssh *SSHAuthorizer) keysName() string {
+	if ssh.KeysName == "" {
+		return "coreos-cloudinit"
+	}
+	return ssh.KeysName
+}
+
+// writeAuthorizedKeys replaces sshfile with the given contents atomically,
+// so that sshd never sees a partially written file.
+func (ssh *SSHAuthorizer) writeAuthorizedKeys(sshfile, contents string) error {
+	tmp, err := ioutil.TempFile(path.Dir(sshfile), "cloudinit-temp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(contents); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
+	}
+	if err := os.Chown(tmp.Name(), ssh.Uid, ssh.Gid); err != nil {
 		return fmt.Errorf("Error setting rightful owner and group of %s: %v",
 			sshfile, err)
 	}
-	return nil
+	return os.Rename(tmp.Name(), sshfile)
 }
 
-func AuthorizeSSHKeys(username string, keys []string) error {
-	u, err := user.Lookup(username)
+// replaceKeysBlock returns contents with the block of the given name holding
+// keys, in place of the existing block or appended if there is none. Keys
+// are given options in place of their own unless options is empty.
+func replaceKeysBlock(contents, name string, keys []string, options string) (string, error) {
+	begin, end := "# BEGIN "+name, "# END "+name
+	before, _, after, _, err := splitBlock(contents, begin, end)
 	if err != nil {
+		return "", err
+	}
 
-		fmt.Printf("Could not set authorized keys for %s: %v\n", username, err)
-		return err
+	seen := map[string]bool{}
+	for _, line := range append(append([]string{}, before...), after...) {
+		if m := keyMaterial(line); m != "" {
+			seen[m] = true
+		}
+	}
+	var block []string
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		m := keyMaterial(key)
+		if key == "" || (m != "" && seen[m]) {
+			continue
+		}
+		seen[m] = true
+		if options != "" {
+			key = withSSHKeyOptions(key, options)
+		}
+		block = append(block, key)
 	}
-	uid, err := strconv.Atoi(u.Uid)
+
+	out := before
+	if len(block) > 0 {
+		out = append(out, begin)
+		out = append(out, block...)
+		out = append(out, end)
+	}
+	out = append(out, after...)
+	if len(out) == 0 {
+		return "", nil
+	}
+	return strings.Join(out, "\n") + "\n", nil
+}
+
+// validSSHKeys returns the keys which parse, logging why the others are
+// skipped and warning about weak ones.
+func validSSHKeys(keys []string) []string {
+	valid := make([]string, 0, len(keys))
+	for i, k := range keys {
+		key, err := config.ParseSSHKey(k)
+		if err != nil {
+			log.Printf("Skipping invalid SSH key #%d: %v", i+1, err)
+			continue
+		}
+		if weakness := key.Weakness(); weakness != "" {
+			log.Printf("Warning: SSH key #%d (%s): %s", i+1, key.Comment, weakness)
+		}
+		valid = append(valid, k)
+	}
+	return valid
+}
+
+// keyMaterial returns the key type and base64 encoded key of an
+// authorized_keys line, without its options and comment. It is empty for
+// comments and lines without a valid key.
+func keyMaterial(line string) string {
+	key, err := config.ParseSSHKey(line)
 	if err != nil {
-		return fmt.Errorf("Invalid uid returned from user.Lookup(%s): %v", username, err)
+		return ""
 	}
-	gid, err := strconv.Atoi(u.Gid)
+	return key.Material()
+}
+
+// withSSHKeyOptions returns the authorized_keys line of key with options in
+// place of its own, or key as it is if it does not parse.
+func withSSHKeyOptions(key, options string) string {
+	k, err := config.ParseSSHKey(key)
+	if err != nil {
+		return key
+	}
+	k.Options = options
+	return k.String()
+}
+
+// newSSHAuthorizer returns the SSHAuthorizer of the user under root.
+func newSSHAuthorizer(username, root string) (*SSHAuthorizer, error) {
+	u, err := NewPasswd(root).LookupUser(username)
 	if err != nil {
-		return fmt.Errorf("Invalid uid returned from user.Lookup(%s): %v", username, err)
+		return nil, err
 	}
-	authorizer := SSHAuthorizer{
-		HomeDir: u.HomeDir,
-		Uid:     uid,
-		Gid:     gid,
-		//Keys:    keys,
+	homedir, err := SecureJoin(root, u.HomeDir)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid home directory for %s: %v", username, err)
+	}
+	return &SSHAuthorizer{HomeDir: homedir, Uid: u.Uid, Gid: u.Gid}, nil
+}
+
+// AuthorizeSSHKeys sets the keys of the given name authorized for the
+// user, with the given options if any, as done by SSHAuthorizer.Authorize.
+func AuthorizeSSHKeys(username, keysName string, keys []string, options, root string) error {
+	authorizer, err := newSSHAuthorizer(username, root)
+	if err != nil {
+		fmt.Printf("Could not set authorized keys for %s: %v\n", username, err)
+		return err
 	}
+	authorizer.KeysName = keysName
+	authorizer.Options = options
 	err = authorizer.Authorize(keys)
 	if err != nil {
 		return fmt.Errorf("Error setting up ssh authorized keys for %s: %v",
@@ -155,6 +294,39 @@ func AuthorizeSSHKeys(username string, keys []string) error {
 	//return f.Close()
 }
 
+// RestrictSSHKeys sets the options of every key authorized for the given
+// user to options (see the AUTHORIZED_KEYS FILE FORMAT section of sshd(8)),
+// replacing the options any of them had. Blocks of keys authorized with the
+// same options are left as they are.
+func RestrictSSHKeys(username, options, root string) error {
+	authorizer, err := newSSHAuthorizer(username, root)
+	if err != nil {
+		return err
+	}
+	sshfile, err := SecureJoin(authorizer.HomeDir, AuthorizedKeysPath)
+	if err != nil {
+		return fmt.Errorf("Could not locate authorized_keys for %s: %v", username, err)
+	}
+	contents, err := GetAuthorizedKeysContents(sshfile)
+	if err != nil || contents == "" {
+		return err
+	}
+
+	lines := strings.Split(strings.TrimSuffix(contents, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = withSSHKeyOptions(line, options)
+	}
+	restricted := strings.Join(lines, "\n") + "\n"
+	if restricted == contents {
+		return nil
+	}
+
+	if err := authorizer.writeAuthorizedKeys(sshfile, restricted); err != nil {
+		return fmt.Errorf("Could not write authorized_keys for %s: %v", username, err)
+	}
+	return nil
+}
+
 // // Add the provide SSH public key to the core user's list of
 // // authorized keys
 // func AuthorizeSSHKeys(user string, keysName string, keys []string) error {
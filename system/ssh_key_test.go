@@ -14,6 +14,13 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+const (
+	testKeyOne   = "AAAAC3NzaC1lZDI1NTE5AAAAIEwJtednfVsTnrUtfIm8GHF9H/9tGQy2dzK8XE4aHAQd"
+	testKeyTwo   = "AAAAC3NzaC1lZDI1NTE5AAAAIDd4XREursCW2ysvjBssGrAJZgZU0Ksuyk+UkPBsTp7X"
+	testKeyMine  = "AAAAE2VjZHNhLXNoYTItbmlzdHAyNTYAAAAIbmlzdHAyNTYAAABBBL6nrZWMe2FllPg8sYBHRweski7eGoEQEXaza6nYyywnnPOpuCFAWYprbJOEWDy9t+vV+iLlVyMMGCGKY6MzQ34="
+	testKeyOther = "AAAAC3NzaC1lZDI1NTE5AAAAILy5czxVV5W3L/XOAqJAQidyYLAVoajXn7OFufSQxRdh"
+)
+
 var randLetters = []rune("abcdefghijklmnopqrstuvwxyz")
 
 func randSeq(n int) string {
@@ -86,25 +93,8 @@ func TestSSHAuhorizer(t *testing.T) {
 	gid, err := strconv.Atoi(u.Gid)
 	assert.NoError(t, err)
 	keys := []string{
-		`ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQDULTftpWMj4nD+7Ps
-B8itam2T6Aqm9Z+ursQG1SRiK4ie5rHGJoteGnbH91Uix/HDE5GC3Hz
-ICQVOnQay4hwJUKRfEUEWj1Sncer/BL2igDquABlcXNl2dgOlfJ8a3q
-6IZnQpdEe6Vrqg/Ui082UxuZ08pNV94M/5IhR2fx0EbY66PQ97o+ywH
-sB7oXDO8p/+mGL+h7cxFY7hILXTa5/3TGBEgcA65Rrmq22eiRt97RGh
-DjfzIqTqb8gwuhTSNN7FWDLrEyRwJMbaTgDSoMIZdLtndVrGEqFHUO+
-WzinSiEQCs2MDDnTk29bleHAEktu1x68GYhg9S7O/gZq8/swAV
-core@valid1`,
-		`ssh-dss AAAAB3NzaC1kc3MAAACBAJA94Sqw80BSKjVTNZD6570nXIN
-hP8R2UhbBuydT+GI6CfA9Dw7O0udJQUfrqARFcRQR/syc72CO6jaKNE
-3/A5E+8uVmRZt7s9VtA47s1qxqHswth74m1Nb86n2OTB0HcW63FsXo2
-cJF+r+l6F3IcRPi4z/eaEKG7uhAS59TjH2tAAAAFQC0I9kL3oceMT1O
-44WPe6NZ8w8CMwAAAIABGm2Yg8nGFZbo/W8njuM79w0W2P1NBVNWzBH
-WQqVbr4i1bWTSSc9X+itQUpeF6zAUDsUoprhNise2NLrMYCLFo9JxhE
-iYAcEJ/YbKEnjtJzaAmQNpyh3rCWuOcGPTevjAZIkl+zEc+/N7tCW1e
-uDYm6IXZ8LEQyTUQUdU4pZ2OgAAAIABk1ZA3+TiCMaoAafNVUZ7zwqk
-888yVOgsJ7HGGDGRMo5ytr2SUJB7QWsLX6Un/Zbu32nXsAqtqagxd6F
-Ies98TSekMh/hAv9uK92mEsXSINXOeIMKRedqOyPgk5IEOsFpxAUO4T
-xpYToeuM8HRemecxw2eIFHnax+mQqCsi7FgQ== core@valid2`,
+		"ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQDULTftpWMj4nD+7PsB8itam2T6Aqm9Z+ursQG1SRiK4ie5rHGJoteGnbH91Uix/HDE5GC3HzICQVOnQay4hwJUKRfEUEWj1Sncer/BL2igDquABlcXNl2dgOlfJ8a3q6IZnQpdEe6Vrqg/Ui082UxuZ08pNV94M/5IhR2fx0EbY66PQ97o+ywHsB7oXDO8p/+mGL+h7cxFY7hILXTa5/3TGBEgcA65Rrmq22eiRt97RGhDjfzIqTqb8gwuhTSNN7FWDLrEyRwJMbaTgDSoMIZdLtndVrGEqFHUO+WzinSiEQCs2MDDnTk29bleHAEktu1x68GYhg9S7O/gZq8/swAV core@valid1",
+		"ssh-dss AAAAB3NzaC1kc3MAAACBAJA94Sqw80BSKjVTNZD6570nXINhP8R2UhbBuydT+GI6CfA9Dw7O0udJQUfrqARFcRQR/syc72CO6jaKNE3/A5E+8uVmRZt7s9VtA47s1qxqHswth74m1Nb86n2OTB0HcW63FsXo2cJF+r+l6F3IcRPi4z/eaEKG7uhAS59TjH2tAAAAFQC0I9kL3oceMT1O44WPe6NZ8w8CMwAAAIABGm2Yg8nGFZbo/W8njuM79w0W2P1NBVNWzBHWQqVbr4i1bWTSSc9X+itQUpeF6zAUDsUoprhNise2NLrMYCLFo9JxhEiYAcEJ/YbKEnjtJzaAmQNpyh3rCWuOcGPTevjAZIkl+zEc+/N7tCW1euDYm6IXZ8LEQyTUQUdU4pZ2OgAAAIABk1ZA3+TiCMaoAafNVUZ7zwqk888yVOgsJ7HGGDGRMo5ytr2SUJB7QWsLX6Un/Zbu32nXsAqtqagxd6FIes98TSekMh/hAv9uK92mEsXSINXOeIMKRedqOyPgk5IEOsFpxAUO4TxpYToeuM8HRemecxw2eIFHnax+mQqCsi7FgQ== core@valid2",
 	}
 	homedir := fmt.Sprintf("/tmp/%s", randSeq(10))
 	defer cleanupHomedir(t, homedir)
@@ -121,7 +111,99 @@ xpYToeuM8HRemecxw2eIFHnax+mQqCsi7FgQ== core@valid2`,
 	authFile := filepath.Join(sshdir, "authorized_keys")
 	assert.FileExists(t, authFile)
 	// assert has permissions
+	expected := "# BEGIN coreos-cloudinit\n" + strings.Join(keys, "\n") + "\n# END coreos-cloudinit\n"
 	contents, err := GetAuthorizedKeysContents(authFile)
 	assert.NoError(t, err)
-	assert.Equal(t, strings.Join(keys, "\n")+"\n", contents)
+	assert.Equal(t, expected, contents)
+
+	// Authorizing the same keys again does not duplicate them.
+	assert.NoError(t, authorizer.Authorize(keys))
+	contents, err = GetAuthorizedKeysContents(authFile)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, contents)
+}
+
+func TestReplaceKeysBlock(t *testing.T) {
+	for _, tt := range []struct {
+		contents string
+		keys     []string
+		expected string
+	}{
+		{
+			keys:     []string{"ssh-ed25519 " + testKeyOne + " one", " ssh-ed25519 " + testKeyOne + " duplicate\n", "ssh-ed25519 " + testKeyTwo + " two"},
+			expected: "# BEGIN test\nssh-ed25519 " + testKeyOne + " one\nssh-ed25519 " + testKeyTwo + " two\n# END test\n",
+		},
+		{
+			contents: "ecdsa-sha2-nistp256 " + testKeyMine + " mine\n# BEGIN test\nssh-ed25519 " + testKeyOne + " one\n# END test\n# BEGIN other\nssh-ed25519 " + testKeyOther + " other\n# END other\n",
+			keys:     []string{"ssh-ed25519 " + testKeyTwo + " two", `no-pty ecdsa-sha2-nistp256 ` + testKeyMine + ` "mine too"`},
+			expected: "ecdsa-sha2-nistp256 " + testKeyMine + " mine\n# BEGIN test\nssh-ed25519 " + testKeyTwo + " two\n# END test\n# BEGIN other\nssh-ed25519 " + testKeyOther + " other\n# END other\n",
+		},
+		{
+			contents: "ecdsa-sha2-nistp256 " + testKeyMine + " mine\n# BEGIN test\nssh-ed25519 " + testKeyOne + " one\n# END test\n",
+			expected: "ecdsa-sha2-nistp256 " + testKeyMine + " mine\n",
+		},
+		{
+			contents: "# BEGIN test\nssh-ed25519 " + testKeyOne + " one\n# END test\n",
+		},
+	} {
+		updated, err := replaceKeysBlock(tt.contents, "test", tt.keys, "")
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expected, updated, "contents: %q", tt.contents)
+	}
+
+	_, err := replaceKeysBlock("# BEGIN test\necdsa-sha2-nistp256 "+testKeyMine+" mine\n", "test", nil, "")
+	assert.Error(t, err)
+}
+
+func TestAuthorizeSSHKeys(t *testing.T) {
+	dir := makeTestRoot(t)
+	defer os.RemoveAll(dir)
+	sshdir := filepath.Join(dir, "root", ".ssh")
+	assert.NoError(t, os.MkdirAll(sshdir, 0700))
+	authFile := filepath.Join(sshdir, "authorized_keys")
+	assert.NoError(t, ioutil.WriteFile(authFile, []byte("ecdsa-sha2-nistp256 "+testKeyMine+" mine\n"), 0600))
+
+	assert.NoError(t, AuthorizeSSHKeys("root", "test", []string{"ssh-ed25519 " + testKeyOne + " one", "ssh-ed25519 " + testKeyTwo[:40] + " truncated", "ssh-ed25519 " + testKeyTwo + " two"}, "", dir))
+	contents, err := ioutil.ReadFile(authFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "ecdsa-sha2-nistp256 "+testKeyMine+" mine\n# BEGIN test\nssh-ed25519 "+testKeyOne+" one\nssh-ed25519 "+testKeyTwo+" two\n# END test\n", string(contents))
+
+	assert.NoError(t, AuthorizeSSHKeys("root", "test", []string{"ssh-ed25519 " + testKeyTwo + " two"}, "", dir))
+	contents, err = ioutil.ReadFile(authFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "ecdsa-sha2-nistp256 "+testKeyMine+" mine\n# BEGIN test\nssh-ed25519 "+testKeyTwo+" two\n# END test\n", string(contents))
+	fi, err := os.Stat(authFile)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	// Keys are authorized with the given options in place of their own.
+	assert.NoError(t, AuthorizeSSHKeys("root", "test", []string{"no-pty ssh-ed25519 " + testKeyTwo + " two"}, "restrict", dir))
+	contents, err = ioutil.ReadFile(authFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "ecdsa-sha2-nistp256 "+testKeyMine+" mine\n# BEGIN test\nrestrict ssh-ed25519 "+testKeyTwo+" two\n# END test\n", string(contents))
+}
+
+func TestRestrictSSHKeys(t *testing.T) {
+	dir := makeTestRoot(t)
+	defer os.RemoveAll(dir)
+	sshdir := filepath.Join(dir, "root", ".ssh")
+	assert.NoError(t, os.MkdirAll(sshdir, 0700))
+	authFile := filepath.Join(sshdir, "authorized_keys")
+	contents := "# keys\nssh-ed25519 " + testKeyOne + " core@one\nno-pty ecdsa-sha2-nistp256 " + testKeyMine + " core@two\n"
+	assert.NoError(t, ioutil.WriteFile(authFile, []byte(contents), 0600))
+
+	opts := `command="echo 'Please login as core';exit 142"`
+	assert.NoError(t, RestrictSSHKeys("root", opts, dir))
+	expected := "# keys\n" + opts + " ssh-ed25519 " + testKeyOne + " core@one\n" + opts + " ecdsa-sha2-nistp256 " + testKeyMine + " core@two\n"
+	restricted, err := ioutil.ReadFile(authFile)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, string(restricted))
+
+	// Restricting again leaves the keys as they are.
+	assert.NoError(t, RestrictSSHKeys("root", opts, dir))
+	restricted, err = ioutil.ReadFile(authFile)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, string(restricted))
+
+	assert.Error(t, RestrictSSHKeys("nobody", opts, dir))
 }
@@ -0,0 +1,124 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/elotl/cloud-init/config"
+)
+
+const SSHDConfigPath = "/etc/ssh/sshd_config"
+
+// UpdateSSHDConfig sets the given keywords of sshd_config(5) under root to
+// their values. Since sshd uses the first value it finds for a keyword, the
+// first occurrence of each keyword is replaced in place, and keywords which
+// are not set yet are added before any Match block, where they still apply
+// globally. Comments, other settings and Match blocks are left untouched.
+// It reports whether the file had to be changed.
+func UpdateSSHDConfig(settings map[string]string, root string) (bool, error) {
+	fullpath, err := SecureJoin(root, SSHDConfigPath)
+	if err != nil {
+		return false, err
+	}
+	file := File{config.File{
+		Path:               SSHDConfigPath,
+		RawFilePermissions: "0644",
+	}}
+
+	var lines []string
+	contents, err := ioutil.ReadFile(fullpath)
+	if err == nil {
+		if s := strings.TrimSuffix(string(contents), "\n"); s != "" {
+			lines = strings.Split(s, "\n")
+		}
+		if info, err := os.Stat(fullpath); err == nil {
+			file.RawFilePermissions = fmt.Sprintf("%#o", info.Mode().Perm())
+		}
+	} else if !os.IsNotExist(err) {
+		return false, err
+	}
+
+	// Keywords are case-insensitive.
+	pending := map[string]string{}
+	for key := range settings {
+		pending[strings.ToLower(key)] = key
+	}
+
+	firstMatch := -1
+	for i, line := range lines {
+		key := sshdKeyword(line)
+		if key == "" {
+			continue
+		}
+		if strings.EqualFold(key, "Match") {
+			firstMatch = i
+			break
+		}
+		if name, ok := pending[strings.ToLower(key)]; ok {
+			lines[i] = fmt.Sprintf("%s %s", key, settings[name])
+			delete(pending, strings.ToLower(key))
+		}
+	}
+
+	var added []string
+	for _, name := range pending {
+		added = append(added, fmt.Sprintf("%s %s", name, settings[name]))
+	}
+	sort.Strings(added)
+	if firstMatch == -1 {
+		lines = append(lines, added...)
+	} else if len(added) > 0 {
+		lines = append(lines[:firstMatch], append(added, lines[firstMatch:]...)...)
+	}
+
+	file.Content = strings.Join(lines, "\n") + "\n"
+	if file.Content == string(contents) {
+		return false, nil
+	}
+	if _, err := WriteFile(&file, root); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// sshdKeyword returns the keyword set by a line of sshd_config, which is
+// separated from its value by whitespace or '='. It is empty for blank lines
+// and comments.
+func sshdKeyword(line string) string {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ""
+	}
+	if i := strings.IndexAny(line, " \t="); i != -1 {
+		return line[:i]
+	}
+	return line
+}
+
+// SSHDInstalled determines if sshd is installed under root, going by the
+// presence of its configuration file.
+func SSHDInstalled(root string) bool {
+	fullpath, err := SecureJoin(root, SSHDConfigPath)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(fullpath)
+	return err == nil
+}
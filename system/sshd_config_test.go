@@ -0,0 +1,87 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestUpdateSSHDConfig(t *testing.T) {
+	for _, tt := range []struct {
+		contents string
+		settings map[string]string
+		expected string
+		changed  bool
+	}{
+		{
+			contents: "# comment\n#PasswordAuthentication yes\nPermitRootLogin yes\nUsePAM yes\n",
+			settings: map[string]string{"permitrootlogin": "no", "PasswordAuthentication": "no"},
+			expected: "# comment\n#PasswordAuthentication yes\nPermitRootLogin no\nUsePAM yes\nPasswordAuthentication no\n",
+			changed:  true,
+		},
+		{
+			contents: "PasswordAuthentication=yes\nMatch User core\n\tPasswordAuthentication yes\n",
+			settings: map[string]string{"PasswordAuthentication": "no", "X11Forwarding": "no"},
+			expected: "PasswordAuthentication no\nX11Forwarding no\nMatch User core\n\tPasswordAuthentication yes\n",
+			changed:  true,
+		},
+		{
+			contents: "PasswordAuthentication no\nPasswordAuthentication yes\n",
+			settings: map[string]string{"PasswordAuthentication": "no"},
+			expected: "PasswordAuthentication no\nPasswordAuthentication yes\n",
+		},
+		{
+			settings: map[string]string{"PermitRootLogin": "prohibit-password"},
+			expected: "PermitRootLogin prohibit-password\n",
+			changed:  true,
+		},
+	} {
+		func() {
+			dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+			if err != nil {
+				t.Fatalf("Unable to create tempdir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			fullPath := path.Join(dir, SSHDConfigPath)
+			if tt.contents != "" {
+				os.MkdirAll(path.Dir(fullPath), 0755)
+				if err := ioutil.WriteFile(fullPath, []byte(tt.contents), 0600); err != nil {
+					t.Fatalf("Unable to write sshd_config: %v", err)
+				}
+			}
+
+			changed, err := UpdateSSHDConfig(tt.settings, dir)
+			if err != nil {
+				t.Fatalf("Unable to update sshd_config: %v", err)
+			}
+			if changed != tt.changed {
+				t.Errorf("bad change for %q: want %t, got %t", tt.contents, tt.changed, changed)
+			}
+			contents, err := ioutil.ReadFile(fullPath)
+			if err != nil {
+				t.Fatalf("Unable to read sshd_config: %v", err)
+			}
+			if string(contents) != tt.expected {
+				t.Errorf("bad sshd_config for %q: want %q, got %q", tt.contents, tt.expected, contents)
+			}
+			if info, err := os.Stat(fullPath); tt.contents != "" && (err != nil || info.Mode().Perm() != 0600) {
+				t.Errorf("bad sshd_config permissions: want 0600, got %v (%v)", info.Mode(), err)
+			}
+		}()
+	}
+}
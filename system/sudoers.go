@@ -0,0 +1,174 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/elotl/cloud-init/config"
+)
+
+const SudoersPath = "/etc/sudoers.d/90-cloud-init-users"
+
+var (
+	sudoUserPattern    = regexp.MustCompile(`^[A-Za-z0-9_.%#+:-][A-Za-z0-9_.@$%#+:-]*$`)
+	sudoHostsPattern   = regexp.MustCompile(`^!?[A-Za-z0-9_.*:/-]+(\s*,\s*!?[A-Za-z0-9_.*:/-]+)*$`)
+	sudoRunasPattern   = regexp.MustCompile(`^\(\s*[^()]*\)`)
+	sudoTagPattern     = regexp.MustCompile(`^(NO)?(PASSWD|EXEC|SETENV|LOG_INPUT|LOG_OUTPUT|MAIL|FOLLOW|INTERCEPT):`)
+	sudoCommandPattern = regexp.MustCompile(`^!?\s*(ALL|[A-Z][A-Z0-9_]*|/\S*(\s.*)?|sudoedit(\s.*)?)$`)
+)
+
+// RenderSudoers renders the sudo rules of the given users as a sudoers
+// drop-in. The result is empty if no user has any rule.
+func RenderSudoers(users []config.User) string {
+	var b bytes.Buffer
+	for _, u := range users {
+		if u.Name == "" || len(u.Sudo) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n# User rules for %s\n", u.Name)
+		for _, rule := range u.Sudo {
+			fmt.Fprintf(&b, "%s %s\n", u.Name, rule)
+		}
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return "# Created by cloud-init, changes will be overwritten\n" + b.String()
+}
+
+// WriteSudoers checks the syntax of the given sudoers content, with visudo
+// if it is installed, and only then atomically replaces SudoersPath with it.
+func WriteSudoers(content, root string) error {
+	if err := CheckSudoers(content); err != nil {
+		return fmt.Errorf("refusing to write invalid %s: %v", SudoersPath, err)
+	}
+	file := File{config.File{
+		Path:               SudoersPath,
+		RawFilePermissions: "0440",
+		Content:            content,
+	}}
+	_, err := WriteFile(&file, root)
+	return err
+}
+
+// RemoveSudoers removes SudoersPath under root, which an earlier
+// configuration may have left granting sudo to users no longer given any.
+// It reports whether there was a file to remove.
+func RemoveSudoers(root string) (bool, error) {
+	fullpath, err := SecureJoin(root, SudoersPath)
+	if err != nil {
+		return false, err
+	}
+	if err := os.Remove(fullpath); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CheckSudoers checks the syntax of sudoers content with visudo, falling
+// back to a parser which understands user specifications when visudo is
+// not installed.
+func CheckSudoers(content string) error {
+	visudo, err := exec.LookPath("visudo")
+	if err != nil {
+		return parseSudoers(content)
+	}
+
+	tmp, err := ioutil.TempFile("", "cloudinit-sudoers")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if output, err := exec.Command(visudo, "-c", "-q", "-f", tmp.Name()).CombinedOutput(); err != nil {
+		return fmt.Errorf("visudo: %v\n%s", err, output)
+	}
+	return nil
+}
+
+// parseSudoers checks that every line of content is a comment or a user
+// specification of the form "user hosts = [(runas)] [TAG:]... commands".
+func parseSudoers(content string) error {
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := parseSudoersLine(line); err != nil {
+			return fmt.Errorf("line %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+func parseSudoersLine(line string) error {
+	if strings.HasSuffix(line, "\\") {
+		return fmt.Errorf("line continuations are not supported: %q", line)
+	}
+
+	fields := strings.Fields(line)
+	if !sudoUserPattern.MatchString(fields[0]) {
+		return fmt.Errorf("invalid user %q", fields[0])
+	}
+	spec := strings.TrimSpace(line[len(fields[0]):])
+
+	eq := strings.Index(spec, "=")
+	if eq == -1 {
+		return fmt.Errorf("missing '=' in %q", line)
+	}
+	if hosts := strings.TrimSpace(spec[:eq]); !sudoHostsPattern.MatchString(hosts) {
+		return fmt.Errorf("invalid host list %q", hosts)
+	}
+	spec = strings.TrimSpace(spec[eq+1:])
+
+	if runas := sudoRunasPattern.FindString(spec); runas != "" {
+		spec = strings.TrimSpace(spec[len(runas):])
+	} else if strings.HasPrefix(spec, "(") {
+		return fmt.Errorf("unbalanced parenthesis in %q", line)
+	}
+	for {
+		tag := sudoTagPattern.FindString(spec)
+		if tag == "" {
+			break
+		}
+		spec = strings.TrimSpace(spec[len(tag):])
+	}
+
+	if spec == "" {
+		return fmt.Errorf("missing command in %q", line)
+	}
+	for _, cmd := range strings.Split(spec, ",") {
+		if cmd = strings.TrimSpace(cmd); !sudoCommandPattern.MatchString(cmd) {
+			return fmt.Errorf("invalid command %q", cmd)
+		}
+	}
+	return nil
+}
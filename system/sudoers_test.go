@@ -0,0 +1,105 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/elotl/cloud-init/config"
+)
+
+func TestRenderSudoers(t *testing.T) {
+	users := []config.User{
+		{Name: "core", Sudo: config.SudoRules{"ALL=(ALL) NOPASSWD:ALL"}},
+		{Name: "nosudo"},
+		{Name: "ops", Sudo: config.SudoRules{"ALL=(root) /usr/bin/systemctl", "ALL=(ALL:ALL) NOPASSWD: NOEXEC: /usr/bin/journalctl, /bin/dmesg"}},
+	}
+	expected := `# Created by cloud-init, changes will be overwritten
+
+# User rules for core
+core ALL=(ALL) NOPASSWD:ALL
+
+# User rules for ops
+ops ALL=(root) /usr/bin/systemctl
+ops ALL=(ALL:ALL) NOPASSWD: NOEXEC: /usr/bin/journalctl, /bin/dmesg
+`
+	if content := RenderSudoers(users); content != expected {
+		t.Errorf("bad sudoers: want %q, got %q", expected, content)
+	}
+	if content := RenderSudoers([]config.User{{Name: "nosudo"}}); content != "" {
+		t.Errorf("bad sudoers without rules: want empty, got %q", content)
+	}
+}
+
+func TestParseSudoers(t *testing.T) {
+	for _, tt := range []struct {
+		line string
+		fail bool
+	}{
+		{line: "core ALL=(ALL) NOPASSWD:ALL"},
+		{line: "core ALL = ALL"},
+		{line: "%wheel ALL=(ALL:ALL) ALL"},
+		{line: "ops host1, host2=(root) NOPASSWD: /usr/bin/systemctl restart kip, !/bin/sh"},
+		{line: "core ALL=(ALL) NOPASSWD:ALL # trailing comment", fail: true},
+		{line: "core ALL(ALL) ALL", fail: true},
+		{line: "core ALL=(ALL NOPASSWD:ALL", fail: true},
+		{line: "core ALL=(ALL) NOPASSWD:", fail: true},
+		{line: "core ALL=(ALL) NOPASWD:ALL", fail: true},
+		{line: "core ALL=(ALL) bin/sh", fail: true},
+		{line: "core ALL=(ALL) \\", fail: true},
+	} {
+		if err := parseSudoers(tt.line); tt.fail != (err != nil) {
+			t.Errorf("bad error parsing %q: want failure %t, got %v", tt.line, tt.fail, err)
+		}
+	}
+}
+
+func TestWriteSudoers(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := "core ALL=(ALL) NOPASSWD:ALL\n"
+	if err := WriteSudoers(content, dir); err != nil {
+		t.Fatalf("Unable to write sudoers: %v", err)
+	}
+	fullPath := path.Join(dir, SudoersPath)
+	if info, err := os.Stat(fullPath); err != nil || info.Mode().Perm() != 0440 {
+		t.Fatalf("bad sudoers permissions: want 0440, got %v (%v)", info, err)
+	}
+
+	// An invalid rule must not replace the existing file.
+	if err := WriteSudoers("core ALL=(ALL NOPASSWD:ALL\n", dir); err == nil {
+		t.Fatalf("bad error writing invalid sudoers: want failure, got nil")
+	}
+	if written, err := ioutil.ReadFile(fullPath); err != nil || string(written) != content {
+		t.Errorf("bad sudoers after invalid write: want %q, got %q (%v)", content, written, err)
+	}
+
+	// Once no user has sudo rules, the file is removed.
+	for _, expected := range []bool{true, false} {
+		if removed, err := RemoveSudoers(dir); err != nil || removed != expected {
+			t.Errorf("bad removal: want %t, <nil>, got %t, %v", expected, removed, err)
+		}
+	}
+	if _, err := os.Stat(fullPath); !os.IsNotExist(err) {
+		t.Errorf("Unexpected sudoers after removal: %v", err)
+	}
+}
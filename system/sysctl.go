@@ -0,0 +1,77 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/elotl/cloud-init/config"
+)
+
+const (
+	// SysctlConfigPath is where the kernel parameters are kept for the
+	// following boots.
+	SysctlConfigPath = "/etc/sysctl.d/90-cloud-init.conf"
+	// ProcSysPath is where the kernel parameters of the running system are
+	// set.
+	ProcSysPath = "/proc/sys"
+
+	sysctlHeader = "# Generated by cloud-init from the sysctl of the cloud-config."
+)
+
+// SysctlFile returns the file setting the kernel parameters on boot, sorted
+// by key.
+func SysctlFile(params map[string]string) *File {
+	lines := []string{sysctlHeader}
+	for _, k := range sortedKeys(params) {
+		lines = append(lines, fmt.Sprintf("%s = %s", k, params[k]))
+	}
+	return &File{config.File{
+		Path:               SysctlConfigPath,
+		RawFilePermissions: "0644",
+		Content:            strings.Join(lines, "\n") + "\n",
+	}}
+}
+
+// WriteSysctlConfig writes the SysctlFile of the kernel parameters under
+// root, and reports whether it changed.
+func WriteSysctlConfig(params map[string]string, root string) (bool, error) {
+	return writeFileIfChanged(SysctlFile(params), root)
+}
+
+// SetSysctl sets the kernel parameter key to value through ProcSysPath
+// under root. Like sysctl(8), it fails for parameters the kernel does not
+// have.
+func SetSysctl(key, value, root string) error {
+	if err := config.AssertSysctlKeyValid(key); err != nil {
+		return err
+	}
+	fullpath, err := SecureJoin(root, path.Join(ProcSysPath, config.SysctlPath(key)))
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(fullpath, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(value + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
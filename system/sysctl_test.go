@@ -0,0 +1,87 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestWriteSysctlConfig(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	params := map[string]string{"net.ipv4.ip_forward": "1", "kernel.panic": "10"}
+	for i, changed := range []bool{true, false} {
+		if c, err := WriteSysctlConfig(params, dir); err != nil || c != changed {
+			t.Fatalf("bad write (%d): want %t, got %t, %v", i, changed, c, err)
+		}
+	}
+	contents, err := ioutil.ReadFile(path.Join(dir, SysctlConfigPath))
+	if err != nil {
+		t.Fatalf("Unable to read %s: %v", SysctlConfigPath, err)
+	}
+	expected := sysctlHeader + "\nkernel.panic = 10\nnet.ipv4.ip_forward = 1\n"
+	if string(contents) != expected {
+		t.Errorf("bad contents: want %q, got %q", expected, contents)
+	}
+}
+
+func TestSetSysctl(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, p := range []string{"net/ipv4/ip_forward", "net/ipv4/conf/eth0.100/forwarding"} {
+		fullpath := path.Join(dir, ProcSysPath, p)
+		os.MkdirAll(path.Dir(fullpath), 0755)
+		ioutil.WriteFile(fullpath, []byte("0\n"), 0644)
+	}
+
+	for _, tt := range []struct {
+		key  string
+		path string
+		err  bool
+	}{
+		{"net.ipv4.ip_forward", "net/ipv4/ip_forward", false},
+		{"net/ipv4/conf/eth0.100/forwarding", "net/ipv4/conf/eth0.100/forwarding", false},
+		// Parameters the kernel does not have are not created.
+		{"net.bridge.bridge-nf-call-iptables", "net/bridge/bridge-nf-call-iptables", true},
+		{"net/../../../etc/passwd", "", true},
+	} {
+		err := SetSysctl(tt.key, "1", dir)
+		if (err != nil) != tt.err {
+			t.Fatalf("bad error (%q): want %t, got %v", tt.key, tt.err, err)
+		}
+		if tt.path == "" {
+			continue
+		}
+		contents, err := ioutil.ReadFile(path.Join(dir, ProcSysPath, tt.path))
+		if tt.err {
+			if !os.IsNotExist(err) {
+				t.Errorf("Unexpected %s: %v", tt.path, err)
+			}
+		} else if string(contents) != "1\n" {
+			t.Errorf("bad value of %q: want %q, got %q", tt.key, "1\n", contents)
+		}
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"os/exec"
 	"path"
 	"strings"
+	"syscall"
 
 	"github.com/coreos/go-systemd/dbus"
 	"github.com/elotl/cloud-init/config"
@@ -43,12 +44,12 @@ const fakeMachineID = "42000000000000000000000000000042"
 // directories as necessary.
 func (s *systemd) PlaceUnit(u Unit) error {
 	file := File{config.File{
-		Path:               u.Destination(s.root),
+		Path:               u.Destination("/"),
 		Content:            u.Content,
 		RawFilePermissions: "0644",
 	}}
 
-	_, err := WriteFile(&file, "/")
+	_, err := WriteFile(&file, s.root)
 	return err
 }
 
@@ -56,12 +57,12 @@ func (s *systemd) PlaceUnit(u Unit) error {
 // creating parent directories as necessary.
 func (s *systemd) PlaceUnitDropIn(u Unit, d config.UnitDropIn) error {
 	file := File{config.File{
-		Path:               u.DropInDestination(s.root, d),
+		Path:               u.DropInDestination("/", d),
 		Content:            d.Content,
 		RawFilePermissions: "0644",
 	}}
 
-	_, err := WriteFile(&file, "/")
+	_, err := WriteFile(&file, s.root)
 	return err
 }
 
@@ -119,7 +120,10 @@ func (s *systemd) DaemonReload() error {
 // N.B.: Unlike `systemctl mask`, this function will *remove any existing unit
 // file at the location*, to ensure that the mask will succeed.
 func (s *systemd) MaskUnit(u Unit) error {
-	masked := u.Destination(s.root)
+	masked, err := s.maskDestination(u)
+	if err != nil {
+		return err
+	}
 	if _, err := os.Stat(masked); os.IsNotExist(err) {
 		if err := os.MkdirAll(path.Dir(masked), os.FileMode(0755)); err != nil {
 			return err
@@ -134,7 +138,10 @@ func (s *systemd) MaskUnit(u Unit) error {
 // associated with the given Unit is empty or appears to be a symlink to
 // /dev/null, it is removed.
 func (s *systemd) UnmaskUnit(u Unit) error {
-	masked := u.Destination(s.root)
+	masked, err := s.maskDestination(u)
+	if err != nil {
+		return err
+	}
 	ne, err := nullOrEmpty(masked)
 	if os.IsNotExist(err) {
 		return nil
@@ -148,6 +155,18 @@ func (s *systemd) UnmaskUnit(u Unit) error {
 	return os.Remove(masked)
 }
 
+// maskDestination returns the location of the given Unit's file under the
+// root. Only the parent directory is resolved, since the unit file itself may
+// be a mask symlink pointing at /dev/null.
+func (s *systemd) maskDestination(u Unit) (string, error) {
+	dest := u.Destination("/")
+	dir, err := SecureJoin(s.root, path.Dir(dest))
+	if err != nil {
+		return "", err
+	}
+	return path.Join(dir, path.Base(dest)), nil
+}
+
 // nullOrEmpty checks whether a given path appears to be an empty regular file
 // or a symlink to /dev/null
 func nullOrEmpty(path string) (bool, error) {
@@ -185,9 +204,35 @@ func ExecuteScript(scriptPath string) (string, error) {
 	return name, err
 }
 
-func SetHostname(hostname string) error {
+// SetHostname writes the host name to /etc/hostname under root so that it
+// persists across reboots. On the running system it is also set through
+// hostnamectl when systemd is running, or with sethostname(2).
+func SetHostname(hostname, root string) error {
+	if err := config.AssertHostnameValid(hostname); err != nil {
+		return err
+	}
 	fmt.Println("Setting hostname to", hostname)
-	return exec.Command("hostname", hostname).Run()
+	file := File{config.File{
+		Path:               "/etc/hostname",
+		RawFilePermissions: "0644",
+		Content:            hostname + "\n",
+	}}
+	if _, err := WriteFile(&file, root); err != nil {
+		return err
+	}
+	if path.Clean(root) != "/" {
+		return nil
+	}
+
+	if _, err := os.Stat("/run/systemd/system"); err == nil {
+		if _, err := exec.LookPath("hostnamectl"); err == nil {
+			if out, err := exec.Command("hostnamectl", "set-hostname", hostname).CombinedOutput(); err != nil {
+				return fmt.Errorf("hostnamectl failed: %v: %s", err, strings.TrimSpace(string(out)))
+			}
+			return nil
+		}
+	}
+	return syscall.Sethostname([]byte(hostname))
 }
 
 func Hostname() (string, error) {
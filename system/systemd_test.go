@@ -278,3 +278,26 @@ func TestNullOrEmpty(t *testing.T) {
 	}
 
 }
+
+func TestSetHostname(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := SetHostname("core.example.com", dir); err != nil {
+		t.Fatalf("Unexpected error while setting hostname: %v", err)
+	}
+	contents, err := ioutil.ReadFile(path.Join(dir, "etc", "hostname"))
+	if err != nil {
+		t.Fatalf("Unable to read /etc/hostname: %v", err)
+	}
+	if string(contents) != "core.example.com\n" {
+		t.Errorf("bad /etc/hostname: want %q, got %q", "core.example.com\n", contents)
+	}
+
+	if err := SetHostname("core_1", dir); err == nil {
+		t.Errorf("bad error: want an error for an invalid hostname, got <nil>")
+	}
+}
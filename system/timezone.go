@@ -0,0 +1,84 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/elotl/cloud-init/config"
+)
+
+const (
+	// ZoneinfoDir is the directory of the timezone database.
+	ZoneinfoDir = "/usr/share/zoneinfo"
+	// LocaltimePath links to the zone file of the timezone of the host.
+	LocaltimePath = "/etc/localtime"
+	// TimezonePath holds the name of the timezone of the host.
+	TimezonePath = "/etc/timezone"
+)
+
+// SetTimezone sets the timezone of the host under root, which has to be in
+// the timezone database under root: /etc/localtime is linked to its zone
+// file and its name is written to /etc/timezone. It reports whether either
+// changed.
+func SetTimezone(timezone, root string) (bool, error) {
+	for _, part := range strings.Split(timezone, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false, fmt.Errorf("invalid timezone %q", timezone)
+		}
+	}
+	target := path.Join(ZoneinfoDir, timezone)
+	zonefile, err := SecureJoin(root, target)
+	if err != nil {
+		return false, err
+	}
+	if info, err := os.Stat(zonefile); os.IsNotExist(err) || (err == nil && info.IsDir()) {
+		return false, fmt.Errorf("unknown timezone %q", timezone)
+	} else if err != nil {
+		return false, err
+	}
+
+	dir, err := SecureJoin(root, path.Dir(LocaltimePath))
+	if err != nil {
+		return false, err
+	}
+	if err := EnsureDirectoryExists(dir); err != nil {
+		return false, err
+	}
+	changed := false
+	localtime := path.Join(dir, path.Base(LocaltimePath))
+	if current, err := os.Readlink(localtime); err != nil || current != target {
+		tmp := localtime + ".cloudinit-temp"
+		os.Remove(tmp)
+		if err := os.Symlink(target, tmp); err != nil {
+			return false, err
+		}
+		if err := os.Rename(tmp, localtime); err != nil {
+			os.Remove(tmp)
+			return false, err
+		}
+		changed = true
+	}
+
+	written, err := writeFileIfChanged(&File{config.File{
+		Path:               TimezonePath,
+		RawFilePermissions: "0644",
+		Content:            timezone + "\n",
+	}}, root)
+	return changed || written, err
+}
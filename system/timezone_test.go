@@ -0,0 +1,64 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestSetTimezone(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(path.Join(dir, ZoneinfoDir, "America"), 0755)
+	ioutil.WriteFile(path.Join(dir, ZoneinfoDir, "UTC"), []byte("TZif"), 0644)
+	ioutil.WriteFile(path.Join(dir, ZoneinfoDir, "America/New_York"), []byte("TZif"), 0644)
+
+	for _, tt := range []struct {
+		timezone string
+		changed  bool
+		err      bool
+	}{
+		{"UTC", true, false},
+		{"UTC", false, false},
+		{"America/New_York", true, false},
+		{"America", false, true},
+		{"Europe/Paris", false, true},
+		{"../zoneinfo/UTC", false, true},
+	} {
+		changed, err := SetTimezone(tt.timezone, dir)
+		if (err != nil) != tt.err {
+			t.Errorf("bad error (%q): want error %t, got %v", tt.timezone, tt.err, err)
+		}
+		if changed != tt.changed {
+			t.Errorf("bad change (%q): want %t, got %t", tt.timezone, tt.changed, changed)
+		}
+	}
+
+	target, err := os.Readlink(path.Join(dir, LocaltimePath))
+	if err != nil || target != "/usr/share/zoneinfo/America/New_York" {
+		t.Errorf("bad /etc/localtime: want %q, <nil>, got %q, %v", "/usr/share/zoneinfo/America/New_York", target, err)
+	}
+	contents, err := ioutil.ReadFile(path.Join(dir, TimezonePath))
+	if err != nil || string(contents) != "America/New_York\n" {
+		t.Errorf("bad /etc/timezone: want %q, <nil>, got %q, %v", "America/New_York\n", contents, err)
+	}
+}
@@ -16,114 +16,86 @@ package system
 
 import (
 	"fmt"
-	"log"
 	"os/exec"
-	"os/user"
+	"path/filepath"
 	"strings"
 
 	"github.com/elotl/cloud-init/config"
 )
 
-func UserExists(u *config.User) bool {
-	_, err := user.Lookup(u.Name)
-	return err == nil
+// UserManager creates and modifies users and groups. Implementations must
+// honor every field of config.User and config.Group, or return an
+// UnsupportedFieldsError naming the fields they could not honor.
+type UserManager interface {
+	// Name identifies the backend in logs.
+	Name() string
+	CreateUser(u *config.User) error
+	CreateGroup(g *config.Group) error
+	AddUserToGroup(user, group string) error
+	SetUserPassword(user, hash string) error
+	// LockPassword disables password login for user, leaving its hash
+	// otherwise intact.
+	LockPassword(user string) error
+	// SetUserExpiry sets the date (YYYY-MM-DD) on which the account of
+	// user expires and the number of days after its password expires
+	// that the account is disabled. Empty values are left unchanged.
+	SetUserExpiry(user, expireDate, inactive string) error
+	// ExpirePassword forces user to change its password on next login.
+	ExpirePassword(user string) error
 }
 
-func CreateUser(u *config.User) error {
-	args := []string{}
-
-	if u.GECOS != "" {
-		args = append(args, "-g", fmt.Sprintf("%q", u.GECOS))
-	}
-
-	if u.Homedir != "" {
-		args = append(args, "-h", u.Homedir)
-	}
-
-	if u.NoCreateHome {
-		args = append(args, "-H")
-	}
-
-	if u.PrimaryGroup != "" {
-		args = append(args, "-G", u.PrimaryGroup)
-	}
+// UnsupportedFieldsError is returned by a UserManager which carried out an
+// operation but could not honor some of the fields it was given.
+type UnsupportedFieldsError struct {
+	Backend string
+	Name    string
+	Fields  []string
+}
 
-	if u.System {
-		args = append(args, "-S")
-	}
-	// if u.PasswordHash != "" {
-	// 	args = append(args, "--password", u.PasswordHash)
-	// } else {
-	// 	args = append(args, "--password", "*")
-	// }
-	// if u.NoUserGroup {
-	// 	args = append(args, "--no-user-group")
-	// }
-	// if u.NoLogInit {
-	// 	args = append(args, "--no-log-init")
-	// }
+func (e UnsupportedFieldsError) Error() string {
+	return fmt.Sprintf("%s backend does not support %s for %q", e.Backend, strings.Join(e.Fields, ", "), e.Name)
+}
 
-	if u.Shell != "" {
-		args = append(args, "-s", u.Shell)
+// NewUserManager returns the UserManager suited to the system found under
+// root. The user management commands only ever act on the running system,
+// so the databases are edited directly when root is anywhere else. Otherwise
+// shadow-utils' useradd is preferred over busybox's adduser, falling back to
+// editing the databases when neither is installed.
+func NewUserManager(root string) UserManager {
+	if filepath.Clean(root) != "/" {
+		return NewFileUserManager(root)
 	}
-
-	args = append(args, "-D")
-	args = append(args, u.Name)
-
-	fmt.Println("adduser", args)
-	output, err := exec.Command("adduser", args...).CombinedOutput()
-	if err != nil {
-		log.Printf("Command 'useradd %s' failed: %v\n%s", strings.Join(args, " "), err, output)
+	if _, err := exec.LookPath("useradd"); err == nil {
+		return NewShadowUserManager()
 	}
-	if len(u.Groups) > 0 {
-		fmt.Println("got groups: ", u.Groups)
-		for _, group := range u.Groups {
-			args := []string{u.Name, group}
-			output, err := exec.Command("adduser", args...).CombinedOutput()
-			if err != nil {
-				log.Printf("Command 'adduser %s' failed: %v\n%s", strings.Join(args, " "), err, output)
-			}
-		}
+	if isBusybox("adduser") {
+		return NewBusyboxUserManager()
 	}
-	if u.PasswordHash != "" {
-		err := SetUserPassword(u.Name, u.PasswordHash)
-		if err != nil {
-			log.Printf("Error setting password for %s: %v\n", u.Name, err)
-		}
-	}
-	return err
+	return NewFileUserManager(root)
 }
 
-func SetUserPassword(user, hash string) error {
-	cmd := exec.Command("/usr/sbin/chpasswd", "-e")
-
-	stdin, err := cmd.StdinPipe()
+// isBusybox determines if the named command is provided by busybox.
+func isBusybox(name string) bool {
+	p, err := exec.LookPath(name)
 	if err != nil {
-		return err
-	}
-
-	err = cmd.Start()
-	if err != nil {
-		fmt.Println("Error in start")
-		return err
+		return false
 	}
+	p, err = filepath.EvalSymlinks(p)
+	return err == nil && filepath.Base(p) == "busybox"
+}
 
-	arg := fmt.Sprintf("%s:%s", user, hash)
-	_, err = stdin.Write([]byte(arg))
-	if err != nil {
-		fmt.Println("Error writing to pipe")
-		return err
-	}
-	err = stdin.Close()
-	if err != nil {
-		fmt.Println("Error closing")
-	}
+func UserExists(u *config.User, root string) bool {
+	_, err := NewPasswd(root).LookupUser(u.Name)
+	return err == nil
+}
 
-	err = cmd.Wait()
-	if err != nil {
-		fmt.Println("Error writing to pipe")
-		return err
+// chpasswd sets the password hash of user with chpasswd(8), which both
+// busybox and shadow-utils provide.
+func chpasswd(user, hash string) error {
+	cmd := exec.Command("chpasswd", "-e")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("%s:%s\n", user, hash))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("command 'chpasswd -e' failed for %q: %v\n%s", user, err, output)
 	}
-
 	return nil
 }
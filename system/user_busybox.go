@@ -0,0 +1,130 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"strconv"
+
+	"github.com/elotl/cloud-init/config"
+	aggerr "github.com/elotl/cloud-init/util/errors"
+)
+
+// busyboxUserManager manages users with the adduser and addgroup applets
+// of busybox, as found on Alpine. busybox has no applet to change the expiry
+// of accounts and passwords, so /etc/shadow is edited for those instead.
+type busyboxUserManager struct {
+	shadow fileUserManager
+}
+
+func NewBusyboxUserManager() UserManager {
+	return busyboxUserManager{fileUserManager{"/"}}
+}
+
+func (busyboxUserManager) Name() string {
+	return "busybox"
+}
+
+func (m busyboxUserManager) CreateUser(u *config.User) error {
+	args := []string{"-D"}
+	var unsupported []string
+
+	if u.GECOS != "" {
+		args = append(args, "-g", u.GECOS)
+	}
+	if u.Homedir != "" {
+		args = append(args, "-h", u.Homedir)
+	}
+	if u.NoCreateHome {
+		args = append(args, "-H")
+	}
+	if u.PrimaryGroup != "" {
+		args = append(args, "-G", u.PrimaryGroup)
+	} else if u.NoUserGroup {
+		// adduser always creates a group named after the user unless
+		// it is given another one.
+		unsupported = append(unsupported, "no_user_group")
+	}
+	if u.System {
+		args = append(args, "-S")
+	}
+	if u.Shell != "" {
+		args = append(args, "-s", u.Shell)
+	}
+	if u.Uid != 0 {
+		args = append(args, "-u", strconv.Itoa(u.Uid))
+	}
+	// busybox never initializes lastlog and faillog, so NoLogInit needs no
+	// flag.
+	args = append(args, u.Name)
+
+	if err := execCommand("adduser", args...); err != nil {
+		return err
+	}
+
+	errs := []error{}
+	for _, group := range u.Groups {
+		if err := m.AddUserToGroup(u.Name, group); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if u.PasswordHash != "" {
+		if err := m.SetUserPassword(u.Name, u.PasswordHash); err != nil {
+			errs = append(errs, err)
+		} else if u.PasswordLocked() {
+			if err := m.LockPassword(u.Name); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if err := m.SetUserExpiry(u.Name, u.ExpireDate, u.Inactive); err != nil {
+		errs = append(errs, err)
+	}
+	if len(unsupported) > 0 {
+		errs = append(errs, UnsupportedFieldsError{m.Name(), u.Name, unsupported})
+	}
+	return aggerr.NewAggregate(errs)
+}
+
+func (busyboxUserManager) CreateGroup(g *config.Group) error {
+	args := []string{}
+	if g.Gid != 0 {
+		args = append(args, "-g", strconv.Itoa(g.Gid))
+	}
+	if g.System {
+		args = append(args, "-S")
+	}
+	args = append(args, g.Name)
+	return execCommand("addgroup", args...)
+}
+
+func (busyboxUserManager) AddUserToGroup(user, group string) error {
+	return execCommand("adduser", user, group)
+}
+
+func (busyboxUserManager) SetUserPassword(user, hash string) error {
+	return chpasswd(user, hash)
+}
+
+func (busyboxUserManager) LockPassword(user string) error {
+	return execCommand("passwd", "-l", user)
+}
+
+func (m busyboxUserManager) SetUserExpiry(user, expireDate, inactive string) error {
+	return m.shadow.SetUserExpiry(user, expireDate, inactive)
+}
+
+func (m busyboxUserManager) ExpirePassword(user string) error {
+	return m.shadow.ExpirePassword(user)
+}
@@ -0,0 +1,48 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestBusyboxUserManagerExpiry(t *testing.T) {
+	dir := makeTestRoot(t)
+	defer os.RemoveAll(dir)
+	shadow := path.Join(dir, "etc", "shadow")
+	if err := ioutil.WriteFile(shadow, []byte("root:*:16000:0:99999:7:::\ncore:!:16000:0:99999:7:::\n"), 0640); err != nil {
+		t.Fatalf("Unable to write shadow: %v", err)
+	}
+
+	m := busyboxUserManager{fileUserManager{dir}}
+	if err := m.SetUserExpiry("core", "2030-01-01", "30"); err != nil {
+		t.Fatalf("Unable to set expiry: %v", err)
+	}
+	if err := m.ExpirePassword("core"); err != nil {
+		t.Fatalf("Unable to expire password: %v", err)
+	}
+
+	contents, err := ioutil.ReadFile(shadow)
+	if err != nil {
+		t.Fatalf("Unable to read shadow: %v", err)
+	}
+	expected := "root:*:16000:0:99999:7:::\ncore:!:0:0:99999:7:30:21915:\n"
+	if string(contents) != expected {
+		t.Errorf("bad shadow: want %q, got %q", expected, contents)
+	}
+}
@@ -0,0 +1,403 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/elotl/cloud-init/config"
+	aggerr "github.com/elotl/cloud-init/util/errors"
+)
+
+const (
+	minSystemId = 100
+	maxSystemId = 999
+	minId       = 1000
+	maxId       = 59999
+)
+
+// fileUserManager manages users by editing /etc/passwd, /etc/shadow,
+// /etc/group and /etc/gshadow under its root directly. It needs no tools
+// installed and can prepare a root other than that of the running system.
+type fileUserManager struct {
+	root string
+}
+
+func NewFileUserManager(root string) UserManager {
+	return fileUserManager{root}
+}
+
+func (fileUserManager) Name() string {
+	return "file"
+}
+
+func (m fileUserManager) CreateUser(u *config.User) error {
+	passwd := NewPasswd(m.root)
+	if _, err := passwd.LookupUser(u.Name); err == nil {
+		return fmt.Errorf("user %q already exists", u.Name)
+	}
+
+	users, err := passwd.Users()
+	if err != nil {
+		return err
+	}
+	uids := map[int]bool{}
+	for _, e := range users {
+		uids[e.Uid] = true
+	}
+	uid := u.Uid
+	if uid == 0 {
+		if uid, err = nextFreeId(uids, u.System); err != nil {
+			return fmt.Errorf("unable to allocate uid for %q: %v", u.Name, err)
+		}
+	} else if uids[uid] {
+		return fmt.Errorf("uid %d of user %q is already in use", uid, u.Name)
+	}
+
+	gid, err := m.primaryGid(u, uid)
+	if err != nil {
+		return err
+	}
+
+	home := u.Homedir
+	if home == "" {
+		home = path.Join("/home", u.Name)
+	}
+	shell := u.Shell
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	hash := u.PasswordHash
+	if hash == "" {
+		hash = "!"
+	} else if u.PasswordLocked() {
+		hash = lockedHash(hash)
+	}
+	expire, err := expiryDays(u.ExpireDate)
+	if err != nil {
+		return err
+	}
+
+	hasShadow := m.exists("shadow")
+	pwField := "x"
+	if !hasShadow {
+		pwField = hash
+	}
+	entry := strings.Join([]string{u.Name, pwField, strconv.Itoa(uid), strconv.Itoa(gid), u.GECOS, home, shell}, ":")
+	if err := m.appendEntry("passwd", entry); err != nil {
+		return err
+	}
+	if hasShadow {
+		entry := strings.Join([]string{u.Name, hash, lastChange(), "0", "99999", "7", u.Inactive, expire, ""}, ":")
+		if err := m.appendEntry("shadow", entry); err != nil {
+			return err
+		}
+	}
+
+	// NoLogInit needs no handling since lastlog and faillog are never
+	// initialized here.
+	errs := []error{}
+	if !u.NoCreateHome && !u.System {
+		if err := m.createHome(home, uid, gid); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, group := range u.Groups {
+		if err := m.AddUserToGroup(u.Name, group); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return aggerr.NewAggregate(errs)
+}
+
+// primaryGid returns the gid of the login group of the new user u, creating
+// a group named after the user unless told otherwise.
+func (m fileUserManager) primaryGid(u *config.User, uid int) (int, error) {
+	passwd := NewPasswd(m.root)
+	if u.PrimaryGroup != "" {
+		if g, err := passwd.LookupGroup(u.PrimaryGroup); err == nil {
+			return g.Gid, nil
+		}
+		if gid, err := strconv.Atoi(u.PrimaryGroup); err == nil && gid >= 0 {
+			return gid, nil
+		}
+		return -1, UnknownGroupError(u.PrimaryGroup)
+	}
+	if u.NoUserGroup {
+		if g, err := passwd.LookupGroup("users"); err == nil {
+			return g.Gid, nil
+		}
+		return 100, nil
+	}
+
+	// Give the user group the same id as the user when it is free.
+	group := config.Group{Name: u.Name, System: u.System}
+	if _, err := passwd.LookupGroupId(uid); err != nil {
+		group.Gid = uid
+	}
+	if err := m.CreateGroup(&group); err != nil {
+		return -1, err
+	}
+	g, err := passwd.LookupGroup(u.Name)
+	if err != nil {
+		return -1, err
+	}
+	return g.Gid, nil
+}
+
+func (m fileUserManager) createHome(home string, uid, gid int) error {
+	dir, err := SecureJoin(m.root, home)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return os.Chown(dir, uid, gid)
+}
+
+func (m fileUserManager) CreateGroup(g *config.Group) error {
+	passwd := NewPasswd(m.root)
+	if _, err := passwd.LookupGroup(g.Name); err == nil {
+		return fmt.Errorf("group %q already exists", g.Name)
+	}
+
+	groups, err := passwd.Groups()
+	if err != nil {
+		return err
+	}
+	gids := map[int]bool{}
+	for _, e := range groups {
+		gids[e.Gid] = true
+	}
+	gid := g.Gid
+	if gid == 0 {
+		if gid, err = nextFreeId(gids, g.System); err != nil {
+			return fmt.Errorf("unable to allocate gid for %q: %v", g.Name, err)
+		}
+	} else if gids[gid] {
+		return fmt.Errorf("gid %d of group %q is already in use", gid, g.Name)
+	}
+
+	if err := m.appendEntry("group", fmt.Sprintf("%s:x:%d:", g.Name, gid)); err != nil {
+		return err
+	}
+	if m.exists("gshadow") {
+		return m.appendEntry("gshadow", fmt.Sprintf("%s:!::", g.Name))
+	}
+	return nil
+}
+
+func (m fileUserManager) AddUserToGroup(user, group string) error {
+	if _, err := NewPasswd(m.root).LookupGroup(group); err != nil {
+		return err
+	}
+	addMember := func(idx int) func([]string) {
+		return func(fields []string) {
+			var members []string
+			if fields[idx] != "" {
+				members = strings.Split(fields[idx], ",")
+			}
+			if !contains(members, user) {
+				fields[idx] = strings.Join(append(members, user), ",")
+			}
+		}
+	}
+	if err := m.updateEntry("group", group, 4, addMember(3)); err != nil {
+		return err
+	}
+	if m.exists("gshadow") {
+		return m.updateEntry("gshadow", group, 4, addMember(3))
+	}
+	return nil
+}
+
+func (m fileUserManager) SetUserPassword(user, hash string) error {
+	if m.exists("shadow") {
+		return m.updateEntry("shadow", user, 9, func(fields []string) {
+			fields[1] = hash
+			fields[2] = lastChange()
+		})
+	}
+	return m.updateEntry("passwd", user, 7, func(fields []string) {
+		fields[1] = hash
+	})
+}
+
+func (m fileUserManager) LockPassword(user string) error {
+	if m.exists("shadow") {
+		return m.updateEntry("shadow", user, 9, func(fields []string) {
+			fields[1] = lockedHash(fields[1])
+		})
+	}
+	return m.updateEntry("passwd", user, 7, func(fields []string) {
+		fields[1] = lockedHash(fields[1])
+	})
+}
+
+func (m fileUserManager) SetUserExpiry(user, expireDate, inactive string) error {
+	if expireDate == "" && inactive == "" {
+		return nil
+	}
+	expire, err := expiryDays(expireDate)
+	if err != nil {
+		return err
+	}
+	if !m.exists("shadow") {
+		return fmt.Errorf("unable to set expiry of %q without /etc/shadow", user)
+	}
+	return m.updateEntry("shadow", user, 9, func(fields []string) {
+		if inactive != "" {
+			fields[6] = inactive
+		}
+		if expire != "" {
+			fields[7] = expire
+		}
+	})
+}
+
+// ExpirePassword sets the date of the last password change of user to the
+// epoch, which forces it to be changed on next login.
+func (m fileUserManager) ExpirePassword(user string) error {
+	if !m.exists("shadow") {
+		return fmt.Errorf("unable to expire password of %q without /etc/shadow", user)
+	}
+	return m.updateEntry("shadow", user, 9, func(fields []string) {
+		fields[2] = "0"
+	})
+}
+
+func (m fileUserManager) exists(db string) bool {
+	_, err := os.Stat(path.Join(m.root, "etc", db))
+	return err == nil
+}
+
+// appendEntry adds a line to the end of the database db.
+func (m fileUserManager) appendEntry(db, entry string) error {
+	return m.editDatabase(db, func(lines []string) ([]string, error) {
+		return append(lines, entry), nil
+	})
+}
+
+// updateEntry calls fn with the fields of the entry of the database db for
+// the given name, so it can modify them in place.
+func (m fileUserManager) updateEntry(db, name string, nfields int, fn func([]string)) error {
+	return m.editDatabase(db, func(lines []string) ([]string, error) {
+		for i, line := range lines {
+			fields := strings.Split(line, ":")
+			if fields[0] != name {
+				continue
+			}
+			if len(fields) < nfields {
+				return nil, fmt.Errorf("invalid entry for %q in %s", name, db)
+			}
+			fn(fields)
+			lines[i] = strings.Join(fields, ":")
+			return lines, nil
+		}
+		return nil, fmt.Errorf("no entry for %q in %s", name, db)
+	})
+}
+
+// editDatabase replaces the lines of <root>/etc/<db> with those returned by
+// edit. The file is replaced atomically and keeps its mode and ownership.
+func (m fileUserManager) editDatabase(db string, edit func([]string) ([]string, error)) error {
+	file := File{config.File{
+		Path:               path.Join("/etc", db),
+		RawFilePermissions: "0644",
+	}}
+	if strings.HasSuffix(db, "shadow") {
+		file.RawFilePermissions = "0640"
+	}
+
+	var lines []string
+	fullpath := path.Join(m.root, file.Path)
+	contents, err := ioutil.ReadFile(fullpath)
+	if err == nil {
+		if s := strings.TrimSuffix(string(contents), "\n"); s != "" {
+			lines = strings.Split(s, "\n")
+		}
+		info, err := os.Stat(fullpath)
+		if err != nil {
+			return err
+		}
+		file.RawFilePermissions = fmt.Sprintf("%#o", info.Mode().Perm())
+		if st, ok := info.Sys().(*syscall.Stat_t); ok {
+			file.Owner = fmt.Sprintf("%d:%d", st.Uid, st.Gid)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if lines, err = edit(lines); err != nil {
+		return err
+	}
+	file.Content = strings.Join(lines, "\n") + "\n"
+	_, err = WriteFile(&file, m.root)
+	return err
+}
+
+// nextFreeId returns the lowest id not in used from the system or regular
+// range of ids.
+func nextFreeId(used map[int]bool, system bool) (int, error) {
+	min, max := minId, maxId
+	if system {
+		min, max = minSystemId, maxSystemId
+	}
+	for id := min; id <= max; id++ {
+		if !used[id] {
+			return id, nil
+		}
+	}
+	return -1, fmt.Errorf("no free id between %d and %d", min, max)
+}
+
+// lockedHash prefixes hash with "!" so it no longer matches any password,
+// unless it is locked already.
+func lockedHash(hash string) string {
+	if strings.HasPrefix(hash, "!") {
+		return hash
+	}
+	return "!" + hash
+}
+
+// expiryDays converts a date in the form YYYY-MM-DD into the number of days
+// since the epoch, as used in the expiration field of /etc/shadow.
+func expiryDays(date string) (string, error) {
+	if date == "" {
+		return "", nil
+	}
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return "", fmt.Errorf("invalid expiration date %q: %v", date, err)
+	}
+	return strconv.FormatInt(t.Unix()/(24*60*60), 10), nil
+}
+
+// lastChange returns today as the number of days since the epoch, as used
+// in the last password change field of /etc/shadow.
+func lastChange() string {
+	return strconv.FormatInt(time.Now().Unix()/(24*60*60), 10)
+}
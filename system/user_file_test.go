@@ -0,0 +1,154 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/elotl/cloud-init/config"
+)
+
+func TestNewUserManagerForOtherRoot(t *testing.T) {
+	if m := NewUserManager("/tmp/image"); m.Name() != "file" {
+		t.Errorf("bad user manager: want file, got %s", m.Name())
+	}
+}
+
+func TestFileUserManagerCreateUser(t *testing.T) {
+	dir := makeTestRoot(t)
+	defer os.RemoveAll(dir)
+	shadow := path.Join(dir, "etc", "shadow")
+	if err := ioutil.WriteFile(shadow, []byte("root:*:16000:0:99999:7:::\ncore:!:16000:0:99999:7:::\n"), 0640); err != nil {
+		t.Fatalf("Unable to write shadow: %v", err)
+	}
+
+	m := NewFileUserManager(dir)
+	for _, u := range []config.User{
+		{Name: "alice", GECOS: "Alice", PasswordHash: "$6$salt$hash", Groups: []string{"docker", "wheel"}},
+		{Name: "bob", PrimaryGroup: "docker", Homedir: "/srv/bob", Shell: "/bin/bash"},
+		{Name: "carol", NoUserGroup: true, NoCreateHome: true},
+		{Name: "daemon", System: true},
+	} {
+		if err := m.CreateUser(&u); err != nil {
+			t.Fatalf("Unable to create user %q: %v", u.Name, err)
+		}
+	}
+	if err := m.CreateUser(&config.User{Name: "alice"}); err == nil {
+		t.Errorf("bad error creating existing user: want failure, got nil")
+	}
+
+	passwd := NewPasswd(dir)
+	for _, tt := range []PasswdEntry{
+		{Name: "alice", Uid: 1000, Gid: 1000, GECOS: "Alice", HomeDir: "/home/alice", Shell: "/bin/sh"},
+		{Name: "bob", Uid: 1001, Gid: 233, HomeDir: "/srv/bob", Shell: "/bin/bash"},
+		{Name: "carol", Uid: 1002, Gid: 100, HomeDir: "/home/carol", Shell: "/bin/sh"},
+		{Name: "daemon", Uid: 100, Gid: 100, HomeDir: "/home/daemon", Shell: "/bin/sh"},
+	} {
+		u, err := passwd.LookupUser(tt.Name)
+		if err != nil {
+			t.Errorf("Unable to look up %q: %v", tt.Name, err)
+		} else if !reflect.DeepEqual(tt, *u) {
+			t.Errorf("bad entry for %q: want %+v, got %+v", tt.Name, tt, *u)
+		}
+	}
+
+	for _, tt := range []struct {
+		name    string
+		members []string
+	}{
+		{"alice", nil},
+		{"docker", []string{"core", "alice"}},
+		{"wheel", []string{"root", "core", "alice"}},
+	} {
+		g, err := passwd.LookupGroup(tt.name)
+		if err != nil {
+			t.Errorf("Unable to look up group %q: %v", tt.name, err)
+		} else if !reflect.DeepEqual(tt.members, g.Members) {
+			t.Errorf("bad members of %q: want %v, got %v", tt.name, tt.members, g.Members)
+		}
+	}
+	if _, err := passwd.LookupGroup("carol"); err == nil {
+		t.Errorf("bad groups: want no group for carol")
+	}
+
+	for _, tt := range []struct {
+		home   string
+		exists bool
+	}{
+		{"/home/alice", true},
+		{"/srv/bob", true},
+		{"/home/carol", false},
+		{"/home/daemon", false},
+	} {
+		if _, err := os.Stat(path.Join(dir, tt.home)); tt.exists != (err == nil) {
+			t.Errorf("bad home %s: want exists %t, got %v", tt.home, tt.exists, err)
+		}
+	}
+
+	contents, err := ioutil.ReadFile(shadow)
+	if err != nil {
+		t.Fatalf("Unable to read shadow: %v", err)
+	}
+	if !strings.Contains(string(contents), "\nalice:!$6$salt$hash:") || !strings.Contains(string(contents), "\nbob:!:") {
+		t.Errorf("bad shadow: %q", contents)
+	}
+	if info, err := os.Stat(shadow); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("bad shadow permissions: want 0640, got %v (%v)", info.Mode().Perm(), err)
+	}
+
+	if err := m.SetUserPassword("core", "$6$new$hash"); err != nil {
+		t.Fatalf("Unable to set password: %v", err)
+	}
+	if contents, _ := ioutil.ReadFile(shadow); !strings.Contains(string(contents), "\ncore:$6$new$hash:") {
+		t.Errorf("bad shadow after setting password: %q", contents)
+	}
+}
+
+func TestFileUserManagerCreateGroup(t *testing.T) {
+	dir := makeTestRoot(t)
+	defer os.RemoveAll(dir)
+
+	m := NewFileUserManager(dir)
+	for _, tt := range []struct {
+		group config.Group
+		gid   int
+		fail  bool
+	}{
+		{group: config.Group{Name: "kip"}, gid: 1000},
+		{group: config.Group{Name: "sys", System: true}, gid: 100},
+		{group: config.Group{Name: "fixed", Gid: 4242}, gid: 4242},
+		{group: config.Group{Name: "taken", Gid: 233}, fail: true},
+		{group: config.Group{Name: "docker"}, fail: true},
+	} {
+		err := m.CreateGroup(&tt.group)
+		if tt.fail != (err != nil) {
+			t.Errorf("bad error creating %+v: want failure %t, got %v", tt.group, tt.fail, err)
+		}
+		if tt.fail {
+			continue
+		}
+		g, err := NewPasswd(dir).LookupGroup(tt.group.Name)
+		if err != nil {
+			t.Errorf("Unable to look up group %q: %v", tt.group.Name, err)
+		} else if g.Gid != tt.gid {
+			t.Errorf("bad gid for %q: want %d, got %d", tt.group.Name, tt.gid, g.Gid)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/elotl/cloud-init/config"
+)
+
+// shadowUserManager manages users with useradd, groupadd and usermod from
+// shadow-utils, as found on Debian and most other distributions.
+type shadowUserManager struct{}
+
+func NewShadowUserManager() UserManager {
+	return shadowUserManager{}
+}
+
+func (shadowUserManager) Name() string {
+	return "shadow"
+}
+
+func (m shadowUserManager) CreateUser(u *config.User) error {
+	args := []string{}
+
+	if u.GECOS != "" {
+		args = append(args, "--comment", u.GECOS)
+	}
+	if u.Homedir != "" {
+		args = append(args, "--home-dir", u.Homedir)
+	}
+	if u.NoCreateHome || u.System {
+		args = append(args, "--no-create-home")
+	} else {
+		args = append(args, "--create-home")
+	}
+	if u.PrimaryGroup != "" {
+		args = append(args, "--gid", u.PrimaryGroup)
+	}
+	if len(u.Groups) > 0 {
+		args = append(args, "--groups", strings.Join(u.Groups, ","))
+	}
+	if u.NoUserGroup {
+		args = append(args, "--no-user-group")
+	}
+	if u.System {
+		args = append(args, "--system")
+	}
+	if u.NoLogInit {
+		args = append(args, "--no-log-init")
+	}
+	if u.PasswordHash != "" {
+		args = append(args, "--password", u.PasswordHash)
+	}
+	if u.Shell != "" {
+		args = append(args, "--shell", u.Shell)
+	}
+	if u.Uid != 0 {
+		args = append(args, "--uid", strconv.Itoa(u.Uid))
+	}
+	if u.ExpireDate != "" {
+		args = append(args, "--expiredate", u.ExpireDate)
+	}
+	if u.Inactive != "" {
+		args = append(args, "--inactive", u.Inactive)
+	}
+	args = append(args, u.Name)
+
+	if err := execCommand("useradd", args...); err != nil {
+		return err
+	}
+	// Accounts created without a password are locked already.
+	if u.PasswordHash != "" && u.PasswordLocked() {
+		return m.LockPassword(u.Name)
+	}
+	return nil
+}
+
+func (shadowUserManager) CreateGroup(g *config.Group) error {
+	args := []string{}
+	if g.Gid != 0 {
+		args = append(args, "--gid", strconv.Itoa(g.Gid))
+	}
+	if g.System {
+		args = append(args, "--system")
+	}
+	args = append(args, g.Name)
+	return execCommand("groupadd", args...)
+}
+
+func (shadowUserManager) AddUserToGroup(user, group string) error {
+	return execCommand("usermod", "--append", "--groups", group, user)
+}
+
+func (shadowUserManager) SetUserPassword(user, hash string) error {
+	return chpasswd(user, hash)
+}
+
+func (shadowUserManager) LockPassword(user string) error {
+	return execCommand("usermod", "--lock", user)
+}
+
+func (shadowUserManager) SetUserExpiry(user, expireDate, inactive string) error {
+	args := []string{}
+	if expireDate != "" {
+		args = append(args, "--expiredate", expireDate)
+	}
+	if inactive != "" {
+		args = append(args, "--inactive", inactive)
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	return execCommand("usermod", append(args, user)...)
+}
+
+func (shadowUserManager) ExpirePassword(user string) error {
+	return execCommand("passwd", "--expire", user)
+}